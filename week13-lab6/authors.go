@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Author Handlers =====================
+
+type Author struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name" binding:"required,max=255"`
+	Bio       string    `json:"bio" binding:"max=5000"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const authorColumns = "id, name, bio, created_at, updated_at"
+
+func scanAuthor(row rowScanner) (Author, error) {
+	var a Author
+	err := row.Scan(&a.ID, &a.Name, &a.Bio, &a.CreatedAt, &a.UpdatedAt)
+	return a, err
+}
+
+// @Summary List authors
+// @Tags Authors
+// @Produce  json
+// @Param   q  query  string  false  "Name contains"
+// @Success 200  {array}  Author
+// @Router  /authors [get]
+func getAuthors(c *gin.Context) {
+	query := "SELECT " + authorColumns + " FROM authors"
+	var args []interface{}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		query += " WHERE name ILIKE '%' || $1 || '%'"
+		args = append(args, q)
+	}
+
+	lastModified := collectionModified(c.Request.Context(), "authors")
+	rows, err := db.Query(query+" ORDER BY name", args...)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	authors := []Author{}
+	for rows.Next() {
+		a, err := scanAuthor(rows)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		authors = append(authors, a)
+	}
+
+	respondCached(c, authors, lastModified)
+}
+
+func getAuthor(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid author id")
+		return
+	}
+
+	a, err := scanAuthor(db.QueryRow("SELECT "+authorColumns+" FROM authors WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "author not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	respondCached(c, a, a.UpdatedAt)
+}
+
+func createAuthor(c *gin.Context) {
+	var a Author
+	if !bindJSON(c, &a) {
+		return
+	}
+	a.Name = strings.TrimSpace(a.Name)
+
+	created, err := scanAuthor(db.QueryRow(
+		"INSERT INTO authors (name, bio) VALUES ($1, $2) RETURNING "+authorColumns,
+		a.Name, a.Bio,
+	))
+	if isUniqueViolation(err) {
+		respondDuplicateName(c, "author")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "create", "authors", created.ID, gin.H{"name": created.Name}, c)
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func updateAuthor(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid author id")
+		return
+	}
+
+	var a Author
+	if !bindJSON(c, &a) {
+		return
+	}
+	a.Name = strings.TrimSpace(a.Name)
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	updated, err := scanAuthor(tx.QueryRow(
+		"UPDATE authors SET name = $1, bio = $2 WHERE id = $3 RETURNING "+authorColumns,
+		a.Name, a.Bio, id,
+	))
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "author not found")
+		return
+	} else if isUniqueViolation(err) {
+		respondDuplicateName(c, "author")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// เปลี่ยนชื่อแล้วต้อง sync books.author ของทุกเล่มที่เกี่ยวข้อง
+	if err := refreshAuthorText(tx, id); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	bookCache.reset()
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "update", "authors", id, gin.H{"name": updated.Name}, c)
+
+	c.JSON(http.StatusOK, updated)
+}
+
+func deleteAuthor(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid author id")
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM authors WHERE id = $1", id)
+	if isForeignKeyViolation(err) {
+		respondProblem(c, http.StatusConflict, codeConflict, "author still has books")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "author not found")
+		return
+	}
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "delete", "authors", id, nil, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "author deleted successfully"})
+}
+
+// @Summary List books by author
+// @Tags Authors
+// @Produce  json
+// @Param   id  path  int  true  "Author ID"
+// @Success 200  {array}  Book
+// @Failure 404  {object}  Problem
+// @Router  /authors/{id}/books [get]
+func getBooksByAuthor(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid author id")
+		return
+	}
+	if !catalogEntryExists(c, "authors", id, "author not found") {
+		return
+	}
+
+	filter, err := parseBookFilter(c)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	filter.add(condBookAuthor, id)
+	listBooks(c, filter)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+
+	"week13-lab6/isbn"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ===================== ISBN Handling =====================
+
+// normalizeBookISBN rewrites book.ISBN to the canonical ISBN-13 form. The
+// isbn_any binding rule has already rejected invalid values.
+func normalizeBookISBN(book *Book) {
+	if normalized, err := isbn.Normalize(book.ISBN); err == nil {
+		book.ISBN = normalized
+	}
+}
+
+// isUniqueViolation ตรวจ error code 23505 ของ Postgres (unique_violation)
+func isUniqueViolation(err error) bool {
+	if pqErr, ok := err.(*pq.Error); ok {
+		return pqErr.Code == "23505"
+	}
+	return false
+}
+
+// @Summary Get book by ISBN
+// @Description Look up a book by ISBN-10 or ISBN-13, with or without hyphens
+// @Tags Books
+// @Produce  json
+// @Param   isbn  path  string  true  "ISBN"
+// @Success 200  {object}  Book
+// @Failure 400  {object}  Problem
+// @Failure 404  {object}  Problem
+// @Router  /books/by-isbn/{isbn} [get]
+func getBookByISBN(c *gin.Context) {
+	normalized, err := isbn.Normalize(c.Param("isbn"))
+	if err != nil {
+		respondValidation(c, []FieldError{{Field: "isbn", Code: fieldInvalidISBN, Message: err.Error()}})
+		return
+	}
+
+	book, err := scanBook(db.QueryRow(
+		"SELECT "+bookColumns+" FROM books WHERE isbn = $1 AND deleted_at IS NULL", normalized,
+	))
+	if err == nil && book.Status != statusPublished && !canSeeUnpublished(c) {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(c.Request.Context(), "error looking up isbn", "isbn", normalized, "error", err)
+		respondProblem(c, http.StatusInternalServerError, codeInternal, "")
+		return
+	}
+
+	respondCached(c, book, book.lastModified())
+}
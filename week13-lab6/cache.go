@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ===================== HTTP Caching =====================
+
+// Cache-Control policies per route. API ต้อง login ก่อน จึงใช้ private เสมอ
+const (
+	cachePolicyList   = "private, max-age=60, must-revalidate"
+	cachePolicyDetail = "private, max-age=300, must-revalidate"
+	cachePolicyNone   = "no-store"
+)
+
+func cacheControl(policy string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", "Authorization")
+		c.Writer = &cachePolicyWriter{ResponseWriter: c.Writer, policy: policy}
+		c.Next()
+	}
+}
+
+// cachePolicyWriter sets Cache-Control when the status is known, just
+// before the headers are sent: the route's policy for 200 and 304, no-store
+// for everything else so errors are never reused from a cache.
+type cachePolicyWriter struct {
+	gin.ResponseWriter
+	policy string
+}
+
+// apply runs again on every status change until the headers are written;
+// a bodiless 304 is flushed by gin without going through this writer, so
+// WriteHeader must already have set the header.
+func (w *cachePolicyWriter) apply() {
+	if w.Written() {
+		return
+	}
+	switch w.Status() {
+	case http.StatusOK, http.StatusNotModified:
+		w.Header().Set("Cache-Control", w.policy)
+	default:
+		w.Header().Set("Cache-Control", cachePolicyNone)
+	}
+}
+
+func (w *cachePolicyWriter) WriteHeader(code int) {
+	w.ResponseWriter.WriteHeader(code)
+	w.apply()
+}
+
+func (w *cachePolicyWriter) WriteHeaderNow() {
+	w.apply()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *cachePolicyWriter) Write(data []byte) (int, error) {
+	w.apply()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *cachePolicyWriter) WriteString(s string) (int, error) {
+	w.apply()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *cachePolicyWriter) Flush() {
+	w.apply()
+	w.ResponseWriter.Flush()
+}
+
+// collectionModified is the Last-Modified of a listing: the last time any
+// of tables changed, deletes included, as recorded by the table_changes
+// triggers. The newest updated_at among the returned rows cannot be used
+// because it does not move when a row leaves the result. A zero time (no
+// header, ETag only) is returned if the lookup fails.
+func collectionModified(ctx context.Context, tables ...string) time.Time {
+	var changed sql.NullTime
+	err := db.QueryRowContext(ctx,
+		"SELECT MAX(changed_at) FROM table_changes WHERE table_name = ANY($1)", pq.Array(tables),
+	).Scan(&changed)
+	if err != nil {
+		slog.WarnContext(ctx, "error reading table_changes", "tables", tables, "error", err)
+		return time.Time{}
+	}
+	return changed.Time
+}
+
+// booksModified is collectionModified for book listings, which also show
+// in_stock; stock has no change trigger (it is updated on every checkout)
+// so its newest updated_at is used instead.
+func booksModified(ctx context.Context) time.Time {
+	modified := collectionModified(ctx, "books")
+	var stockModified sql.NullTime
+	if err := db.QueryRowContext(ctx, "SELECT MAX(updated_at) FROM stock").Scan(&stockModified); err != nil {
+		slog.WarnContext(ctx, "error reading stock updated_at", "error", err)
+		return time.Time{}
+	}
+	if stockModified.Time.After(modified) {
+		modified = stockModified.Time
+	}
+	return modified
+}
+
+// respondCached writes body as JSON with ETag/Last-Modified headers, or a
+// 304 Not Modified when the client's validators still match.
+func respondCached(c *gin.Context, body interface{}, lastModified time.Time) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		respondProblem(c, http.StatusInternalServerError, codeInternal, "")
+		return
+	}
+
+	sum := sha256.Sum256(payload)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(c.Request, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", payload)
+}
+
+// If-None-Match มาก่อน If-Modified-Since ตาม RFC 9110
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		// Last-Modified มีความละเอียดแค่วินาที
+		return !lastModified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
+
+// ===================== Book Read-Through Cache =====================
+
+type cachedBook struct {
+	book      Book
+	expiresAt time.Time
+}
+
+type bookCacheStore struct {
+	mu    sync.RWMutex
+	ttl   time.Duration
+	items map[int]cachedBook
+}
+
+// bookCache is nil when BOOK_CACHE_TTL is unset, which disables caching.
+var bookCache *bookCacheStore
+
+func initBookCache() {
+	ttl := cfg.Catalog.BookCacheTTL
+	if ttl <= 0 {
+		return
+	}
+	bookCache = &bookCacheStore{ttl: ttl, items: make(map[int]cachedBook)}
+}
+
+func (s *bookCacheStore) get(id int) (Book, bool) {
+	if s == nil {
+		return Book{}, false
+	}
+	s.mu.RLock()
+	item, ok := s.items[id]
+	s.mu.RUnlock()
+	if !ok || time.Now().After(item.expiresAt) {
+		return Book{}, false
+	}
+	return item.book, true
+}
+
+func (s *bookCacheStore) set(book Book) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.items[book.ID] = cachedBook{book: book, expiresAt: time.Now().Add(s.ttl)}
+	s.mu.Unlock()
+}
+
+func (s *bookCacheStore) invalidate(id int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	delete(s.items, id)
+	s.mu.Unlock()
+}
+
+// reset drops every entry, used after bulk changes such as imports.
+func (s *bookCacheStore) reset() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.items = make(map[int]cachedBook)
+	s.mu.Unlock()
+}
+
+// loadBook returns a book by ID, consulting bookCache before Postgres.
+func loadBook(ctx context.Context, id int) (Book, error) {
+	if book, ok := bookCache.get(id); ok {
+		return book, nil
+	}
+
+	book, err := scanBook(db.QueryRowContext(ctx,
+		"SELECT "+bookColumns+" FROM books WHERE id = $1 AND deleted_at IS NULL", id,
+	))
+	if err != nil {
+		return Book{}, err
+	}
+	if book.Authors, err = loadBookAuthors(db, id); err != nil {
+		return Book{}, err
+	}
+
+	bookCache.set(book)
+	return book, nil
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"week13-lab6/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Shopping Cart =====================
+
+const (
+	guestCartCookie = "cart_token"
+	maxCartQuantity = 99
+)
+
+type Cart struct {
+	Currency      string      `json:"currency"`
+	Items         []CartItem  `json:"items"`
+	ItemCount     int         `json:"item_count"`
+	Subtotal      money.Money `json:"subtotal"`       // ราคาก่อนลด
+	DiscountTotal money.Money `json:"discount_total"` // ส่วนที่ลดไป รวมโปรโมชัน
+	Total         money.Money `json:"total"`          // ยอดที่ต้องจ่าย รวม VAT
+	Tax           TaxSummary  `json:"tax"`
+	// ส่วนลดจากโปรโมชันและคูปอง แยกตามกฎที่ใช้
+	Promotions  []AppliedPromotion `json:"promotions"`
+	CouponCode  string             `json:"coupon_code,omitempty"`
+	CouponError *CouponRejection   `json:"coupon_error,omitempty"` // คูปองไม่เข้าเงื่อนไข
+	UpdatedAt   *time.Time         `json:"updated_at,omitempty"`
+}
+
+type CartItem struct {
+	BookID     int         `json:"book_id"`
+	Title      string      `json:"title"`
+	Author     string      `json:"author"`
+	ISBN       string      `json:"isbn"`
+	CoverImage string      `json:"cover_image"`
+	Quantity   int         `json:"quantity"`
+	ListPrice  money.Money `json:"list_price"`
+	UnitPrice  money.Money `json:"unit_price"`
+	Discount   int         `json:"discount"`
+	LineTotal  money.Money `json:"line_total"`
+	InStock    bool        `json:"in_stock"`
+	// false เมื่อหนังสือเลิกขายหลังจากใส่ตะกร้า ไม่นับในยอดรวม
+	Available bool `json:"available"`
+}
+
+type AddCartItemRequest struct {
+	BookID   int `json:"book_id" binding:"required,gt=0"`
+	Quantity int `json:"quantity" binding:"omitempty,min=1,max=99"` // ไม่ส่ง = 1
+}
+
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity" binding:"required,min=1,max=99"`
+}
+
+// optionalAuthMiddleware authenticates when an Authorization header is
+// present and lets anonymous requests through otherwise.
+func optionalAuthMiddleware() gin.HandlerFunc {
+	required := authMiddleware()
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		required(c)
+	}
+}
+
+// newRandomToken returns 32 random bytes, hex encoded (guest carts, share links).
+func newRandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func guestCartTTL() time.Duration {
+	return cfg.Catalog.GuestCartTTL
+}
+
+// resolveCart returns the caller's cart ID: the user's cart when logged in,
+// otherwise the guest cart named by the cookie. With create=false a missing
+// cart yields 0; with create=true one is created (and the cookie set).
+func resolveCart(c *gin.Context, create bool) (int, error) {
+	var cartID int
+
+	if userID, ok := c.Get("user_id"); ok {
+		err := db.QueryRow("SELECT id FROM carts WHERE user_id = $1", userID).Scan(&cartID)
+		if err == sql.ErrNoRows && create {
+			err = db.QueryRow(
+				`INSERT INTO carts (user_id) VALUES ($1)
+				 ON CONFLICT (user_id) DO UPDATE SET updated_at = NOW()
+				 RETURNING id`,
+				userID,
+			).Scan(&cartID)
+		}
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return cartID, err
+	}
+
+	token, _ := c.Cookie(guestCartCookie)
+	if token != "" {
+		err := db.QueryRow("SELECT id FROM carts WHERE guest_token = $1", token).Scan(&cartID)
+		if err != sql.ErrNoRows {
+			return cartID, err
+		}
+	}
+	if !create {
+		return 0, nil
+	}
+
+	// cookie หายหรือหมดอายุ: ออก token ใหม่
+	token, err := newRandomToken()
+	if err != nil {
+		return 0, err
+	}
+	if err := db.QueryRow("INSERT INTO carts (guest_token) VALUES ($1) RETURNING id", token).Scan(&cartID); err != nil {
+		return 0, err
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(guestCartCookie, token, int(guestCartTTL().Seconds()), "/", "", c.Request.TLS != nil, true)
+	return cartID, nil
+}
+
+// loadCart reads the items and recalculates every total from current book
+// prices in the currency of pc.
+func loadCart(cartID int, pc priceContext) (Cart, error) {
+	zero := money.New(0, pc.Currency)
+	cart := Cart{
+		Currency:      pc.Currency,
+		Items:         []CartItem{},
+		Subtotal:      zero,
+		DiscountTotal: zero,
+		Total:         zero,
+		Tax:           applyVAT(zero, vatRateBP, pricesIncludeVAT),
+		Promotions:    []AppliedPromotion{},
+	}
+	if cartID == 0 {
+		return cart, nil
+	}
+
+	var updatedAt time.Time
+	var userID sql.NullInt64
+	var couponCode sql.NullString
+	err := db.QueryRow("SELECT updated_at, user_id, coupon_code FROM carts WHERE id = $1", cartID).Scan(&updatedAt, &userID, &couponCode)
+	if err != nil {
+		return cart, err
+	}
+	cart.UpdatedAt = &updatedAt
+	cart.CouponCode = couponCode.String
+
+	rows, err := db.Query(
+		`SELECT b.id, b.title, b.author, b.isbn, b.cover_image, ci.quantity,
+		        `+bookPriceColumns("$3")+`,
+		        COALESCE(s.on_hand > s.reserved, false),
+		        b.deleted_at IS NULL AND b.status = $2
+		 FROM cart_items ci
+		 JOIN books b ON b.id = ci.book_id
+		 LEFT JOIN stock s ON s.book_id = b.id
+		 WHERE ci.cart_id = $1
+		 ORDER BY ci.added_at, b.id`,
+		cartID, statusPublished, pc.Currency,
+	)
+	if err != nil {
+		return cart, err
+	}
+	defer rows.Close()
+
+	goods := zero
+	var lines []pricingLine
+	for rows.Next() {
+		var it CartItem
+		var price int64
+		var originalPrice, listed *int64
+		err := rows.Scan(
+			&it.BookID, &it.Title, &it.Author, &it.ISBN, &it.CoverImage, &it.Quantity,
+			&price, &originalPrice, &it.Discount, &listed, &it.InStock, &it.Available,
+		)
+		if err != nil {
+			return cart, err
+		}
+
+		it.ListPrice, it.UnitPrice = pc.bookPrices(price, originalPrice, it.Discount, listed)
+		it.LineTotal = it.UnitPrice.Mul(int64(it.Quantity))
+		if it.Available {
+			cart.ItemCount += it.Quantity
+			cart.Subtotal = cart.Subtotal.Add(it.ListPrice.Mul(int64(it.Quantity)))
+			goods = goods.Add(it.LineTotal)
+			lines = append(lines, pricingLine{BookID: it.BookID, Quantity: it.Quantity, LineTotal: it.LineTotal})
+		}
+		cart.Items = append(cart.Items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return cart, err
+	}
+	rows.Close()
+
+	cart.Promotions, cart.CouponError, err = evaluatePromotions(db, pc, lines, int(userID.Int64), cart.CouponCode, false)
+	if err != nil {
+		return cart, err
+	}
+
+	goods = goods.Sub(sumPromotions(pc.Currency, cart.Promotions))
+	cart.DiscountTotal = cart.Subtotal.Sub(goods)
+	cart.Tax = applyVAT(goods, vatRateBP, pricesIncludeVAT)
+	cart.Total = cart.Tax.Gross
+	return cart, nil
+}
+
+// respondCart prices the cart in the currency of ?currency= (default THB).
+func respondCart(c *gin.Context, cartID int, status int) {
+	pc, ok := priceContextFromQuery(c)
+	if !ok {
+		return
+	}
+	cart, err := loadCart(cartID, pc)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	c.JSON(status, cart)
+}
+
+func touchCart(cartID int) {
+	db.Exec("UPDATE carts SET updated_at = NOW() WHERE id = $1", cartID)
+}
+
+// @Summary Get the current cart
+// @Description Works for logged-in users and for guests identified by the cart_token cookie
+// @Tags Cart
+// @Produce  json
+// @Param   currency  query  string  false  "Price the cart in this currency (default THB)"
+// @Success 200  {object}  Cart
+// @Router  /cart [get]
+func getCart(c *gin.Context) {
+	cartID, err := resolveCart(c, false)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	respondCart(c, cartID, http.StatusOK)
+}
+
+// @Summary Add a book to the cart
+// @Description Adds to the existing quantity when the book is already in the cart
+// @Tags Cart
+// @Accept  json
+// @Produce  json
+// @Param   body  body  AddCartItemRequest  true  "Item"
+// @Success 200  {object}  Cart
+// @Failure 404  {object}  Problem
+// @Router  /cart/items [post]
+func addCartItem(c *gin.Context) {
+	var req AddCartItemRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	// ใส่ตะกร้าได้เฉพาะหนังสือที่เผยแพร่แล้ว
+	var exists bool
+	err := db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM books WHERE id = $1 AND deleted_at IS NULL AND status = $2)",
+		req.BookID, statusPublished,
+	).Scan(&exists)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if !exists {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	}
+
+	cartID, err := resolveCart(c, true)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	_, err = db.Exec(
+		`INSERT INTO cart_items (cart_id, book_id, quantity) VALUES ($1, $2, $3)
+		 ON CONFLICT (cart_id, book_id)
+		 DO UPDATE SET quantity = LEAST(cart_items.quantity + EXCLUDED.quantity, $4)`,
+		cartID, req.BookID, req.Quantity, maxCartQuantity,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	touchCart(cartID)
+
+	respondCart(c, cartID, http.StatusOK)
+}
+
+func updateCartItem(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("book_id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+
+	var req UpdateCartItemRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	cartID, err := resolveCart(c, false)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	result, err := db.Exec(
+		"UPDATE cart_items SET quantity = $1 WHERE cart_id = $2 AND book_id = $3",
+		req.Quantity, cartID, bookID,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book is not in the cart")
+		return
+	}
+	touchCart(cartID)
+
+	respondCart(c, cartID, http.StatusOK)
+}
+
+func removeCartItem(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("book_id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+
+	cartID, err := resolveCart(c, false)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM cart_items WHERE cart_id = $1 AND book_id = $2", cartID, bookID)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book is not in the cart")
+		return
+	}
+	touchCart(cartID)
+
+	respondCart(c, cartID, http.StatusOK)
+}
+
+func clearCart(c *gin.Context) {
+	cartID, err := resolveCart(c, false)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	if cartID != 0 {
+		if _, err := db.Exec("DELETE FROM cart_items WHERE cart_id = $1", cartID); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		touchCart(cartID)
+	}
+
+	respondCart(c, cartID, http.StatusOK)
+}
+
+// mergeGuestCart moves the guest cart named by the cookie into the user's
+// cart after login. Quantities of the same book are added up (capped at 99).
+// Failures are logged only; they must not block the login.
+func mergeGuestCart(c *gin.Context, userID int) {
+	token, err := c.Cookie(guestCartCookie)
+	if err != nil || token == "" {
+		return
+	}
+	// cookie ใช้ครั้งเดียว ลบทิ้งไม่ว่าจะ merge สำเร็จหรือไม่
+	c.SetCookie(guestCartCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+
+	tx, err := db.Begin()
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "error merging guest cart", "error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var guestCartID int
+	var guestCoupon sql.NullString
+	err = tx.QueryRow("SELECT id, coupon_code FROM carts WHERE guest_token = $1 FOR UPDATE", token).Scan(&guestCartID, &guestCoupon)
+	if err == sql.ErrNoRows {
+		return
+	} else if err != nil {
+		slog.ErrorContext(c.Request.Context(), "error merging guest cart", "error", err)
+		return
+	}
+
+	var userCartID int
+	err = tx.QueryRow(
+		`INSERT INTO carts (user_id, coupon_code) VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE
+		 SET updated_at = NOW(), coupon_code = COALESCE(carts.coupon_code, EXCLUDED.coupon_code)
+		 RETURNING id`,
+		userID, guestCoupon,
+	).Scan(&userCartID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "error merging guest cart", "error", err)
+		return
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO cart_items (cart_id, book_id, quantity, added_at)
+		 SELECT $1, book_id, quantity, added_at FROM cart_items WHERE cart_id = $2
+		 ON CONFLICT (cart_id, book_id)
+		 DO UPDATE SET quantity = LEAST(cart_items.quantity + EXCLUDED.quantity, $3)`,
+		userCartID, guestCartID, maxCartQuantity,
+	)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "error merging guest cart", "error", err)
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM carts WHERE id = $1", guestCartID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "error merging guest cart", "error", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(c.Request.Context(), "error merging guest cart", "error", err)
+	}
+}
+
+// runGuestCartPurger removes guest carts untouched for GUEST_CART_TTL.
+func runGuestCartPurger(ctx context.Context) {
+	runEvery(ctx, time.Hour, func() {
+		cutoff := time.Now().Add(-guestCartTTL())
+		result, err := db.Exec("DELETE FROM carts WHERE guest_token IS NOT NULL AND updated_at < $1", cutoff)
+		if err != nil {
+			slog.ErrorContext(ctx, "error purging guest carts", "error", err)
+		} else if n, _ := result.RowsAffected(); n > 0 {
+			slog.InfoContext(ctx, "purged stale guest carts", "carts", n)
+		}
+	})
+}
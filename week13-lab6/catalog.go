@@ -0,0 +1,306 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ===================== Book Relations =====================
+
+// books.author, books.publisher และ books.category เป็นชื่อที่ sync มาจาก
+// authors/publishers/categories เพื่อให้ list, filter และ export ไม่ต้อง join
+
+type BookAuthor struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+}
+
+// relationError means a referenced author, publisher or category is invalid.
+type relationError struct {
+	field FieldError
+}
+
+func (e *relationError) Error() string {
+	return e.field.Field + ": " + e.field.Message
+}
+
+func notFoundRelation(field string, id int) *relationError {
+	return &relationError{FieldError{
+		Field:   field,
+		Code:    fieldNotFound,
+		Message: fmt.Sprintf("%d does not exist", id),
+	}}
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// isForeignKeyViolation ตรวจ error code 23503 ของ Postgres (foreign_key_violation)
+func isForeignKeyViolation(err error) bool {
+	if pqErr, ok := err.(*pq.Error); ok {
+		return pqErr.Code == "23503"
+	}
+	return false
+}
+
+// categorySlug ต้องให้ผลเหมือน regexp_replace ใน migration9.sql
+func categorySlug(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), "-"))
+}
+
+// joinAuthorNames formats names the way the seed data does:
+// "A", "A and B", "A, B and C".
+func joinAuthorNames(names []string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// applyBookRelations resolves the book's authors, publisher and category,
+// writes the links and synced names, and fills book.Authors. author_ids
+// takes precedence over the author text; publisher_id and category_id take
+// precedence over the names, which are created on first use.
+func applyBookRelations(tx *sql.Tx, book *Book) error {
+	publisherID, publisher, err := resolvePublisher(tx, book.PublisherID, book.Publisher)
+	if err != nil {
+		return err
+	}
+	categoryID, category, err := resolveCategory(tx, book.CategoryID, book.Category)
+	if err != nil {
+		return err
+	}
+
+	if len(book.AuthorIDs) > 0 {
+		names, err := authorNamesByID(tx, book.AuthorIDs)
+		if err != nil {
+			return err
+		}
+		book.Author = joinAuthorNames(names)
+		if len(book.Author) > 255 {
+			return &relationError{FieldError{Field: "author_ids", Code: fieldTooLong, Message: "combined author names must be at most 255 characters"}}
+		}
+	}
+
+	_, err = tx.Exec(
+		`UPDATE books
+		 SET author = $1, publisher_id = $2, publisher = $3, category_id = $4, category = $5
+		 WHERE id = $6`,
+		book.Author, publisherID, publisher, categoryID, category, book.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if len(book.AuthorIDs) > 0 {
+		if _, err := tx.Exec("DELETE FROM book_authors WHERE book_id = $1", book.ID); err != nil {
+			return err
+		}
+		for i, authorID := range book.AuthorIDs {
+			_, err := tx.Exec(
+				"INSERT INTO book_authors (book_id, author_id, position) VALUES ($1, $2, $3)",
+				book.ID, authorID, i+1,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	} else if _, err := tx.Exec("SELECT sync_book_authors($1)", book.ID); err != nil {
+		// ไม่ส่ง author_ids มา: แยกชื่อจาก author text แบบเดียวกับ migration
+		return err
+	}
+
+	book.PublisherID, book.Publisher = publisherID, publisher
+	book.CategoryID, book.Category = categoryID, category
+	book.AuthorIDs = nil
+	book.Authors, err = loadBookAuthors(tx, book.ID)
+	return err
+}
+
+func resolvePublisher(tx *sql.Tx, id *int, name string) (*int, string, error) {
+	if id != nil {
+		err := tx.QueryRow("SELECT name FROM publishers WHERE id = $1", *id).Scan(&name)
+		if err == sql.ErrNoRows {
+			return nil, "", notFoundRelation("publisher_id", *id)
+		}
+		return id, name, err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", nil
+	}
+	if _, err := tx.Exec("INSERT INTO publishers (name) VALUES ($1) ON CONFLICT DO NOTHING", name); err != nil {
+		return nil, "", err
+	}
+	var publisherID int
+	err := tx.QueryRow("SELECT id, name FROM publishers WHERE lower(name) = lower($1)", name).Scan(&publisherID, &name)
+	return &publisherID, name, err
+}
+
+func resolveCategory(tx *sql.Tx, id *int, name string) (*int, string, error) {
+	if id != nil {
+		err := tx.QueryRow("SELECT name FROM categories WHERE id = $1", *id).Scan(&name)
+		if err == sql.ErrNoRows {
+			return nil, "", notFoundRelation("category_id", *id)
+		}
+		return id, name, err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", nil
+	}
+	slug := categorySlug(name)
+	_, err := tx.Exec("INSERT INTO categories (name, slug) VALUES ($1, $2) ON CONFLICT DO NOTHING", name, slug)
+	if err != nil {
+		return nil, "", err
+	}
+	var categoryID int
+	err = tx.QueryRow("SELECT id, name FROM categories WHERE slug = $1", slug).Scan(&categoryID, &name)
+	return &categoryID, name, err
+}
+
+// authorNamesByID returns the names in the same order as ids.
+func authorNamesByID(tx *sql.Tx, ids []int) ([]string, error) {
+	rows, err := tx.Query("SELECT id, name FROM authors WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int]string, len(ids))
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		byID[id] = name
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		name, ok := byID[id]
+		if !ok {
+			return nil, notFoundRelation(fmt.Sprintf("author_ids[%d]", i), id)
+		}
+		names[i] = name
+	}
+	return names, nil
+}
+
+func loadBookAuthors(q queryer, bookID int) ([]BookAuthor, error) {
+	rows, err := q.Query(
+		`SELECT a.id, a.name, ba.position
+		 FROM book_authors ba
+		 JOIN authors a ON a.id = ba.author_id
+		 WHERE ba.book_id = $1
+		 ORDER BY ba.position`,
+		bookID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	authors := []BookAuthor{}
+	for rows.Next() {
+		var a BookAuthor
+		if err := rows.Scan(&a.ID, &a.Name, &a.Position); err != nil {
+			return nil, err
+		}
+		authors = append(authors, a)
+	}
+	return authors, rows.Err()
+}
+
+// refreshAuthorText rebuilds books.author for every book linked to authorID,
+// e.g. after the author is renamed.
+func refreshAuthorText(tx *sql.Tx, authorID int) error {
+	rows, err := tx.Query("SELECT book_id FROM book_authors WHERE author_id = $1", authorID)
+	if err != nil {
+		return err
+	}
+	var bookIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		bookIDs = append(bookIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, bookID := range bookIDs {
+		authors, err := loadBookAuthors(tx, bookID)
+		if err != nil {
+			return err
+		}
+		names := make([]string, len(authors))
+		for i, a := range authors {
+			names[i] = a.Name
+		}
+		if _, err := tx.Exec("UPDATE books SET author = $1 WHERE id = $2", joinAuthorNames(names), bookID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ===================== Catalog Helpers =====================
+
+// respondDuplicateName is shared by authors, publishers and categories.
+func respondDuplicateName(c *gin.Context, entity string) {
+	respondProblemWith(c, Problem{
+		Status: http.StatusConflict,
+		Code:   codeConflict,
+		Detail: "a " + entity + " with this name already exists",
+		Errors: []FieldError{{Field: "name", Code: fieldDuplicate, Message: "already exists"}},
+	})
+}
+
+// catalogEntryExists writes a 404 and returns false when table has no row with id.
+func catalogEntryExists(c *gin.Context, table string, id int, notFound string) bool {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM "+table+" WHERE id = $1)", id).Scan(&exists)
+	if err != nil {
+		respondInternalError(c, err)
+		return false
+	}
+	if !exists {
+		respondProblem(c, http.StatusNotFound, codeNotFound, notFound)
+		return false
+	}
+	return true
+}
+
+// respondRelationError reports an invalid reference as a validation problem
+// and anything else as an internal error.
+func respondRelationError(c *gin.Context, err error) {
+	if relErr, ok := err.(*relationError); ok {
+		respondValidation(c, []FieldError{relErr.field})
+		return
+	}
+	respondInternalError(c, err)
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Category Handlers =====================
+
+type Category struct {
+	ID          int         `json:"id"`
+	Name        string      `json:"name" binding:"required,max=100"`
+	Slug        string      `json:"slug" binding:"max=120"` // ไม่ส่งมา = สร้างจาก name
+	ParentID    *int        `json:"parent_id" binding:"omitempty,gt=0"`
+	Description string      `json:"description" binding:"max=5000"`
+	Children    []*Category `json:"children,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+const categoryColumns = "id, name, slug, parent_id, description, created_at, updated_at"
+
+func scanCategory(row rowScanner) (Category, error) {
+	var cat Category
+	err := row.Scan(&cat.ID, &cat.Name, &cat.Slug, &cat.ParentID, &cat.Description, &cat.CreatedAt, &cat.UpdatedAt)
+	return cat, err
+}
+
+// @Summary List categories
+// @Description Flat list ordered by name, or nested under their parents with tree=true
+// @Tags Categories
+// @Produce  json
+// @Param   tree  query  bool  false  "Nest subcategories under children"
+// @Success 200  {array}  Category
+// @Router  /categories [get]
+func getCategories(c *gin.Context) {
+	lastModified := collectionModified(c.Request.Context(), "categories")
+	rows, err := db.Query("SELECT " + categoryColumns + " FROM categories ORDER BY name")
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	categories := []*Category{}
+	for rows.Next() {
+		cat, err := scanCategory(rows)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		categories = append(categories, &cat)
+	}
+
+	if c.Query("tree") == "true" {
+		categories = buildCategoryTree(categories)
+	}
+
+	respondCached(c, categories, lastModified)
+}
+
+// buildCategoryTree keeps the input order within each level.
+func buildCategoryTree(categories []*Category) []*Category {
+	byID := make(map[int]*Category, len(categories))
+	for _, cat := range categories {
+		byID[cat.ID] = cat
+	}
+
+	roots := []*Category{}
+	for _, cat := range categories {
+		if cat.ParentID != nil {
+			if parent, ok := byID[*cat.ParentID]; ok {
+				parent.Children = append(parent.Children, cat)
+				continue
+			}
+		}
+		roots = append(roots, cat)
+	}
+	return roots
+}
+
+func getCategory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid category id")
+		return
+	}
+
+	cat, err := scanCategory(db.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "category not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// แนบหมวดย่อยชั้นถัดไปมาด้วย
+	rows, err := db.Query("SELECT "+categoryColumns+" FROM categories WHERE parent_id = $1 ORDER BY name", id)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		child, err := scanCategory(rows)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		cat.Children = append(cat.Children, &child)
+	}
+
+	respondCached(c, cat, cat.UpdatedAt)
+}
+
+// bindCategory binds the body and derives the slug. It writes the error
+// response itself and returns false on failure.
+func bindCategory(c *gin.Context) (Category, bool) {
+	var cat Category
+	if !bindJSON(c, &cat) {
+		return cat, false
+	}
+	cat.Name = strings.TrimSpace(cat.Name)
+	if cat.Slug == "" {
+		cat.Slug = cat.Name
+	}
+	cat.Slug = categorySlug(cat.Slug)
+	if cat.Slug == "" {
+		respondValidation(c, []FieldError{{Field: "slug", Code: fieldRequired, Message: "is required"}})
+		return cat, false
+	}
+	return cat, true
+}
+
+func createCategory(c *gin.Context) {
+	cat, ok := bindCategory(c)
+	if !ok {
+		return
+	}
+
+	created, err := scanCategory(db.QueryRow(
+		`INSERT INTO categories (name, slug, parent_id, description)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+categoryColumns,
+		cat.Name, cat.Slug, cat.ParentID, cat.Description,
+	))
+	if isUniqueViolation(err) {
+		respondDuplicateSlug(c)
+		return
+	} else if isForeignKeyViolation(err) {
+		respondValidation(c, []FieldError{notFoundRelation("parent_id", *cat.ParentID).field})
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "create", "categories", created.ID, gin.H{
+		"name":      created.Name,
+		"parent_id": created.ParentID,
+	}, c)
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func updateCategory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid category id")
+		return
+	}
+
+	cat, ok := bindCategory(c)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// ห้ามย้ายหมวดไปอยู่ใต้ตัวเองหรือหมวดลูกของตัวเอง (จะเกิด cycle)
+	if cat.ParentID != nil {
+		var cycle bool
+		err := tx.QueryRow(
+			`WITH RECURSIVE subtree AS (
+				SELECT id FROM categories WHERE id = $1
+				UNION ALL
+				SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+			)
+			SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2)`,
+			id, *cat.ParentID,
+		).Scan(&cycle)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		if cycle {
+			respondValidation(c, []FieldError{{
+				Field:   "parent_id",
+				Code:    fieldOutOfRange,
+				Message: "must not be the category itself or one of its subcategories",
+			}})
+			return
+		}
+	}
+
+	updated, err := scanCategory(tx.QueryRow(
+		`UPDATE categories
+		 SET name = $1, slug = $2, parent_id = $3, description = $4
+		 WHERE id = $5
+		 RETURNING `+categoryColumns,
+		cat.Name, cat.Slug, cat.ParentID, cat.Description, id,
+	))
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "category not found")
+		return
+	} else if isUniqueViolation(err) {
+		respondDuplicateSlug(c)
+		return
+	} else if isForeignKeyViolation(err) {
+		respondValidation(c, []FieldError{notFoundRelation("parent_id", *cat.ParentID).field})
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE books SET category = $1 WHERE category_id = $2", updated.Name, id); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	bookCache.reset()
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "update", "categories", id, gin.H{
+		"name":      updated.Name,
+		"parent_id": updated.ParentID,
+	}, c)
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// deleteCategory ลบได้เฉพาะหมวดที่ไม่มีหมวดย่อย หนังสือในหมวดจะกลายเป็นไม่มีหมวด
+func deleteCategory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid category id")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE books SET category = '' WHERE category_id = $1", id); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	result, err := tx.Exec("DELETE FROM categories WHERE id = $1", id)
+	if isForeignKeyViolation(err) {
+		respondProblem(c, http.StatusConflict, codeConflict, "category still has subcategories")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "category not found")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	bookCache.reset()
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "delete", "categories", id, nil, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "category deleted successfully"})
+}
+
+// @Summary List books by category
+// @Description Includes books in every subcategory
+// @Tags Categories
+// @Produce  json
+// @Param   id  path  int  true  "Category ID"
+// @Success 200  {array}  Book
+// @Failure 404  {object}  Problem
+// @Router  /categories/{id}/books [get]
+func getBooksByCategory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid category id")
+		return
+	}
+	if !catalogEntryExists(c, "categories", id, "category not found") {
+		return
+	}
+
+	filter, err := parseBookFilter(c)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	filter.add(condBookCategory, id)
+	listBooks(c, filter)
+}
+
+func respondDuplicateSlug(c *gin.Context) {
+	respondProblemWith(c, Problem{
+		Status: http.StatusConflict,
+		Code:   codeConflict,
+		Detail: "a category with this slug already exists",
+		Errors: []FieldError{{Field: "slug", Code: fieldDuplicate, Message: "already exists"}},
+	})
+}
@@ -0,0 +1,364 @@
+// Package config loads the application settings from an optional YAML or
+// TOML file, then environment variables, then <VAR>_FILE secret files
+// (Docker secrets), and validates the result once at startup.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultJWTSecret is the built-in development secret. Load refuses it
+// when Env is production.
+const DefaultJWTSecret = "my-super-secret-key-change-in-production-2024"
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+// Config is the effective configuration. Each setting has a file key
+// (section.key) and an environment variable; fields tagged secret may
+// also be read from the file named by <VAR>_FILE and are redacted in Dump.
+type Config struct {
+	Env string `key:"env" env:"APP_ENV"`
+
+	Server   Server   `key:"server"`
+	Database Database `key:"database"`
+	Auth     Auth     `key:"auth"`
+	Catalog  Catalog  `key:"catalog"`
+	Storage  Storage  `key:"storage"`
+	Pricing  Pricing  `key:"pricing"`
+	Payments Payments `key:"payments"`
+	Jobs     Jobs     `key:"jobs"`
+	Tracing  Tracing  `key:"tracing"`
+	Log      Log      `key:"log"`
+}
+
+type Server struct {
+	// Addr is host:port, or unix:/path/to.sock for a unix socket.
+	Addr              string        `key:"addr" env:"HTTP_ADDR"`
+	SocketMode        string        `key:"socket_mode" env:"HTTP_SOCKET_MODE"` // octal, เช่น "0660"
+	PublicBaseURL     string        `key:"public_base_url" env:"PUBLIC_BASE_URL"`
+	ReadTimeout       time.Duration `key:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `key:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `key:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	BulkTimeout       time.Duration `key:"bulk_timeout" env:"HTTP_BULK_TIMEOUT"` // import/export แทน read/write timeout, 0 = ไม่จำกัด
+	IdleTimeout       time.Duration `key:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	MaxHeaderBytes    int           `key:"max_header_bytes" env:"HTTP_MAX_HEADER_BYTES"`
+	ShutdownTimeout   time.Duration `key:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// ShutdownDelay keeps serving after /readyz starts failing so load
+	// balancers stop routing new requests before connections are drained.
+	ShutdownDelay     time.Duration `key:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+	HealthTimeout     time.Duration `key:"health_timeout" env:"HEALTH_CHECK_TIMEOUT"`
+	HealthCacheTTL    time.Duration `key:"health_cache_ttl" env:"HEALTH_CACHE_TTL"`
+	MetricsToken      string        `key:"metrics_token" env:"METRICS_TOKEN" secret:"true"` // ว่าง = /metrics เปิดให้ทุกคน
+	TLSCertFile       string        `key:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile        string        `key:"tls_key_file" env:"TLS_KEY_FILE"`
+	TLSReloadInterval time.Duration `key:"tls_reload_interval" env:"TLS_RELOAD_INTERVAL"`
+}
+
+type Database struct {
+	Host            string        `key:"host" env:"DB_HOST"`
+	Port            int           `key:"port" env:"DB_PORT"`
+	User            string        `key:"user" env:"DB_USER"`
+	Password        string        `key:"password" env:"DB_PASSWORD" secret:"true"`
+	Name            string        `key:"name" env:"DB_NAME"`
+	SSLMode         string        `key:"sslmode" env:"DB_SSLMODE"`
+	MaxOpenConns    int           `key:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `key:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `key:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+}
+
+type Auth struct {
+	JWTSecret       string        `key:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	AccessTokenTTL  time.Duration `key:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `key:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+	BcryptCost      int           `key:"bcrypt_cost" env:"BCRYPT_COST"`
+}
+
+type Catalog struct {
+	BookCacheTTL       time.Duration `key:"book_cache_ttl" env:"BOOK_CACHE_TTL"` // 0 = ปิด cache
+	TrashRetention     time.Duration `key:"trash_retention" env:"TRASH_RETENTION"`
+	FeaturedMinReviews int           `key:"featured_min_reviews" env:"FEATURED_MIN_REVIEWS"`
+	CoverMaxBytes      int64         `key:"cover_max_bytes" env:"COVER_MAX_BYTES"`
+	OnixSenderName     string        `key:"onix_sender_name" env:"ONIX_SENDER_NAME"`
+	GuestCartTTL       time.Duration `key:"guest_cart_ttl" env:"GUEST_CART_TTL"`
+}
+
+type Storage struct {
+	Backend     string `key:"backend" env:"BLOB_STORE"` // local | s3
+	Dir         string `key:"dir" env:"BLOB_DIR"`
+	S3Endpoint  string `key:"s3_endpoint" env:"S3_ENDPOINT"`
+	S3Region    string `key:"s3_region" env:"S3_REGION"`
+	S3Bucket    string `key:"s3_bucket" env:"S3_BUCKET"`
+	S3AccessKey string `key:"s3_access_key" env:"S3_ACCESS_KEY" secret:"true"`
+	S3SecretKey string `key:"s3_secret_key" env:"S3_SECRET_KEY" secret:"true"`
+	S3PathStyle bool   `key:"s3_path_style" env:"S3_PATH_STYLE"`
+}
+
+type Pricing struct {
+	VATRate          float64 `key:"vat_rate" env:"VAT_RATE"` // เปอร์เซ็นต์
+	PricesIncludeVAT bool    `key:"prices_include_vat" env:"PRICES_INCLUDE_VAT"`
+}
+
+type Payments struct {
+	FakeSecret             string        `key:"fake_secret" env:"PAYMENT_FAKE_SECRET" secret:"true"`
+	PromptPayID            string        `key:"promptpay_id" env:"PROMPTPAY_ID"`
+	PromptPayWebhookSecret string        `key:"promptpay_webhook_secret" env:"PROMPTPAY_WEBHOOK_SECRET" secret:"true"`
+	PromptPayQRTTL         time.Duration `key:"promptpay_qr_ttl" env:"PROMPTPAY_QR_TTL"`
+}
+
+type Jobs struct {
+	WishlistWatchInterval     time.Duration `key:"wishlist_watch_interval" env:"WISHLIST_WATCH_INTERVAL"`
+	RecommendationsInterval   time.Duration `key:"recommendations_interval" env:"RECOMMENDATIONS_INTERVAL"`
+	RecommendationsMinSupport int           `key:"recommendations_min_support" env:"RECOMMENDATIONS_MIN_SUPPORT"`
+	ReportsRefreshInterval    time.Duration `key:"reports_refresh_interval" env:"REPORTS_REFRESH_INTERVAL"`
+}
+
+// Tracing uses the standard OpenTelemetry variable names.
+type Tracing struct {
+	Exporter    string  `key:"exporter" env:"OTEL_TRACES_EXPORTER"`        // none | otlp | stdout
+	Endpoint    string  `key:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"` // OTLP/HTTP base URL; /v1/traces is appended
+	ServiceName string  `key:"service_name" env:"OTEL_SERVICE_NAME"`
+	SampleRatio float64 `key:"sample_ratio" env:"OTEL_TRACES_SAMPLER_ARG"` // ใช้กับ trace ที่ไม่มี parent
+}
+
+type Log struct {
+	Level  string `key:"level" env:"LOG_LEVEL"`   // debug | info | warn | error
+	Format string `key:"format" env:"LOG_FORMAT"` // json | text
+}
+
+// Default returns the settings used when neither the file nor the
+// environment sets a value.
+func Default() *Config {
+	return &Config{
+		Env: EnvDevelopment,
+		Server: Server{
+			Addr:              ":8080",
+			SocketMode:        "0660",
+			PublicBaseURL:     "http://localhost:8080",
+			ReadTimeout:       30 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			BulkTimeout:       30 * time.Minute,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   30 * time.Second,
+			HealthTimeout:     2 * time.Second,
+			HealthCacheTTL:    5 * time.Second,
+			TLSReloadInterval: time.Minute,
+		},
+		Database: Database{
+			Port:            5432,
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+		},
+		Auth: Auth{
+			JWTSecret:       DefaultJWTSecret,
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 7 * 24 * time.Hour,
+			BcryptCost:      12,
+		},
+		Catalog: Catalog{
+			TrashRetention:     30 * 24 * time.Hour,
+			FeaturedMinReviews: 5,
+			CoverMaxBytes:      5 << 20,
+			OnixSenderName:     "Bookstore",
+			GuestCartTTL:       30 * 24 * time.Hour,
+		},
+		Storage: Storage{
+			Backend:     "local",
+			Dir:         "data/blobs",
+			S3Endpoint:  "https://s3.amazonaws.com",
+			S3Region:    "us-east-1",
+			S3PathStyle: true,
+		},
+		Pricing: Pricing{
+			VATRate:          7,
+			PricesIncludeVAT: true,
+		},
+		Payments: Payments{
+			PromptPayQRTTL: 15 * time.Minute,
+		},
+		Jobs: Jobs{
+			WishlistWatchInterval:     15 * time.Minute,
+			RecommendationsInterval:   6 * time.Hour,
+			RecommendationsMinSupport: 2,
+			ReportsRefreshInterval:    time.Hour,
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			Endpoint:    "http://localhost:4318",
+			ServiceName: "bookstore-api",
+			SampleRatio: 1,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "json",
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the file at path (if
+// not empty), the environment and secret files, then validates it. All
+// problems found are returned together.
+func Load(path string) (*Config, error) {
+	c := Default()
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.loadEnv(); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Production reports whether the service runs in production mode.
+func (c *Config) Production() bool {
+	return c.Env == EnvProduction
+}
+
+// SocketFileMode parses Server.SocketMode. It is validated by Load.
+func (s Server) SocketFileMode() uint32 {
+	mode, _ := strconv.ParseUint(s.SocketMode, 8, 32)
+	return uint32(mode)
+}
+
+// TLS reports whether the server should serve HTTPS.
+func (s Server) TLS() bool {
+	return s.TLSCertFile != ""
+}
+
+// DSN is the lib/pq connection string.
+func (d Database) DSN() string {
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		dsnQuote(d.Host), d.Port, dsnQuote(d.User), dsnQuote(d.Password), dsnQuote(d.Name), dsnQuote(d.SSLMode))
+}
+
+// dsnQuote quotes a key=value connection string value so spaces, quotes
+// and backslashes (e.g. in passwords) survive.
+func dsnQuote(v string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// Validate checks every setting and reports each problem with the
+// environment variable that sets it.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, env, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{env}, args...)...))
+		}
+	}
+
+	check(c.Env == EnvDevelopment || c.Env == EnvProduction, "APP_ENV", "must be %s or %s", EnvDevelopment, EnvProduction)
+
+	s := c.Server
+	check(s.Addr != "" && s.Addr != "unix:", "HTTP_ADDR", "is required")
+	_, err := strconv.ParseUint(s.SocketMode, 8, 32)
+	check(err == nil, "HTTP_SOCKET_MODE", "must be an octal file mode such as 0660")
+	check(validURL(s.PublicBaseURL), "PUBLIC_BASE_URL", "must be an absolute http(s) URL")
+	check(s.ReadTimeout >= 0, "HTTP_READ_TIMEOUT", "must not be negative")
+	check(s.ReadHeaderTimeout >= 0, "HTTP_READ_HEADER_TIMEOUT", "must not be negative")
+	check(s.WriteTimeout >= 0, "HTTP_WRITE_TIMEOUT", "must not be negative")
+	check(s.BulkTimeout >= 0, "HTTP_BULK_TIMEOUT", "must not be negative")
+	check(s.IdleTimeout >= 0, "HTTP_IDLE_TIMEOUT", "must not be negative")
+	check(s.MaxHeaderBytes > 0, "HTTP_MAX_HEADER_BYTES", "must be positive")
+	check(s.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT", "must be positive")
+	check(s.ShutdownDelay >= 0, "SHUTDOWN_DELAY", "must not be negative")
+	check(s.HealthTimeout > 0, "HEALTH_CHECK_TIMEOUT", "must be positive")
+	check(s.HealthCacheTTL >= 0, "HEALTH_CACHE_TTL", "must not be negative")
+	check((s.TLSCertFile == "") == (s.TLSKeyFile == ""), "TLS_CERT_FILE", "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	check(s.TLSReloadInterval >= 0, "TLS_RELOAD_INTERVAL", "must not be negative")
+
+	d := c.Database
+	check(d.Host != "", "DB_HOST", "is required")
+	check(d.Port > 0 && d.Port < 65536, "DB_PORT", "must be a port number")
+	check(d.User != "", "DB_USER", "is required")
+	check(d.Name != "", "DB_NAME", "is required")
+	check(oneOf(d.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full"), "DB_SSLMODE", "is not a valid sslmode")
+	check(d.MaxOpenConns > 0, "DB_MAX_OPEN_CONNS", "must be positive")
+	check(d.MaxIdleConns >= 0 && d.MaxIdleConns <= d.MaxOpenConns, "DB_MAX_IDLE_CONNS", "must be between 0 and DB_MAX_OPEN_CONNS")
+	check(d.ConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME", "must not be negative")
+
+	a := c.Auth
+	check(len(a.JWTSecret) >= 32, "JWT_SECRET", "must be at least 32 bytes")
+	check(!c.Production() || a.JWTSecret != DefaultJWTSecret, "JWT_SECRET", "must be changed from the default in production")
+	check(a.AccessTokenTTL > 0, "ACCESS_TOKEN_TTL", "must be positive")
+	check(a.RefreshTokenTTL > a.AccessTokenTTL, "REFRESH_TOKEN_TTL", "must be longer than ACCESS_TOKEN_TTL")
+	check(a.BcryptCost >= 4 && a.BcryptCost <= 31, "BCRYPT_COST", "must be between 4 and 31")
+
+	cat := c.Catalog
+	check(cat.BookCacheTTL >= 0, "BOOK_CACHE_TTL", "must not be negative")
+	check(cat.TrashRetention > 0, "TRASH_RETENTION", "must be positive")
+	check(cat.FeaturedMinReviews >= 1, "FEATURED_MIN_REVIEWS", "must be at least 1")
+	check(cat.CoverMaxBytes > 0, "COVER_MAX_BYTES", "must be positive")
+	check(cat.GuestCartTTL > 0, "GUEST_CART_TTL", "must be positive")
+
+	st := c.Storage
+	switch st.Backend {
+	case "local":
+		check(st.Dir != "", "BLOB_DIR", "is required when BLOB_STORE is local")
+	case "s3":
+		check(validURL(st.S3Endpoint), "S3_ENDPOINT", "must be an absolute http(s) URL")
+		check(st.S3Bucket != "", "S3_BUCKET", "is required when BLOB_STORE is s3")
+		check(st.S3AccessKey != "" && st.S3SecretKey != "", "S3_ACCESS_KEY", "S3_ACCESS_KEY and S3_SECRET_KEY are required when BLOB_STORE is s3")
+	default:
+		check(false, "BLOB_STORE", "must be local or s3")
+	}
+
+	check(c.Pricing.VATRate >= 0 && c.Pricing.VATRate <= 100, "VAT_RATE", "must be between 0 and 100")
+	check(c.Payments.PromptPayQRTTL > 0, "PROMPTPAY_QR_TTL", "must be positive")
+	check(c.Payments.PromptPayID == "" || c.Payments.PromptPayWebhookSecret != "", "PROMPTPAY_WEBHOOK_SECRET", "is required when PROMPTPAY_ID is set")
+	check(!c.Production() || c.Payments.FakeSecret == "", "PAYMENT_FAKE_SECRET", "the fake payment provider must not be enabled in production")
+
+	j := c.Jobs
+	check(j.WishlistWatchInterval > 0, "WISHLIST_WATCH_INTERVAL", "must be positive")
+	check(j.RecommendationsInterval > 0, "RECOMMENDATIONS_INTERVAL", "must be positive")
+	// 1 จะทำให้ "also bought" เผยคำสั่งซื้อของลูกค้าคนเดียว
+	check(j.RecommendationsMinSupport >= 2, "RECOMMENDATIONS_MIN_SUPPORT", "must be at least 2")
+	check(j.ReportsRefreshInterval > 0, "REPORTS_REFRESH_INTERVAL", "must be positive")
+
+	t := c.Tracing
+	check(oneOf(t.Exporter, "none", "otlp", "stdout"), "OTEL_TRACES_EXPORTER", "must be none, otlp or stdout")
+	check(t.Exporter != "otlp" || validURL(t.Endpoint), "OTEL_EXPORTER_OTLP_ENDPOINT", "must be an absolute http(s) URL")
+	check(t.ServiceName != "", "OTEL_SERVICE_NAME", "is required")
+	check(t.SampleRatio >= 0 && t.SampleRatio <= 1, "OTEL_TRACES_SAMPLER_ARG", "must be between 0 and 1")
+
+	check(oneOf(c.Log.Level, "debug", "info", "warn", "error"), "LOG_LEVEL", "must be debug, info, warn or error")
+	check(oneOf(c.Log.Format, "json", "text"), "LOG_FORMAT", "must be json or text")
+
+	return errors.Join(errs...)
+}
+
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func oneOf(s string, values ...string) bool {
+	for _, v := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// UsesDefaultJWTSecret reports whether the built-in development secret is
+// in use, which main logs as a warning outside production.
+func (c *Config) UsesDefaultJWTSecret() bool {
+	return c.Auth.JWTSecret == DefaultJWTSecret
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Redacted replaces non-empty secrets in Dump.
+const Redacted = "[REDACTED]"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field is one setting found by walking Config with reflection.
+type field struct {
+	key    string // section.key ในไฟล์
+	env    string
+	secret bool
+	value  reflect.Value
+}
+
+// fields lists the settings of c in declaration order.
+func (c *Config) fields() []field {
+	var out []field
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			key := prefix + sf.Tag.Get("key")
+			if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+				walk(v.Field(i), key+".")
+				continue
+			}
+			out = append(out, field{
+				key:    key,
+				env:    sf.Tag.Get("env"),
+				secret: sf.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+	return out
+}
+
+// set parses s into the field according to its type.
+func (f field) set(s string) error {
+	v := f.value
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as 30s or 15m")
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Int, v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		v.SetFloat(n)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// loadFile applies a YAML (.yaml/.yml) or TOML (.toml) file. Unknown keys
+// are errors so that typos do not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	raw := map[string]any{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return fmt.Errorf("config file: unsupported format %q (use .yaml, .yml or .toml)", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	values := map[string]any{}
+	flatten(raw, "", values)
+
+	byKey := map[string]field{}
+	for _, f := range c.fields() {
+		byKey[f.key] = f
+	}
+
+	var errs []error
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f, ok := byKey[k]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown key %s", path, k))
+			continue
+		}
+		if err := f.set(fmt.Sprint(values[k])); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s %v", path, k, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flatten turns nested tables into dotted keys.
+func flatten(m map[string]any, prefix string, out map[string]any) {
+	for k, v := range m {
+		if nested, ok := v.(map[string]any); ok {
+			flatten(nested, prefix+k+".", out)
+			continue
+		}
+		out[prefix+k] = v
+	}
+}
+
+// loadEnv applies environment variables. A secret may instead be read from
+// the file named by <VAR>_FILE; setting both is an error.
+func (c *Config) loadEnv() error {
+	var errs []error
+	for _, f := range c.fields() {
+		value, fromEnv := os.LookupEnv(f.env)
+		if value == "" {
+			fromEnv = false // ค่าว่างเท่ากับไม่ได้ตั้ง เหมือน getEnv เดิม
+		}
+
+		if f.secret {
+			if path := os.Getenv(f.env + "_FILE"); path != "" {
+				if fromEnv {
+					errs = append(errs, fmt.Errorf("%s: set either %s or %s_FILE, not both", f.env, f.env, f.env))
+					continue
+				}
+				data, err := os.ReadFile(path)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s_FILE: %w", f.env, err))
+					continue
+				}
+				value, fromEnv = strings.TrimRight(string(data), "\r\n"), true
+			}
+		}
+
+		if !fromEnv {
+			continue
+		}
+		if err := f.set(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", f.env, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Dump renders the effective configuration as YAML in the file layout,
+// with secrets replaced by Redacted.
+func (c *Config) Dump() ([]byte, error) {
+	var root yaml.MapSlice
+	sections := map[string]int{}
+
+	for _, f := range c.fields() {
+		var value any
+		switch {
+		case f.secret && f.value.String() != "":
+			value = Redacted
+		case f.value.Type() == durationType:
+			value = time.Duration(f.value.Int()).String()
+		default:
+			value = f.value.Interface()
+		}
+
+		section, key, nested := strings.Cut(f.key, ".")
+		if !nested {
+			root = append(root, yaml.MapItem{Key: f.key, Value: value})
+			continue
+		}
+		i, ok := sections[section]
+		if !ok {
+			i = len(root)
+			sections[section] = i
+			root = append(root, yaml.MapItem{Key: section, Value: yaml.MapSlice{}})
+		}
+		root[i].Value = append(root[i].Value.(yaml.MapSlice), yaml.MapItem{Key: key, Value: value})
+	}
+	return yaml.Marshal(root)
+}
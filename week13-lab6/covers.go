@@ -0,0 +1,559 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // decoder สำหรับ image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"week13-lab6/blob"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Cover Images =====================
+
+// coverStore holds originals and thumbnails under covers/<book_id>/<hash>/.
+var coverStore blob.Store
+
+// publicBaseURL prefixes absolute URLs handed to clients (cover images,
+// shared wishlist links).
+var publicBaseURL string
+
+var maxCoverBytes int64 = 5 << 20
+
+// maxCoverPixels rejects decompression bombs before decoding the full image.
+const maxCoverPixels = 40_000_000
+
+const (
+	coverOriginal    = "original"
+	thumbnailQuality = 85
+)
+
+type coverSize struct {
+	Name  string
+	Width int
+}
+
+// Thumbnails are JPEG, scaled to a fixed width; smaller images are never upscaled.
+var coverSizes = []coverSize{
+	{"small", 150},
+	{"medium", 300},
+	{"large", 600},
+}
+
+// รับเฉพาะชนิดที่ decode ได้ด้วย standard library
+var coverExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+func initCovers() {
+	maxCoverBytes = cfg.Catalog.CoverMaxBytes
+	publicBaseURL = strings.TrimRight(cfg.Server.PublicBaseURL, "/")
+
+	var err error
+	st := cfg.Storage
+	switch st.Backend {
+	case "local":
+		coverStore, err = blob.NewLocal(st.Dir)
+	case "s3":
+		coverStore, err = blob.NewS3(blob.S3Config{
+			Endpoint:  st.S3Endpoint,
+			Region:    st.S3Region,
+			Bucket:    st.S3Bucket,
+			AccessKey: st.S3AccessKey,
+			SecretKey: st.S3SecretKey,
+			PathStyle: st.S3PathStyle,
+		})
+	default:
+		err = fmt.Errorf("unknown BLOB_STORE %q", st.Backend)
+	}
+	if err != nil {
+		log.Fatal("failed to initialise blob store: ", err)
+	}
+}
+
+type BookCover struct {
+	BookID      int               `json:"book_id"`
+	Hash        string            `json:"hash"`
+	ContentType string            `json:"content_type"`
+	Width       int               `json:"width"`
+	Height      int               `json:"height"`
+	SizeBytes   int64             `json:"size_bytes"`
+	URLs        map[string]string `json:"urls"`
+	UploadedBy  *int              `json:"uploaded_by,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+func coverKey(bookID int, hash, size, contentType string) string {
+	ext := ".jpg"
+	if size == coverOriginal {
+		ext = coverExtensions[contentType]
+	}
+	return fmt.Sprintf("covers/%d/%s/%s%s", bookID, hash, size, ext)
+}
+
+// coverKeys lists the original and every thumbnail of one upload.
+func coverKeys(bookID int, hash, contentType string) []string {
+	keys := []string{coverKey(bookID, hash, coverOriginal, contentType)}
+	for _, s := range coverSizes {
+		keys = append(keys, coverKey(bookID, hash, s.Name, contentType))
+	}
+	return keys
+}
+
+// URL มี hash อยู่ในตัว จึง cache ได้ถาวร (immutable)
+func coverURL(bookID int, hash, size string) string {
+	return fmt.Sprintf("%s/covers/%d/%s/%s", publicBaseURL, bookID, hash, size)
+}
+
+func (bc *BookCover) fillURLs() {
+	bc.URLs = map[string]string{coverOriginal: coverURL(bc.BookID, bc.Hash, coverOriginal)}
+	for _, s := range coverSizes {
+		bc.URLs[s.Name] = coverURL(bc.BookID, bc.Hash, s.Name)
+	}
+}
+
+// deleteCoverBlobs removes a replaced, deleted or failed upload. Keys are
+// derived from the content hash, so re-uploading the current image writes
+// the live keys; blobs the book's cover still references are kept. Failures
+// only leave orphaned objects behind, so they are logged rather than
+// returned.
+func deleteCoverBlobs(bookID int, hash, contentType string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var live bool
+	err := db.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM book_covers WHERE book_id = $1 AND hash = $2)", bookID, hash,
+	).Scan(&live)
+	if err != nil {
+		// ไม่แน่ใจว่ายังใช้อยู่หรือไม่: ปล่อยเป็น orphan ดีกว่าลบรูปที่ใช้อยู่
+		slog.Warn("error checking cover before deleting its blobs", "book_id", bookID, "hash", hash, "error", err)
+		return
+	}
+	if live {
+		return
+	}
+	for _, key := range coverKeys(bookID, hash, contentType) {
+		if err := coverStore.Delete(ctx, key); err != nil {
+			slog.Warn("error deleting cover blob", "key", key, "error", err)
+		}
+	}
+}
+
+// flattenImage draws src onto a white background, since JPEG has no alpha.
+func flattenImage(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Over)
+	return dst
+}
+
+// downscale resizes src to width using a box filter (the average of the
+// source pixels covered by each destination pixel).
+func downscale(src *image.RGBA, width int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if width >= sw {
+		return src
+	}
+	height := max(1, int(math.Round(float64(sh)*float64(width)/float64(sw))))
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, max((y+1)*sh/height, y*sh/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, max((x+1)*sw/width, x*sw/width+1)
+
+			var r, g, b, n uint32
+			for sy := y0; sy < y1; sy++ {
+				off := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[off])
+					g += uint32(src.Pix[off+1])
+					b += uint32(src.Pix[off+2])
+					n++
+					off += 4
+				}
+			}
+
+			off := dst.PixOffset(x, y)
+			dst.Pix[off] = uint8((r + n/2) / n)
+			dst.Pix[off+1] = uint8((g + n/2) / n)
+			dst.Pix[off+2] = uint8((b + n/2) / n)
+			dst.Pix[off+3] = 0xff
+		}
+	}
+	return dst
+}
+
+func encodeThumbnail(src *image.RGBA, width int) ([]byte, error) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, downscale(src, width), &jpeg.Options{Quality: thumbnailQuality})
+	return buf.Bytes(), err
+}
+
+// readCoverUpload reads the "file" form field, enforcing COVER_MAX_BYTES.
+// It writes the error response itself and returns ok=false on failure.
+func readCoverUpload(c *gin.Context) ([]byte, bool) {
+	// เผื่อ overhead ของ multipart (boundary, header ของ part)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCoverBytes+64<<10)
+
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondProblem(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge,
+				fmt.Sprintf("cover image must be at most %d bytes", maxCoverBytes))
+			return nil, false
+		}
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "file field is required")
+		return nil, false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxCoverBytes+1))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "failed to read file")
+		return nil, false
+	}
+	if int64(len(data)) > maxCoverBytes {
+		respondProblem(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge,
+			fmt.Sprintf("cover image must be at most %d bytes", maxCoverBytes))
+		return nil, false
+	}
+	if len(data) == 0 {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "file is empty")
+		return nil, false
+	}
+	return data, true
+}
+
+// uploadBookCover accepts a multipart "file" field, stores the original and
+// its thumbnails, and points books.cover_image at the original's URL.
+func uploadBookCover(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+
+	var exists bool
+	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM books WHERE id = $1 AND deleted_at IS NULL)", id).Scan(&exists)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	} else if !exists {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	}
+
+	data, ok := readCoverUpload(c)
+	if !ok {
+		return
+	}
+
+	// ดูชนิดไฟล์จากเนื้อหา ไม่เชื่อ Content-Type หรือนามสกุลที่ client ส่งมา
+	contentType := http.DetectContentType(data)
+	if _, ok := coverExtensions[contentType]; !ok {
+		respondProblemWith(c, Problem{
+			Status:     http.StatusUnsupportedMediaType,
+			Code:       codeUnsupportedMedia,
+			Detail:     fmt.Sprintf("unsupported image type %s", contentType),
+			Extensions: gin.H{"accepted": []string{"image/jpeg", "image/png", "image/gif"}},
+		})
+		return
+	}
+
+	imgCfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		respondProblem(c, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "image could not be decoded")
+		return
+	}
+	if imgCfg.Width*imgCfg.Height > maxCoverPixels {
+		respondProblem(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge,
+			fmt.Sprintf("image is %dx%d; at most %d pixels are allowed", imgCfg.Width, imgCfg.Height, maxCoverPixels))
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		respondProblem(c, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "image could not be decoded")
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	userID := c.GetInt("user_id")
+	cover := BookCover{
+		BookID:      id,
+		Hash:        hex.EncodeToString(sum[:16]),
+		ContentType: contentType,
+		Width:       imgCfg.Width,
+		Height:      imgCfg.Height,
+		SizeBytes:   int64(len(data)),
+		UploadedBy:  &userID,
+	}
+
+	// เขียน blob ก่อน แล้วค่อยชี้ database ไปหา ถ้าล้มกลางทางให้ลบของที่เขียนไปแล้ว
+	ctx := c.Request.Context()
+	cleanup := func() { deleteCoverBlobs(id, cover.Hash, contentType) }
+	if err := coverStore.Put(ctx, coverKey(id, cover.Hash, coverOriginal, contentType), bytes.NewReader(data), contentType); err != nil {
+		cleanup()
+		respondInternalError(c, err)
+		return
+	}
+	flat := flattenImage(img)
+	for _, s := range coverSizes {
+		thumb, err := encodeThumbnail(flat, s.Width)
+		if err == nil {
+			err = coverStore.Put(ctx, coverKey(id, cover.Hash, s.Name, contentType), bytes.NewReader(thumb), "image/jpeg")
+		}
+		if err != nil {
+			cleanup()
+			respondInternalError(c, err)
+			return
+		}
+	}
+
+	cover.fillURLs()
+	old, err := saveBookCover(&cover)
+	if err == sql.ErrNoRows {
+		cleanup()
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	} else if err != nil {
+		cleanup()
+		respondInternalError(c, err)
+		return
+	}
+	bookCache.invalidate(id)
+
+	if old != nil && old.Hash != cover.Hash {
+		go deleteCoverBlobs(id, old.Hash, old.ContentType)
+	}
+
+	logAudit(userID, "upload_cover", "books", id, gin.H{
+		"hash":         cover.Hash,
+		"content_type": cover.ContentType,
+		"size_bytes":   cover.SizeBytes,
+		"width":        cover.Width,
+		"height":       cover.Height,
+	}, c)
+
+	c.JSON(http.StatusOK, cover)
+}
+
+// saveBookCover records the upload and sets books.cover_image, returning
+// the cover it replaced (if any). sql.ErrNoRows means the book is gone.
+func saveBookCover(cover *BookCover) (*BookCover, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var bookID int
+	err = tx.QueryRow(
+		"SELECT id FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", cover.BookID,
+	).Scan(&bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	var old *BookCover
+	var prev BookCover
+	err = tx.QueryRow(
+		"SELECT hash, content_type FROM book_covers WHERE book_id = $1", cover.BookID,
+	).Scan(&prev.Hash, &prev.ContentType)
+	if err == nil {
+		old = &prev
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO book_covers (book_id, hash, content_type, width, height, size_bytes, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (book_id) DO UPDATE SET
+			hash = EXCLUDED.hash, content_type = EXCLUDED.content_type,
+			width = EXCLUDED.width, height = EXCLUDED.height,
+			size_bytes = EXCLUDED.size_bytes, uploaded_by = EXCLUDED.uploaded_by,
+			created_at = CURRENT_TIMESTAMP
+		RETURNING created_at`,
+		cover.BookID, cover.Hash, cover.ContentType, cover.Width, cover.Height, cover.SizeBytes, cover.UploadedBy,
+	).Scan(&cover.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE books SET cover_image = $1 WHERE id = $2", cover.URLs[coverOriginal], cover.BookID,
+	); err != nil {
+		return nil, err
+	}
+
+	return old, tx.Commit()
+}
+
+func getBookCover(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+
+	cover := BookCover{BookID: id}
+	var uploadedBy sql.NullInt64
+	err = db.QueryRow(`
+		SELECT bc.hash, bc.content_type, bc.width, bc.height, bc.size_bytes, bc.uploaded_by, bc.created_at
+		FROM book_covers bc
+		JOIN books b ON b.id = bc.book_id
+		WHERE bc.book_id = $1 AND b.deleted_at IS NULL`, id,
+	).Scan(&cover.Hash, &cover.ContentType, &cover.Width, &cover.Height, &cover.SizeBytes, &uploadedBy, &cover.CreatedAt)
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book has no uploaded cover")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if uploadedBy.Valid {
+		v := int(uploadedBy.Int64)
+		cover.UploadedBy = &v
+	}
+	cover.fillURLs()
+
+	respondCached(c, cover, cover.CreatedAt)
+}
+
+// deleteBookCover removes the uploaded cover and clears books.cover_image.
+func deleteBookCover(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var hash, contentType string
+	err = tx.QueryRow(`
+		DELETE FROM book_covers bc USING books b
+		WHERE bc.book_id = $1 AND b.id = bc.book_id AND b.deleted_at IS NULL
+		RETURNING bc.hash, bc.content_type`, id,
+	).Scan(&hash, &contentType)
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book has no uploaded cover")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// ล้างเฉพาะเมื่อยังชี้ไปที่ไฟล์ที่อัปโหลด (อาจถูกแก้เป็น URL ภายนอกแล้ว)
+	if _, err := tx.Exec(
+		"UPDATE books SET cover_image = '' WHERE id = $1 AND cover_image = $2", id, coverURL(id, hash, coverOriginal),
+	); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	bookCache.invalidate(id)
+	go deleteCoverBlobs(id, hash, contentType)
+
+	userID := c.GetInt("user_id")
+	logAudit(userID, "delete_cover", "books", id, gin.H{"hash": hash}, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "cover deleted successfully"})
+}
+
+// serveCover streams a stored image. It is public so <img> tags work
+// without a token; the hash in the URL makes each response immutable.
+func serveCover(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("book_id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+	hash, size := c.Param("hash"), c.Param("size")
+
+	known := size == coverOriginal
+	for _, s := range coverSizes {
+		known = known || s.Name == size
+	}
+	if !known {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "unknown cover size")
+		return
+	}
+
+	var contentType string
+	var createdAt time.Time
+	err = db.QueryRow(`
+		SELECT bc.content_type, bc.created_at
+		FROM book_covers bc
+		JOIN books b ON b.id = bc.book_id
+		WHERE bc.book_id = $1 AND bc.hash = $2 AND b.deleted_at IS NULL`, id, hash,
+	).Scan(&contentType, &createdAt)
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "cover not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	etag := `"` + hash + "-" + size + `"`
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", createdAt.UTC().Format(http.TimeFormat))
+	if notModified(c.Request, etag, createdAt) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	rc, info, err := coverStore.Get(c.Request.Context(), coverKey(id, hash, size, contentType))
+	if err == blob.ErrNotFound {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "cover not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rc.Close()
+
+	if size != coverOriginal {
+		contentType = "image/jpeg"
+	}
+	length := info.Size
+	if length <= 0 {
+		length = -1
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, length, contentType, rc, nil)
+}
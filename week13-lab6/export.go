@@ -0,0 +1,441 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"week13-lab6/isbn"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Catalog Export =====================
+
+const exportFetchSize = 500
+
+// bookExporter writes one format. begin/end wrap the rows so every format
+// can stream without knowing the row count up front.
+type bookExporter interface {
+	begin() error
+	write(book Book) error
+	end() error
+}
+
+type exportFormat struct {
+	contentType string
+	extension   string
+	create      func(w io.Writer) bookExporter
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv":    {"text/csv; charset=utf-8", "csv", func(w io.Writer) bookExporter { return &csvExporter{w: csv.NewWriter(w)} }},
+	"ndjson": {"application/x-ndjson", "ndjson", func(w io.Writer) bookExporter { return &ndjsonExporter{enc: json.NewEncoder(w)} }},
+	"xlsx":   {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx", func(w io.Writer) bookExporter { return &xlsxExporter{zw: zip.NewWriter(w)} }},
+	"onix":   {"application/xml; charset=utf-8", "xml", func(w io.Writer) bookExporter { return &onixExporter{w: w, enc: xml.NewEncoder(w)} }},
+}
+
+// @Summary Export books
+// @Description Stream the catalog as CSV, NDJSON, XLSX or ONIX 3.0. Accepts the same filters as GET /books.
+// @Tags Books
+// @Produce  text/csv,application/x-ndjson,application/xml
+// @Param   format  query  string  false  "csv (default), ndjson, xlsx or onix"
+// @Success 200
+// @Failure 400  {object}  Problem
+// @Router  /books/export [get]
+func exportBooks(c *gin.Context) {
+	name := strings.ToLower(c.DefaultQuery("format", "csv"))
+	format, ok := exportFormats[name]
+	if !ok {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "format must be csv, ndjson, xlsx or onix")
+		return
+	}
+
+	filter, err := parseBookFilter(c)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	// ใช้ server-side cursor ดึงทีละ exportFetchSize แถว หน่วยความจำจึงคงที่
+	tx, err := db.BeginTx(c.Request.Context(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "error starting export", "error", err)
+		respondProblem(c, http.StatusInternalServerError, codeInternal, "")
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DECLARE export_cursor NO SCROLL CURSOR FOR SELECT "+bookColumns+" FROM books"+filter.where()+" ORDER BY id", filter.args...)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "error declaring export cursor", "error", err)
+		respondProblem(c, http.StatusInternalServerError, codeInternal, "")
+		return
+	}
+
+	filename := fmt.Sprintf("books-%s.%s", time.Now().Format("20060102"), format.extension)
+	c.Header("Content-Type", format.contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Vary", "Accept-Encoding")
+
+	var out io.Writer = c.Writer
+	if strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		c.Header("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(c.Writer)
+		defer gz.Close()
+		out = gz
+	}
+	c.Status(http.StatusOK)
+
+	exporter := format.create(out)
+	if err := exporter.begin(); err != nil {
+		slog.ErrorContext(c.Request.Context(), "error writing export", "error", err)
+		return
+	}
+
+	exported := 0
+	for {
+		rows, err := tx.Query(fmt.Sprintf("FETCH %d FROM export_cursor", exportFetchSize))
+		if err != nil {
+			// header ถูกส่งไปแล้ว ทำได้แค่ตัดการเชื่อมต่อ
+			slog.ErrorContext(c.Request.Context(), "error fetching export rows", "error", err)
+			return
+		}
+
+		fetched := 0
+		for rows.Next() {
+			book, err := scanBook(rows)
+			if err == nil {
+				err = exporter.write(book)
+			}
+			if err != nil {
+				rows.Close()
+				slog.ErrorContext(c.Request.Context(), "error writing export", "error", err)
+				return
+			}
+			fetched++
+		}
+		rows.Close()
+
+		exported += fetched
+		if fetched < exportFetchSize {
+			break
+		}
+	}
+
+	if err := exporter.end(); err != nil {
+		slog.ErrorContext(c.Request.Context(), "error finishing export", "error", err)
+		return
+	}
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "export", "books", nil, gin.H{
+		"format": name,
+		"rows":   exported,
+	}, c)
+}
+
+// ---------- CSV ----------
+
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvExporter) begin() error {
+	return e.w.Write([]string{"id", "title", "author", "isbn", "year", "price", "status", "published_at", "created_at", "updated_at"})
+}
+
+func (e *csvExporter) write(b Book) error {
+	publishedAt := ""
+	if b.PublishedAt != nil {
+		publishedAt = b.PublishedAt.Format(time.RFC3339)
+	}
+	err := e.w.Write(csvSafeRecord([]string{
+		strconv.Itoa(b.ID), b.Title, b.Author, b.ISBN, strconv.Itoa(b.Year),
+		strconv.FormatFloat(b.Price, 'f', 2, 64), b.Status, publishedAt,
+		b.CreatedAt.Format(time.RFC3339), b.UpdatedAt.Format(time.RFC3339),
+	}))
+	if err != nil {
+		return err
+	}
+	// flush ทุกแถวเพื่อให้ข้อมูลไหลออกไปทันที ไม่ค้างใน buffer
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExporter) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// csvSafeCell stops spreadsheets from running a cell as a formula (CSV
+// injection): text starting with =, +, -, @, tab or CR gets a leading
+// apostrophe. Plain numbers such as "-5.00" are left as they are.
+func csvSafeCell(s string) string {
+	if s == "" || !strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return s
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return s
+	}
+	return "'" + s
+}
+
+// csvSafeRecord applies csvSafeCell to every field of a CSV row, in place.
+func csvSafeRecord(record []string) []string {
+	for i, s := range record {
+		record[i] = csvSafeCell(s)
+	}
+	return record
+}
+
+// ---------- NDJSON ----------
+
+type ndjsonExporter struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExporter) begin() error       { return nil }
+func (e *ndjsonExporter) write(b Book) error { return e.enc.Encode(b) }
+func (e *ndjsonExporter) end() error         { return nil }
+
+// ---------- XLSX ----------
+
+// xlsxExporter writes a minimal single-sheet workbook. The worksheet is the
+// last zip entry so rows can be streamed straight into it.
+type xlsxExporter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	row   int
+}
+
+var xlsxStaticParts = []struct{ name, body string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Books" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+func (e *xlsxExporter) begin() error {
+	for _, part := range xlsxStaticParts {
+		w, err := e.zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, part.body); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := e.zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	e.sheet = sheet
+
+	if _, err := io.WriteString(e.sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return err
+	}
+	return e.writeRow("ID", "Title", "Author", "ISBN", "Year", "Price", "Status", "Created At")
+}
+
+func (e *xlsxExporter) write(b Book) error {
+	return e.writeRow(b.ID, b.Title, b.Author, b.ISBN, b.Year, b.Price, b.Status, b.CreatedAt.Format("2006-01-02 15:04:05"))
+}
+
+func (e *xlsxExporter) writeRow(cells ...interface{}) error {
+	e.row++
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<row r="%d">`, e.row)
+	for _, cell := range cells {
+		switch v := cell.(type) {
+		case int:
+			fmt.Fprintf(&sb, `<c><v>%d</v></c>`, v)
+		case float64:
+			fmt.Fprintf(&sb, `<c><v>%s</v></c>`, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			sb.WriteString(`<c t="inlineStr"><is><t>`)
+			xml.EscapeText(&sb, []byte(fmt.Sprint(v)))
+			sb.WriteString(`</t></is></c>`)
+		}
+	}
+	sb.WriteString(`</row>`)
+	_, err := io.WriteString(e.sheet, sb.String())
+	return err
+}
+
+func (e *xlsxExporter) end() error {
+	if _, err := io.WriteString(e.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return e.zw.Close()
+}
+
+// ---------- ONIX 3.0 ----------
+
+type onixExporter struct {
+	w   io.Writer
+	enc *xml.Encoder
+}
+
+type onixProductIdentifier struct {
+	ProductIDType string `xml:"ProductIDType"`
+	IDTypeName    string `xml:"IDTypeName,omitempty"`
+	IDValue       string `xml:"IDValue"`
+}
+
+type onixContributor struct {
+	SequenceNumber  int    `xml:"SequenceNumber"`
+	ContributorRole string `xml:"ContributorRole"`
+	PersonName      string `xml:"PersonName"`
+}
+
+type onixPublishingDate struct {
+	PublishingDateRole string `xml:"PublishingDateRole"`
+	Date               struct {
+		Format string `xml:"dateformat,attr"`
+		Value  string `xml:",chardata"`
+	} `xml:"Date"`
+}
+
+type onixProduct struct {
+	XMLName            xml.Name                `xml:"Product"`
+	RecordReference    string                  `xml:"RecordReference"`
+	NotificationType   string                  `xml:"NotificationType"`
+	ProductIdentifiers []onixProductIdentifier `xml:"ProductIdentifier"`
+	DescriptiveDetail  struct {
+		ProductComposition string `xml:"ProductComposition"`
+		ProductForm        string `xml:"ProductForm"`
+		TitleDetail        struct {
+			TitleType    string `xml:"TitleType"`
+			TitleElement struct {
+				TitleElementLevel string `xml:"TitleElementLevel"`
+				TitleText         string `xml:"TitleText"`
+			} `xml:"TitleElement"`
+		} `xml:"TitleDetail"`
+		Contributors  []onixContributor `xml:"Contributor"`
+		NoContributor *struct{}         `xml:"NoContributor"`
+	} `xml:"DescriptiveDetail"`
+	PublishingDetail struct {
+		PublishingStatus string              `xml:"PublishingStatus"`
+		PublishingDate   *onixPublishingDate `xml:"PublishingDate"`
+	} `xml:"PublishingDetail"`
+	ProductSupply struct {
+		SupplyDetail struct {
+			Supplier struct {
+				SupplierRole string `xml:"SupplierRole"`
+				SupplierName string `xml:"SupplierName"`
+			} `xml:"Supplier"`
+			ProductAvailability string `xml:"ProductAvailability"`
+			Price               struct {
+				PriceType    string `xml:"PriceType"`
+				PriceAmount  string `xml:"PriceAmount"`
+				CurrencyCode string `xml:"CurrencyCode"`
+			} `xml:"Price"`
+		} `xml:"SupplyDetail"`
+	} `xml:"ProductSupply"`
+}
+
+func onixSenderName() string {
+	return cfg.Catalog.OnixSenderName
+}
+
+func (e *onixExporter) begin() error {
+	_, err := fmt.Fprintf(e.w, `<?xml version="1.0" encoding="UTF-8"?>
+<ONIXMessage release="3.0" xmlns="http://ns.editeur.org/onix/3.0/reference">
+<Header><Sender><SenderName>%s</SenderName></Sender><SentDateTime>%s</SentDateTime></Header>
+`, xmlEscape(onixSenderName()), time.Now().UTC().Format("20060102T1504Z"))
+	return err
+}
+
+func (e *onixExporter) write(b Book) error {
+	var p onixProduct
+	p.RecordReference = fmt.Sprintf("bookstore-book-%d", b.ID)
+	p.NotificationType = "03" // 03 = confirmed record
+
+	p.ProductIdentifiers = append(p.ProductIdentifiers, onixProductIdentifier{
+		ProductIDType: "01", IDTypeName: "Bookstore ID", IDValue: strconv.Itoa(b.ID),
+	})
+	if isbn13, err := isbn.To13(b.ISBN); err == nil {
+		p.ProductIdentifiers = append(p.ProductIdentifiers, onixProductIdentifier{ProductIDType: "15", IDValue: isbn13})
+	}
+
+	d := &p.DescriptiveDetail
+	d.ProductComposition = "00" // single-item retail product
+	d.ProductForm = "BA"        // book
+	d.TitleDetail.TitleType = "01"
+	d.TitleDetail.TitleElement.TitleElementLevel = "01"
+	d.TitleDetail.TitleElement.TitleText = b.Title
+	if b.Author != "" {
+		d.Contributors = []onixContributor{{SequenceNumber: 1, ContributorRole: "A01", PersonName: b.Author}}
+	} else {
+		d.NoContributor = &struct{}{}
+	}
+
+	publishingStatus, availability := onixSupplyCodes(b)
+	p.PublishingDetail.PublishingStatus = publishingStatus
+	if b.Year > 0 {
+		date := &onixPublishingDate{PublishingDateRole: "01"} // publication date
+		date.Date.Format = "05"                               // YYYY
+		date.Date.Value = strconv.Itoa(b.Year)
+		p.PublishingDetail.PublishingDate = date
+	}
+
+	s := &p.ProductSupply.SupplyDetail
+	s.Supplier.SupplierRole = "01"
+	s.Supplier.SupplierName = onixSenderName()
+	s.ProductAvailability = availability
+	s.Price.PriceType = "02" // RRP including tax
+	s.Price.PriceAmount = strconv.FormatFloat(b.Price, 'f', 2, 64)
+	s.Price.CurrencyCode = "THB"
+
+	if err := e.enc.Encode(p); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.w, "\n")
+	return err
+}
+
+// onixSupplyCodes maps the book's workflow status and stock to ONIX
+// PublishingStatus (code list 64) and ProductAvailability (list 65), since
+// staff may export drafts and archived books too.
+func onixSupplyCodes(b Book) (publishingStatus, availability string) {
+	switch b.Status {
+	case statusPublished:
+		if b.InStock {
+			return "04", "21" // active, in stock
+		}
+		return "04", "31" // active, out of stock
+	case statusArchived:
+		return "11", "46" // withdrawn from sale
+	default:
+		return "02", "10" // draft/in_review: forthcoming, not yet available
+	}
+}
+
+func (e *onixExporter) end() error {
+	_, err := io.WriteString(e.w, "</ONIXMessage>\n")
+	return err
+}
+
+func xmlEscape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
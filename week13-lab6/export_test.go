@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestOnixSupplyCodes(t *testing.T) {
+	tests := []struct {
+		status           string
+		inStock          bool
+		publishingStatus string
+		availability     string
+	}{
+		{statusPublished, true, "04", "21"},
+		{statusPublished, false, "04", "31"},
+		{statusDraft, true, "02", "10"},
+		{statusInReview, false, "02", "10"},
+		{statusArchived, true, "11", "46"},
+	}
+	for _, tt := range tests {
+		ps, av := onixSupplyCodes(Book{Status: tt.status, InStock: tt.inStock})
+		if ps != tt.publishingStatus || av != tt.availability {
+			t.Errorf("onixSupplyCodes(%s, in_stock=%t) = %s, %s; want %s, %s",
+				tt.status, tt.inStock, ps, av, tt.publishingStatus, tt.availability)
+		}
+	}
+}
+
+func TestCSVSafeCell(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"Clean Code", "Clean Code"},
+		{"=HYPERLINK(\"http://x\",\"y\")", "'=HYPERLINK(\"http://x\",\"y\")"},
+		{"+cmd|' /C calc'!A0", "'+cmd|' /C calc'!A0"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1:A2)", "'@SUM(A1:A2)"},
+		{"\t=1+1", "'\t=1+1"},
+		{"\r=1+1", "'\r=1+1"},
+		{"-5.00", "-5.00"},
+		{"+66", "+66"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		if got := csvSafeCell(tt.in); got != tt.want {
+			t.Errorf("csvSafeCell(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"week13-lab6/isbn"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Book Listing Filters =====================
+
+// bookFilter builds the WHERE clause shared by the listing and the export,
+// so both accept exactly the same query parameters.
+type bookFilter struct {
+	conditions []string
+	args       []interface{}
+}
+
+// เงื่อนไขของ endpoint "books by author/publisher/category"
+const (
+	condBookAuthor    = "id IN (SELECT book_id FROM book_authors WHERE author_id = ?)"
+	condBookPublisher = "publisher_id = ?"
+	// รวมหมวดย่อยทุกชั้น
+	condBookCategory = `category_id IN (
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM categories WHERE id = ?
+			UNION ALL
+			SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+		)
+		SELECT id FROM subtree)`
+)
+
+func (f *bookFilter) add(condition string, arg interface{}) {
+	f.args = append(f.args, arg)
+	f.conditions = append(f.conditions, strings.ReplaceAll(condition, "?", fmt.Sprintf("$%d", len(f.args))))
+}
+
+func (f *bookFilter) where() string {
+	return " WHERE " + strings.Join(f.conditions, " AND ")
+}
+
+// parseBookFilter reads q, author, isbn, author_id, publisher_id,
+// category_id, year_from, year_to, min_price, max_price, in_stock and
+// (staff only) status from the query string.
+func parseBookFilter(c *gin.Context) (*bookFilter, error) {
+	f := &bookFilter{conditions: []string{"deleted_at IS NULL"}}
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		f.add("(title ILIKE '%' || ? || '%' OR author ILIKE '%' || ? || '%')", q)
+	}
+	if author := strings.TrimSpace(c.Query("author")); author != "" {
+		f.add("author ILIKE '%' || ? || '%'", author)
+	}
+	if raw := strings.TrimSpace(c.Query("isbn")); raw != "" {
+		normalized, err := isbn.Normalize(raw)
+		if err != nil {
+			return nil, fmt.Errorf("isbn: %v", err)
+		}
+		f.add("isbn = ?", normalized)
+	}
+
+	intParams := []struct{ name, cond string }{
+		{"author_id", condBookAuthor},
+		{"publisher_id", condBookPublisher},
+		{"category_id", condBookCategory},
+		{"year_from", "year >= ?"},
+		{"year_to", "year <= ?"},
+	}
+	for _, p := range intParams {
+		if v := c.Query(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an integer", p.name)
+			}
+			f.add(p.cond, n)
+		}
+	}
+
+	priceParams := []struct{ name, cond string }{
+		{"min_price", "price >= ?"},
+		{"max_price", "price <= ?"},
+	}
+	for _, p := range priceParams {
+		if v := c.Query(p.name); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a number", p.name)
+			}
+			f.add(p.cond, n)
+		}
+	}
+
+	if v := c.Query("in_stock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("in_stock must be true or false")
+		}
+		f.add("EXISTS (SELECT 1 FROM stock WHERE stock.book_id = books.id AND stock.on_hand > stock.reserved) = ?", inStock)
+	}
+
+	// ลูกค้าทั่วไปเห็นเฉพาะ published เสมอ staff เลือก status ได้
+	if canSeeUnpublished(c) {
+		if status := c.Query("status"); status != "" {
+			f.add("status = ?", status)
+		}
+	} else {
+		f.add("status = ?", statusPublished)
+	}
+
+	return f, nil
+}
+
+// parsePage reads limit and offset, applying def when limit is absent and
+// capping it at max.
+func parsePage(c *gin.Context, def, max int) (limit, offset int, err error) {
+	limit = def
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("limit must be a positive integer")
+		}
+		if limit > max {
+			limit = max
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"week13-lab6/blob"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ===================== Health Checks =====================
+
+// healthCheck is one named dependency check. Results are cached for
+// HEALTH_CACHE_TTL so frequent probes do not hammer the dependency, and
+// each run is bounded by HEALTH_CHECK_TIMEOUT.
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+
+	mu     sync.Mutex // ให้ probe ที่มาพร้อมกันรอผลเดียวกัน
+	result HealthResult
+}
+
+type HealthResult struct {
+	Name       string    `json:"name"`
+	Status     string    `json:"status"` // ok | fail
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+type HealthReport struct {
+	Status string         `json:"status"` // ok | fail | shutting_down
+	Checks []HealthResult `json:"checks,omitempty"`
+}
+
+var healthChecks []*healthCheck
+
+// shuttingDown is set by runServer on SIGINT/SIGTERM so /readyz fails
+// while in-flight requests drain.
+var shuttingDown atomic.Bool
+
+func registerHealthCheck(name string, check func(ctx context.Context) error) {
+	healthChecks = append(healthChecks, &healthCheck{name: name, check: check})
+}
+
+func (h *healthCheck) run() HealthResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.result.CheckedAt.IsZero() && time.Since(h.result.CheckedAt) < cfg.Server.HealthCacheTTL {
+		return h.result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.HealthTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := h.check(ctx)
+	h.result = HealthResult{
+		Name:       h.name,
+		Status:     "ok",
+		DurationMS: time.Since(start).Milliseconds(),
+		CheckedAt:  start,
+	}
+	if err != nil {
+		h.result.Status = "fail"
+		h.result.Error = err.Error()
+		slog.Warn("health check failed", "check", h.name, "error", err)
+	}
+	return h.result
+}
+
+// runHealthChecks runs every check concurrently.
+func runHealthChecks() HealthReport {
+	report := HealthReport{Status: "ok", Checks: make([]HealthResult, len(healthChecks))}
+
+	var wg sync.WaitGroup
+	for i, h := range healthChecks {
+		wg.Add(1)
+		go func(i int, h *healthCheck) {
+			defer wg.Done()
+			report.Checks[i] = h.run()
+		}(i, h)
+	}
+	wg.Wait()
+
+	for _, r := range report.Checks {
+		if r.Status != "ok" {
+			report.Status = "fail"
+		}
+	}
+	return report
+}
+
+// initHealthChecks registers the dependency checks behind /readyz.
+func initHealthChecks() {
+	registerHealthCheck("database", func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+
+	expected, err := latestMigration()
+	if err != nil {
+		log.Fatal("failed to read embedded migrations: ", err)
+	}
+	registerHealthCheck("migrations", func(ctx context.Context) error {
+		return checkMigrations(ctx, expected)
+	})
+
+	registerHealthCheck("blob_store", func(ctx context.Context) error {
+		// อ่าน key ที่ไม่มีอยู่จริง: ErrNotFound แปลว่าเข้าถึง store ได้
+		r, _, err := coverStore.Get(ctx, "health/probe")
+		if errors.Is(err, blob.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return r.Close()
+	})
+}
+
+// ===================== Schema Version =====================
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationHeader = regexp.MustCompile(`^--\s*(\d+)\.`)
+
+// latestMigration returns the highest "-- N." header among the migrations
+// built into the binary.
+func latestMigration() (int, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return 0, err
+	}
+
+	latest := 0
+	for _, name := range files {
+		f, err := migrationFiles.Open(name)
+		if err != nil {
+			return 0, err
+		}
+		sc := bufio.NewScanner(f)
+		if sc.Scan() {
+			if m := migrationHeader.FindStringSubmatch(sc.Text()); m != nil {
+				if n, _ := strconv.Atoi(m[1]); n > latest {
+					latest = n
+				}
+			}
+		}
+		f.Close()
+	}
+	return latest, nil
+}
+
+func isUndefinedTable(err error) bool {
+	if pqErr, ok := err.(*pq.Error); ok {
+		return pqErr.Code == "42P01"
+	}
+	return false
+}
+
+// checkMigrations fails when the database is behind the migrations this
+// binary was built with. A newer database is fine (rolling deploys).
+func checkMigrations(ctx context.Context, expected int) error {
+	var applied int
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&applied)
+	if isUndefinedTable(err) {
+		return fmt.Errorf("schema_migrations table missing: migrations up to %d are pending", expected)
+	}
+	if err != nil {
+		return err
+	}
+	if applied < expected {
+		return fmt.Errorf("%d pending migration(s): database at %d, expected %d", expected-applied, applied, expected)
+	}
+	return nil
+}
+
+// ===================== Health Endpoints =====================
+
+// livez reports that the process is up and serving. It does not check
+// dependencies, so a database outage does not get the container restarted.
+func livez(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthReport{Status: "ok"})
+}
+
+// readyz runs the dependency checks. Only callers with health:read see
+// each check's result; everyone else gets the overall status.
+func readyz(c *gin.Context) {
+	if shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, HealthReport{Status: "shutting_down"})
+		return
+	}
+
+	report := runHealthChecks()
+	status := http.StatusOK
+	if report.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+
+	if userID, ok := c.Get("user_id"); !ok || !checkUserPermission(c.Request.Context(), userID.(int), "health:read") {
+		report.Checks = nil
+	}
+	c.JSON(status, report)
+}
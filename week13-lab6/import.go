@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"week13-lab6/isbn"
+	"week13-lab6/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ===================== Bulk Import =====================
+
+const (
+	importBatchSize = 500
+	importMaxErrors = 1000
+	minBookYear     = 1450 // ก่อนมีแท่นพิมพ์ของ Gutenberg ถือว่าผิด
+	maxBookTextLen  = 255  // books.title / books.author VARCHAR(255)
+)
+
+// maxImportPrice is the first value books.price DECIMAL(10,2) cannot hold.
+var maxImportPrice = big.NewRat(100_000_000, 1)
+
+type ImportOptions struct {
+	Format  string // "csv" หรือ "ndjson"
+	DryRun  bool
+	Publish bool
+	// Update overwrites books whose ISBN already exists. Without it those
+	// rows are reported as errors, so books:create alone cannot modify
+	// existing books.
+	Update bool
+}
+
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	ISBN    string `json:"isbn,omitempty"`
+	Message string `json:"message"`
+}
+
+type ImportReport struct {
+	Format    string           `json:"format"`
+	DryRun    bool             `json:"dry_run"`
+	TotalRows int              `json:"total_rows"`
+	ValidRows int              `json:"valid_rows"`
+	Inserted  int              `json:"inserted"`
+	Updated   int              `json:"updated"`
+	Failed    int              `json:"failed"`
+	Errors    []ImportRowError `json:"errors"`
+	Truncated bool             `json:"errors_truncated,omitempty"`
+}
+
+func (r *ImportReport) addErrors(errs ...ImportRowError) {
+	r.Failed++
+	for _, e := range errs {
+		if len(r.Errors) >= importMaxErrors {
+			r.Truncated = true
+			return
+		}
+		r.Errors = append(r.Errors, e)
+	}
+}
+
+// importFileError means the file itself is unreadable (bad header, broken
+// JSON), as opposed to a database failure.
+type importFileError struct {
+	Line int
+	Err  error
+}
+
+func (e *importFileError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *importFileError) Unwrap() error { return e.Err }
+
+type importRow struct {
+	line   int
+	title  string
+	author string
+	isbn   string
+	year   int
+	price  float64
+}
+
+// rowSource yields raw rows one at a time so large files are never held in
+// memory. A *rowParseError skips the row; any other error stops the import.
+type rowSource func() (line int, fields map[string]string, err error)
+
+type rowParseError struct {
+	msg string
+}
+
+func (e *rowParseError) Error() string { return e.msg }
+
+// importBooks streams rows from r, validates them and inserts valid rows
+// (upserting by ISBN when opts.Update is set) in batches inside one
+// transaction. Dry runs roll the transaction back.
+func importBooks(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportReport, error) {
+	next, err := newRowSource(r, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{Format: opts.Format, DryRun: opts.DryRun, Errors: []ImportRowError{}}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	status := statusDraft
+	if opts.Publish {
+		status = statusPublished
+	}
+
+	batch := make([]importRow, 0, importBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		inserted, updated, existing, err := upsertBookBatch(ctx, tx, batch, status, opts.Update)
+		if err != nil {
+			return err
+		}
+		report.Inserted += inserted
+		report.Updated += updated
+		for _, r := range existing {
+			report.ValidRows--
+			report.addErrors(ImportRowError{
+				Row:     r.line,
+				Field:   "isbn",
+				ISBN:    r.isbn,
+				Message: "a book with this ISBN already exists; enable update to overwrite it",
+			})
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		line, fields, err := next()
+		if err == io.EOF {
+			break
+		}
+		if perr, ok := err.(*rowParseError); ok {
+			// แถวที่ parse ไม่ได้ รายงานแล้วข้ามไป
+			report.TotalRows++
+			report.addErrors(ImportRowError{Row: line, Message: perr.msg})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		report.TotalRows++
+		row, rowErrs := validateImportRow(line, fields)
+		if len(rowErrs) > 0 {
+			report.addErrors(rowErrs...)
+			continue
+		}
+
+		report.ValidRows++
+		batch = append(batch, row)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	bookCache.reset()
+
+	return report, nil
+}
+
+func newRowSource(r io.Reader, format string) (rowSource, error) {
+	switch format {
+	case "csv":
+		reader := csv.NewReader(r)
+		reader.TrimLeadingSpace = true
+		reader.ReuseRecord = true
+
+		header, err := reader.Read()
+		if err != nil {
+			return nil, &importFileError{Line: 1, Err: fmt.Errorf("failed to read CSV header: %w", err)}
+		}
+		columns := make([]string, len(header))
+		for i, h := range header {
+			columns[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		}
+
+		return func() (int, map[string]string, error) {
+			record, err := reader.Read()
+			if perr, ok := err.(*csv.ParseError); ok {
+				return perr.StartLine, nil, &rowParseError{msg: perr.Err.Error()}
+			} else if err != nil {
+				return 0, nil, err
+			}
+			line, _ := reader.FieldPos(0)
+			fields := make(map[string]string, len(columns))
+			for i, col := range columns {
+				if i < len(record) {
+					fields[col] = strings.TrimSpace(record[i])
+				}
+			}
+			return line, fields, nil
+		}, nil
+
+	case "ndjson":
+		decoder := json.NewDecoder(r)
+		line := 0
+		return func() (int, map[string]string, error) {
+			line++
+			var raw map[string]interface{}
+			if err := decoder.Decode(&raw); err != nil {
+				if err == io.EOF {
+					return line, nil, io.EOF
+				}
+				if _, ok := err.(*json.UnmarshalTypeError); ok {
+					// ค่าเป็น JSON ที่ถูกต้องแต่ไม่ใช่ object ข้ามไปได้
+					return line, nil, &rowParseError{msg: "row must be a JSON object"}
+				}
+				// JSON เสียแล้ว decoder อ่านต่อไม่ได้ หยุดที่บรรทัดนี้
+				return line, nil, &importFileError{Line: line, Err: err}
+			}
+			fields := make(map[string]string, len(raw))
+			for k, v := range raw {
+				if v == nil {
+					continue
+				}
+				fields[strings.ToLower(k)] = strings.TrimSpace(fmt.Sprint(v))
+			}
+			return line, fields, nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported import format %q", format)
+}
+
+func validateImportRow(line int, fields map[string]string) (importRow, []ImportRowError) {
+	row := importRow{
+		line:   line,
+		title:  fields["title"],
+		author: fields["author"],
+		isbn:   fields["isbn"],
+	}
+	var errs []ImportRowError
+	fail := func(field, msg string) {
+		errs = append(errs, ImportRowError{Row: line, Field: field, ISBN: row.isbn, Message: msg})
+	}
+
+	if row.title == "" {
+		fail("title", "title is required")
+	} else if utf8.RuneCountInString(row.title) > maxBookTextLen {
+		fail("title", fmt.Sprintf("title must be at most %d characters", maxBookTextLen))
+	}
+	if utf8.RuneCountInString(row.author) > maxBookTextLen {
+		fail("author", fmt.Sprintf("author must be at most %d characters", maxBookTextLen))
+	}
+
+	if row.isbn == "" {
+		fail("isbn", "isbn is required")
+	} else if normalized, err := isbn.Normalize(row.isbn); err != nil {
+		fail("isbn", err.Error())
+	} else {
+		row.isbn = normalized
+	}
+
+	maxYear := time.Now().Year() + 1
+	if year, err := strconv.Atoi(fields["year"]); err != nil {
+		fail("year", "year must be an integer")
+	} else if year < minBookYear || year > maxYear {
+		fail("year", fmt.Sprintf("year must be between %d and %d", minBookYear, maxYear))
+	} else {
+		row.year = year
+	}
+
+	// ตรวจตามขอบเขตของ books.price DECIMAL(10,2) ให้เป็น error รายแถว แทนที่จะทำให้ทั้ง transaction ล้ม
+	if price, err := money.ParseDecimal(fields["price"]); err != nil {
+		fail("price", "price must be a number")
+	} else if price.Sign() < 0 {
+		fail("price", "price must not be negative")
+	} else if price.Cmp(maxImportPrice) >= 0 {
+		fail("price", "price must be less than 100000000")
+	} else if !new(big.Rat).Mul(price, big.NewRat(100, 1)).IsInt() {
+		fail("price", "price must have at most 2 decimal places")
+	} else {
+		row.price, _ = price.Float64()
+	}
+
+	return row, errs
+}
+
+// upsertBookBatch inserts books whose ISBN is new. Books that already exist
+// by ISBN are updated when update is set, otherwise they are left alone
+// and their rows returned in existing.
+func upsertBookBatch(ctx context.Context, tx *sql.Tx, batch []importRow, status string, update bool) (inserted, updated int, existing []importRow, err error) {
+	// ISBN ซ้ำใน batch เดียวกัน ใช้แถวหลังสุด
+	index := make(map[string]int, len(batch))
+	rows := make([]importRow, 0, len(batch))
+	for _, r := range batch {
+		if i, ok := index[r.isbn]; ok {
+			rows[i] = r
+			continue
+		}
+		index[r.isbn] = len(rows)
+		rows = append(rows, r)
+	}
+
+	titles := make([]string, len(rows))
+	authors := make([]string, len(rows))
+	isbns := make([]string, len(rows))
+	years := make([]int64, len(rows))
+	prices := make([]float64, len(rows))
+	for i, r := range rows {
+		titles[i], authors[i], isbns[i], years[i], prices[i] = r.title, r.author, r.isbn, int64(r.year), r.price
+	}
+
+	const input = `
+		WITH input AS (
+			SELECT * FROM unnest($1::text[], $2::text[], $3::text[], $4::int[], $5::numeric[])
+				AS t(title, author, isbn, year, price)
+		)`
+
+	if update {
+		res, err := tx.ExecContext(ctx, input+`
+			UPDATE books b
+			SET title = i.title, author = i.author, year = i.year, price = i.price
+			FROM input i
+			WHERE b.isbn = i.isbn AND b.deleted_at IS NULL`,
+			pq.Array(titles), pq.Array(authors), pq.Array(isbns), pq.Array(years), pq.Array(prices),
+		)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		n, _ := res.RowsAffected()
+		updated = int(n)
+	} else {
+		found, err := tx.QueryContext(ctx,
+			"SELECT isbn FROM books WHERE isbn = ANY($1) AND deleted_at IS NULL", pq.Array(isbns),
+		)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		taken := make(map[string]bool)
+		for found.Next() {
+			var isbn string
+			if err := found.Scan(&isbn); err != nil {
+				found.Close()
+				return 0, 0, nil, err
+			}
+			taken[isbn] = true
+		}
+		found.Close()
+		if err := found.Err(); err != nil {
+			return 0, 0, nil, err
+		}
+		for _, r := range batch {
+			if taken[r.isbn] {
+				existing = append(existing, r)
+			}
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, input+`
+		INSERT INTO books (title, author, isbn, year, price, status, published_at)
+		SELECT i.title, i.author, i.isbn, i.year, i.price, $6,
+			CASE WHEN $6 = 'published' THEN NOW() END
+		FROM input i
+		WHERE NOT EXISTS (
+			SELECT 1 FROM books b WHERE b.isbn = i.isbn AND b.deleted_at IS NULL
+		)`,
+		pq.Array(titles), pq.Array(authors), pq.Array(isbns), pq.Array(years), pq.Array(prices), status,
+	)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	n, _ := res.RowsAffected()
+	inserted = int(n)
+
+	// แยกผู้แต่งจาก author text เข้า book_authors แบบเดียวกับ migration
+	_, err = tx.ExecContext(ctx,
+		"SELECT sync_book_authors(id) FROM books WHERE isbn = ANY($1) AND deleted_at IS NULL",
+		pq.Array(isbns),
+	)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	return inserted, updated, existing, nil
+}
+
+// detectImportFormat picks the format from ?format=, then the content type, then the file name.
+func detectImportFormat(explicit, contentType, filename string) string {
+	if explicit != "" {
+		return strings.ToLower(explicit)
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch mediaType {
+		case "text/csv", "application/csv":
+			return "csv"
+		case "application/x-ndjson", "application/ndjson", "application/jsonl":
+			return "ndjson"
+		}
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return "csv"
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	}
+	return ""
+}
+
+func importBooksHandler(c *gin.Context) {
+	opts := ImportOptions{
+		DryRun:  c.Query("dry_run") == "true",
+		Publish: c.Query("publish") == "true",
+		Update:  c.Query("update") == "true",
+	}
+
+	// route ต้องมี books:create อยู่แล้ว การเขียนทับเล่มเดิมต้องมี books:update ด้วย
+	if opts.Update && !checkUserPermission(c.Request.Context(), c.GetInt("user_id"), "books:update") {
+		respondProblemWith(c, Problem{
+			Status:     http.StatusForbidden,
+			Code:       codeForbidden,
+			Detail:     "updating existing books on import requires books:update",
+			Extensions: gin.H{"required": "books:update"},
+		})
+		return
+	}
+
+	if opts.Publish && !checkUserPermission(c.Request.Context(), c.GetInt("user_id"), "books:publish") {
+		respondProblemWith(c, Problem{
+			Status:     http.StatusForbidden,
+			Code:       codeForbidden,
+			Detail:     "publishing on import requires books:publish",
+			Extensions: gin.H{"required": "books:publish"},
+		})
+		return
+	}
+
+	// รับได้ทั้ง multipart (field "file") และ raw body
+	var body io.Reader = c.Request.Body
+	var filename string
+	contentType := c.GetHeader("Content-Type")
+	if strings.HasPrefix(contentType, "multipart/") {
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			respondProblem(c, http.StatusBadRequest, codeBadRequest, "file field is required")
+			return
+		}
+		defer file.Close()
+		body = file
+		filename = header.Filename
+		contentType = header.Header.Get("Content-Type")
+	}
+
+	opts.Format = detectImportFormat(c.Query("format"), contentType, filename)
+	if opts.Format != "csv" && opts.Format != "ndjson" {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "format must be csv or ndjson")
+		return
+	}
+
+	report, err := importBooks(c.Request.Context(), body, opts)
+	if ferr, ok := err.(*importFileError); ok {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid import file: "+ferr.Error())
+		return
+	} else if err != nil {
+		slog.ErrorContext(c.Request.Context(), "error importing books", "error", err)
+		respondProblem(c, http.StatusInternalServerError, codeInternal, "import failed")
+		return
+	}
+
+	if !report.DryRun {
+		bookChangesTotal.WithLabelValues("created").Add(float64(report.Inserted))
+		bookChangesTotal.WithLabelValues("updated").Add(float64(report.Updated))
+	}
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "import", "books", nil, gin.H{
+		"format":   report.Format,
+		"dry_run":  report.DryRun,
+		"update":   opts.Update,
+		"inserted": report.Inserted,
+		"updated":  report.Updated,
+		"failed":   report.Failed,
+	}, c)
+
+	status := http.StatusOK
+	if report.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, report)
+}
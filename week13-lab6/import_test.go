@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateImportRow(t *testing.T) {
+	valid := func(overrides map[string]string) map[string]string {
+		fields := map[string]string{
+			"title":  "The Go Programming Language",
+			"author": "Alan Donovan and Brian Kernighan",
+			"isbn":   "978-0-306-40615-7",
+			"year":   "2015",
+			"price":  "1290.50",
+		}
+		for k, v := range overrides {
+			fields[k] = v
+		}
+		return fields
+	}
+
+	tests := []struct {
+		name      string
+		fields    map[string]string
+		wantField string // "" = แถวถูกต้อง
+	}{
+		{"valid", valid(nil), ""},
+		{"title at limit", valid(map[string]string{"title": strings.Repeat("ก", 255)}), ""},
+		{"price from JSON number", valid(map[string]string{"price": "1e+02"}), ""},
+		{"free book", valid(map[string]string{"price": "0"}), ""},
+		{"missing title", valid(map[string]string{"title": ""}), "title"},
+		{"title too long", valid(map[string]string{"title": strings.Repeat("a", 256)}), "title"},
+		{"author too long", valid(map[string]string{"author": strings.Repeat("ข", 256)}), "author"},
+		{"missing isbn", valid(map[string]string{"isbn": ""}), "isbn"},
+		{"bad isbn checksum", valid(map[string]string{"isbn": "9780306406158"}), "isbn"},
+		{"year not a number", valid(map[string]string{"year": "MMXV"}), "year"},
+		{"year too early", valid(map[string]string{"year": "1200"}), "year"},
+		{"price not a number", valid(map[string]string{"price": "abc"}), "price"},
+		{"price NaN", valid(map[string]string{"price": "NaN"}), "price"},
+		{"negative price", valid(map[string]string{"price": "-1"}), "price"},
+		{"price too large", valid(map[string]string{"price": "1e9"}), "price"},
+		{"price at DECIMAL(10,2) limit", valid(map[string]string{"price": "100000000"}), "price"},
+		{"price below limit", valid(map[string]string{"price": "99999999.99"}), ""},
+		{"price with 3 decimals", valid(map[string]string{"price": "10.005"}), "price"},
+	}
+	for _, tt := range tests {
+		_, errs := validateImportRow(7, tt.fields)
+		if tt.wantField == "" {
+			if len(errs) != 0 {
+				t.Errorf("%s: unexpected errors %+v", tt.name, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 || errs[0].Field != tt.wantField || errs[0].Row != 7 {
+			t.Errorf("%s: errors = %+v, want one error on %s", tt.name, errs, tt.wantField)
+		}
+	}
+
+	row, _ := validateImportRow(1, valid(nil))
+	if row.isbn != "9780306406157" || row.year != 2015 || row.price != 1290.5 {
+		t.Errorf("parsed row = %+v", row)
+	}
+}
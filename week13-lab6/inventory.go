@@ -0,0 +1,400 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Inventory =====================
+
+const (
+	movementReceive = "receive"
+	movementSell    = "sell"
+	movementAdjust  = "adjust"
+	movementReturn  = "return"
+)
+
+type StockLevel struct {
+	BookID            int       `json:"book_id"`
+	OnHand            int       `json:"on_hand"`
+	Reserved          int       `json:"reserved"`
+	Available         int       `json:"available"`
+	LowStockThreshold int       `json:"low_stock_threshold"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+type StockMovement struct {
+	ID          int64     `json:"id"`
+	BookID      int       `json:"book_id"`
+	Kind        string    `json:"kind"`
+	Quantity    int       `json:"quantity"`
+	OnHandAfter int       `json:"on_hand_after"`
+	Reference   string    `json:"reference"`
+	Note        string    `json:"note"`
+	CreatedBy   *int      `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type StockMovementRequest struct {
+	Kind string `json:"kind" binding:"required,oneof=receive sell adjust return"`
+	// receive/sell/return ส่งจำนวนบวก, adjust ส่งค่าบวกหรือลบได้
+	Quantity  int    `json:"quantity" binding:"required"`
+	Reference string `json:"reference" binding:"max=100"`
+	Note      string `json:"note" binding:"max=1000"`
+}
+
+type StockThresholdRequest struct {
+	Threshold *int `json:"low_stock_threshold" binding:"required,gte=0"`
+}
+
+type LowStockItem struct {
+	BookID            int    `json:"book_id"`
+	Title             string `json:"title"`
+	ISBN              string `json:"isbn"`
+	Status            string `json:"status"`
+	OnHand            int    `json:"on_hand"`
+	Reserved          int    `json:"reserved"`
+	Available         int    `json:"available"`
+	LowStockThreshold int    `json:"low_stock_threshold"`
+}
+
+// insufficientStockError is returned when a sale or reservation asks for
+// more than is available (on hand minus reserved).
+type insufficientStockError struct {
+	BookID    int
+	Requested int
+	Available int
+}
+
+func (e *insufficientStockError) Error() string {
+	return fmt.Sprintf("book %d: requested %d but only %d available", e.BookID, e.Requested, e.Available)
+}
+
+const stockColumns = "book_id, on_hand, reserved, low_stock_threshold, updated_at"
+
+func scanStock(row rowScanner) (StockLevel, error) {
+	var s StockLevel
+	err := row.Scan(&s.BookID, &s.OnHand, &s.Reserved, &s.LowStockThreshold, &s.UpdatedAt)
+	s.Available = s.OnHand - s.Reserved
+	return s, err
+}
+
+// lockStock ล็อกแถว stock ของหนังสือ (SELECT ... FOR UPDATE) จนจบ transaction
+// ทุกการเปลี่ยน on_hand/reserved ต้องผ่านตรงนี้ก่อน
+func lockStock(tx *sql.Tx, bookID int) (StockLevel, error) {
+	return scanStock(tx.QueryRow("SELECT "+stockColumns+" FROM stock WHERE book_id = $1 FOR UPDATE", bookID))
+}
+
+// applyStockMovement changes on_hand by delta and appends the ledger entry.
+// Stock that is reserved cannot be sold or adjusted away.
+func applyStockMovement(tx *sql.Tx, bookID int, kind string, delta int, reference, note string, userID int) (StockLevel, StockMovement, error) {
+	level, err := lockStock(tx, bookID)
+	if err != nil {
+		return StockLevel{}, StockMovement{}, err
+	}
+	if delta < 0 && -delta > level.Available {
+		return level, StockMovement{}, &insufficientStockError{BookID: bookID, Requested: -delta, Available: level.Available}
+	}
+
+	level, err = scanStock(tx.QueryRow(
+		"UPDATE stock SET on_hand = on_hand + $1 WHERE book_id = $2 RETURNING "+stockColumns,
+		delta, bookID,
+	))
+	if err != nil {
+		return StockLevel{}, StockMovement{}, err
+	}
+
+	movement, err := insertStockMovement(tx, bookID, kind, delta, level.OnHand, reference, note, userID)
+	return level, movement, err
+}
+
+func insertStockMovement(tx *sql.Tx, bookID int, kind string, delta, onHandAfter int, reference, note string, userID int) (StockMovement, error) {
+	m := StockMovement{BookID: bookID, Kind: kind, Quantity: delta, OnHandAfter: onHandAfter, Reference: reference, Note: note}
+	err := tx.QueryRow(
+		`INSERT INTO stock_movements (book_id, kind, quantity, on_hand_after, reference, note, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id, created_by, created_at`,
+		bookID, kind, delta, onHandAfter, reference, note,
+		sql.NullInt64{Int64: int64(userID), Valid: userID > 0},
+	).Scan(&m.ID, &m.CreatedBy, &m.CreatedAt)
+	return m, err
+}
+
+// reserveStock holds qty units for a pending order without changing on_hand.
+func reserveStock(tx *sql.Tx, bookID, qty int) error {
+	level, err := lockStock(tx, bookID)
+	if err != nil {
+		return err
+	}
+	if qty > level.Available {
+		return &insufficientStockError{BookID: bookID, Requested: qty, Available: level.Available}
+	}
+	_, err = tx.Exec("UPDATE stock SET reserved = reserved + $1 WHERE book_id = $2", qty, bookID)
+	return err
+}
+
+// releaseStock returns a reservation to the available pool, e.g. when an
+// order is cancelled before it is paid.
+func releaseStock(tx *sql.Tx, bookID, qty int) error {
+	if _, err := lockStock(tx, bookID); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE stock SET reserved = GREATEST(reserved - $1, 0) WHERE book_id = $2", qty, bookID)
+	return err
+}
+
+// sellReservedStock turns a reservation into a sale: on_hand and reserved
+// both drop by qty and a sell movement is recorded.
+func sellReservedStock(tx *sql.Tx, bookID, qty int, reference string, userID int) error {
+	if _, err := lockStock(tx, bookID); err != nil {
+		return err
+	}
+	var onHand int
+	err := tx.QueryRow(
+		`UPDATE stock SET on_hand = on_hand - $1, reserved = reserved - $1
+		 WHERE book_id = $2
+		 RETURNING on_hand`,
+		qty, bookID,
+	).Scan(&onHand)
+	if err != nil {
+		return err
+	}
+	_, err = insertStockMovement(tx, bookID, movementSell, -qty, onHand, reference, "", userID)
+	return err
+}
+
+func respondInsufficientStock(c *gin.Context, err *insufficientStockError) {
+	respondProblemWith(c, Problem{
+		Status: http.StatusConflict,
+		Code:   codeInsufficientStock,
+		Detail: err.Error(),
+		Extensions: gin.H{
+			"book_id":   err.BookID,
+			"requested": err.Requested,
+			"available": err.Available,
+		},
+	})
+}
+
+// @Summary Get stock level of a book
+// @Tags Inventory
+// @Produce  json
+// @Param   id  path  int  true  "Book ID"
+// @Success 200  {object}  StockLevel
+// @Failure 404  {object}  Problem
+// @Router  /books/{id}/stock [get]
+func getBookStock(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+
+	level, err := scanStock(db.QueryRow(
+		`SELECT `+stockColumns+` FROM stock
+		 WHERE book_id = $1 AND book_id IN (SELECT id FROM books WHERE deleted_at IS NULL)`,
+		bookID,
+	))
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, level)
+}
+
+// @Summary Record a stock movement
+// @Description receive, sell and return take a positive quantity; adjust takes a signed one
+// @Tags Inventory
+// @Accept  json
+// @Produce  json
+// @Param   id    path  int                   true  "Book ID"
+// @Param   body  body  StockMovementRequest  true  "Movement"
+// @Success 201  {object}  StockMovement
+// @Failure 409  {object}  Problem
+// @Router  /books/{id}/stock/movements [post]
+func createStockMovement(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+
+	var req StockMovementRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	delta := req.Quantity
+	switch req.Kind {
+	case movementReceive, movementReturn, movementSell:
+		if req.Quantity < 0 {
+			respondValidation(c, []FieldError{{Field: "quantity", Code: fieldOutOfRange, Message: "must be greater than 0 for " + req.Kind}})
+			return
+		}
+		if req.Kind == movementSell {
+			delta = -req.Quantity
+		}
+	}
+	userID := c.GetInt("user_id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	level, movement, err := applyStockMovement(tx, bookID, req.Kind, delta, req.Reference, req.Note, userID)
+	if stockErr, ok := err.(*insufficientStockError); ok {
+		respondInsufficientStock(c, stockErr)
+		return
+	} else if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	bookCache.invalidate(bookID)
+
+	// Log audit
+	logAudit(userID, "stock_"+req.Kind, "books", bookID, gin.H{
+		"quantity":  delta,
+		"on_hand":   level.OnHand,
+		"reference": req.Reference,
+	}, c)
+
+	c.JSON(http.StatusCreated, movement)
+}
+
+// @Summary List stock movements of a book
+// @Tags Inventory
+// @Produce  json
+// @Param   id      path   int  true   "Book ID"
+// @Param   limit   query  int  false  "Page size (max 200)"
+// @Param   offset  query  int  false  "Offset"
+// @Success 200  {array}  StockMovement
+// @Router  /books/{id}/stock/movements [get]
+func getStockMovements(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+	limit, offset, err := parsePage(c, 50, 200)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	rows, err := db.Query(
+		`SELECT id, book_id, kind, quantity, on_hand_after, reference, note, created_by, created_at
+		 FROM stock_movements
+		 WHERE book_id = $1
+		 ORDER BY id DESC
+		 LIMIT $2 OFFSET $3`,
+		bookID, limit, offset,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	movements := []StockMovement{}
+	for rows.Next() {
+		var m StockMovement
+		if err := rows.Scan(&m.ID, &m.BookID, &m.Kind, &m.Quantity, &m.OnHandAfter, &m.Reference, &m.Note, &m.CreatedBy, &m.CreatedAt); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		movements = append(movements, m)
+	}
+
+	c.JSON(http.StatusOK, movements)
+}
+
+func updateStockThreshold(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+
+	var req StockThresholdRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	level, err := scanStock(db.QueryRow(
+		"UPDATE stock SET low_stock_threshold = $1 WHERE book_id = $2 RETURNING "+stockColumns,
+		*req.Threshold, bookID,
+	))
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "stock_threshold", "books", bookID, gin.H{"low_stock_threshold": *req.Threshold}, c)
+
+	c.JSON(http.StatusOK, level)
+}
+
+// @Summary Low stock report
+// @Description Books whose available quantity is at or below their threshold, emptiest first
+// @Tags Inventory
+// @Produce  json
+// @Param   status  query  string  false  "Only books in this status (default: all except archived)"
+// @Success 200  {array}  LowStockItem
+// @Router  /inventory/low-stock [get]
+func getLowStockReport(c *gin.Context) {
+	query := `SELECT b.id, b.title, b.isbn, b.status, s.on_hand, s.reserved, s.low_stock_threshold
+		FROM stock s
+		JOIN books b ON b.id = s.book_id
+		WHERE b.deleted_at IS NULL AND s.on_hand - s.reserved <= s.low_stock_threshold`
+	var args []interface{}
+	if status := c.Query("status"); status != "" {
+		query += " AND b.status = $1"
+		args = append(args, status)
+	} else {
+		query += " AND b.status <> 'archived'"
+	}
+
+	rows, err := db.Query(query+" ORDER BY s.on_hand - s.reserved, b.title", args...)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	items := []LowStockItem{}
+	for rows.Next() {
+		var it LowStockItem
+		if err := rows.Scan(&it.BookID, &it.Title, &it.ISBN, &it.Status, &it.OnHand, &it.Reserved, &it.LowStockThreshold); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		it.Available = it.OnHand - it.Reserved
+		items = append(items, it)
+	}
+
+	c.JSON(http.StatusOK, items)
+}
@@ -0,0 +1,141 @@
+// Package isbn validates and converts ISBN-10 and ISBN-13 identifiers.
+//
+// The canonical form used by the bookstore is the compact ISBN-13: thirteen
+// digits with no hyphens or spaces. Hyphen placement depends on the
+// registration-group ranges published by the ISBN agency, so input
+// hyphenation is accepted in any position and stripped by Normalize.
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrEmpty          = errors.New("isbn is empty")
+	ErrInvalidLength  = errors.New("isbn must have 10 or 13 digits")
+	ErrInvalidChar    = errors.New("isbn contains invalid characters")
+	ErrInvalidCheck   = errors.New("isbn check digit is invalid")
+	ErrNotConvertible = errors.New("only 978-prefixed ISBN-13 can be converted to ISBN-10")
+)
+
+// Clean removes hyphens and spaces and upper-cases a trailing x.
+func Clean(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ', '\u2010', '\u2011', '\u2013': // ASCII and Unicode hyphens
+			return -1
+		case 'x':
+			return 'X'
+		}
+		return r
+	}, strings.TrimSpace(s))
+}
+
+// Validate reports why s is not a valid ISBN-10 or ISBN-13, or nil if it is.
+func Validate(s string) error {
+	digits := Clean(s)
+	switch len(digits) {
+	case 0:
+		return ErrEmpty
+	case 10:
+		return validate10(digits)
+	case 13:
+		return validate13(digits)
+	}
+	return ErrInvalidLength
+}
+
+// IsValid reports whether s is a valid ISBN-10 or ISBN-13.
+func IsValid(s string) bool {
+	return Validate(s) == nil
+}
+
+// Normalize validates s and returns it as a compact ISBN-13.
+func Normalize(s string) (string, error) {
+	return To13(s)
+}
+
+// To13 converts a valid ISBN-10 or ISBN-13 to a compact ISBN-13.
+func To13(s string) (string, error) {
+	if err := Validate(s); err != nil {
+		return "", err
+	}
+	digits := Clean(s)
+	if len(digits) == 13 {
+		return digits, nil
+	}
+	body := "978" + digits[:9]
+	return body + string(checkDigit13(body)), nil
+}
+
+// To10 converts a valid ISBN to a compact ISBN-10. ISBN-13s with the 979
+// prefix have no ISBN-10 equivalent.
+func To10(s string) (string, error) {
+	if err := Validate(s); err != nil {
+		return "", err
+	}
+	digits := Clean(s)
+	if len(digits) == 10 {
+		return digits, nil
+	}
+	if !strings.HasPrefix(digits, "978") {
+		return "", ErrNotConvertible
+	}
+	body := digits[3:12]
+	return body + string(checkDigit10(body)), nil
+}
+
+func validate10(digits string) error {
+	for i, r := range digits {
+		if r >= '0' && r <= '9' {
+			continue
+		}
+		if r == 'X' && i == 9 {
+			continue
+		}
+		return ErrInvalidChar
+	}
+	if checkDigit10(digits[:9]) != digits[9] {
+		return ErrInvalidCheck
+	}
+	return nil
+}
+
+func validate13(digits string) error {
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return ErrInvalidChar
+		}
+	}
+	if checkDigit13(digits[:12]) != digits[12] {
+		return ErrInvalidCheck
+	}
+	return nil
+}
+
+// checkDigit10 computes the mod-11 check digit for nine digits.
+func checkDigit10(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// checkDigit13 computes the mod-10 check digit for twelve digits.
+func checkDigit13(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(body[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
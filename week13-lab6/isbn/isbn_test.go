@@ -0,0 +1,88 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want error
+	}{
+		{"978-0-306-40615-7", nil},
+		{"9780306406157", nil},
+		{"0-306-40615-2", nil},
+		{"080442957X", nil},
+		{"080442957x", nil},
+		{"979-10-90636-07-1", nil},
+		{" 978 0 306 40615 7 ", nil},
+		{"978‐0‑306–40615‐7", nil},
+		{"", ErrEmpty},
+		{"  ", ErrEmpty},
+		{"978030640615", ErrInvalidLength},
+		{"97803064061570", ErrInvalidLength},
+		{"978030640615X", ErrInvalidChar},
+		{"08044X957X", ErrInvalidChar},
+		{"978-1234567890", ErrInvalidCheck},
+		{"0306406153", ErrInvalidCheck},
+	}
+	for _, tt := range tests {
+		if got := Validate(tt.in); !errors.Is(got, tt.want) {
+			t.Errorf("Validate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTo13(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr error
+	}{
+		{"0-306-40615-2", "9780306406157", nil},
+		{"080442957X", "9780804429573", nil},
+		{"978-0-306-40615-7", "9780306406157", nil},
+		{"979-10-90636-07-1", "9791090636071", nil},
+		{"0306406153", "", ErrInvalidCheck},
+	}
+	for _, tt := range tests {
+		got, err := To13(tt.in)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("To13(%q) = %q, %v; want %q, %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestTo10(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr error
+	}{
+		{"9780306406157", "0306406152", nil},
+		{"9780804429573", "080442957X", nil},
+		{"0-306-40615-2", "0306406152", nil},
+		{"9791090636071", "", ErrNotConvertible},
+		{"9780306406158", "", ErrInvalidCheck},
+	}
+	for _, tt := range tests {
+		got, err := To10(tt.in)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("To10(%q) = %q, %v; want %q, %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, in := range []string{"0306406152", "080442957X", "0131103628"} {
+		isbn13, err := To13(in)
+		if err != nil {
+			t.Fatalf("To13(%q): %v", in, err)
+		}
+		back, err := To10(isbn13)
+		if err != nil || back != in {
+			t.Errorf("To10(To13(%q)) = %q, %v", in, back, err)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ===================== Logging =====================
+
+// initLogging installs the slog handler chosen by LOG_FORMAT as the
+// default logger. The standard log package and gin's debug output are
+// routed through it too, so every line is structured and redacted.
+func initLogging() {
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.Log.Level)) // ตรวจแล้วใน config.Validate
+
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	var h slog.Handler
+	if cfg.Log.Format == "text" {
+		h = slog.NewTextHandler(os.Stderr, opts)
+	} else {
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(contextHandler{h}))
+	slog.SetLogLoggerLevel(slog.LevelInfo) // log.Printf เดิม = INFO
+
+	if cfg.Production() {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	gin.DebugPrintFunc = func(format string, values ...any) {
+		slog.Debug(strings.TrimSpace(fmt.Sprintf(format, values...)), "component", "gin")
+	}
+}
+
+// contextHandler adds the request ID and trace/span IDs carried by the
+// context, so lines logged with slog.*Context can be joined with the
+// access log, audit_logs and traces.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// ===================== Redaction =====================
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are matched as substrings of lower-cased attribute and
+// query parameter names.
+var sensitiveKeys = []string{"password", "passwd", "secret", "token", "authorization", "cookie", "api_key", "apikey", "signature"}
+
+var (
+	// Bearer/Basic credentials, e.g. a logged Authorization header value
+	credentialPattern = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`)
+	// JWTs anywhere in a string (header.payload.signature)
+	jwtPattern = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// key=value pairs in DSNs, URLs and error messages
+	secretPairPattern = regexp.MustCompile(`(?i)\b([a-z_]*(?:password|passwd|secret|token|api_?key)[a-z_]*)=([^\s&'"]+)`)
+)
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactString masks credentials embedded in free text.
+func redactString(s string) string {
+	s = credentialPattern.ReplaceAllString(s, "$1 "+redacted)
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	return secretPairPattern.ReplaceAllString(s, "$1="+redacted)
+}
+
+// redactAttr is the slog ReplaceAttr hook: values under sensitive keys are
+// dropped entirely and strings/errors are scanned for credentials. It also
+// applies to the message, which covers lines from the log package.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if a.Key != slog.MessageKey && isSensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, redactString(err.Error()))
+		}
+	}
+	return a
+}
+
+// redactQuery re-encodes a query string with sensitive parameters masked.
+func redactQuery(rawQuery string) string {
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return redactString(rawQuery)
+	}
+	for k := range q {
+		if isSensitiveKey(k) {
+			q[k] = []string{redacted}
+		}
+	}
+	return q.Encode()
+}
+
+// redactPath returns the request path with the values of sensitive route
+// parameters masked, e.g. /shared/wishlists/[REDACTED] for the :token of
+// a shared wishlist link. Unmatched paths have no parameters to mask.
+func redactPath(c *gin.Context) string {
+	path := c.Request.URL.Path
+	route := strings.Split(c.FullPath(), "/")
+	segments := strings.Split(path, "/")
+	masked := false
+	for i, seg := range route {
+		// ไม่มี route ที่ใช้ *wildcard กับค่าลับ; *param อยู่ท้ายสุดเสมอ index ก่อนหน้าจึงตรงกัน
+		if strings.HasPrefix(seg, ":") && isSensitiveKey(seg[1:]) && i < len(segments) {
+			segments[i] = redacted
+			masked = true
+		}
+	}
+	if !masked {
+		return path
+	}
+	return strings.Join(segments, "/")
+}
+
+// ===================== Request ID =====================
+
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// รับ ID จาก client/proxy ได้เฉพาะรูปแบบที่ปลอดภัยต่อการเขียน log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDMiddleware accepts the X-Request-ID sent by nginx or the client
+// (or generates one), echoes it in the response and stores it on the gin
+// and request contexts for logs and audit entries.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Set("request_id", id)
+		c.Header(requestIDHeader, id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDKey{}, id))
+		c.Next()
+	}
+}
+
+// ===================== Access Log =====================
+
+// accessLogMiddleware writes one line per request. Request headers and
+// bodies are never logged; the path and query string are logged with
+// sensitive parameters masked.
+func accessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		switch c.Request.URL.Path {
+		case "/livez", "/readyz", "/health", "/metrics":
+			if status < 500 {
+				level = slog.LevelDebug // probe ถี่มาก
+			}
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", redactPath(c)),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if c.Request.URL.RawQuery != "" {
+			attrs = append(attrs, slog.String("query", redactQuery(c.Request.URL.RawQuery)))
+		}
+		if userID := c.GetInt("user_id"); userID > 0 {
+			attrs = append(attrs, slog.Int("user_id", userID))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// recoveryMiddleware replaces gin.Recovery so panics are logged through
+// slog (with the request ID) instead of gin's request dump.
+func recoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, recovered any) {
+		err, ok := recovered.(error)
+		if !ok {
+			err = fmt.Errorf("%v", recovered)
+		}
+		if errors.Is(err, http.ErrAbortHandler) {
+			panic(err)
+		}
+		slog.ErrorContext(c.Request.Context(), "panic recovered",
+			"error", err,
+			"method", c.Request.Method,
+			"path", redactPath(c),
+			"route", c.FullPath(),
+			"stack", string(debug.Stack()),
+		)
+		respondProblem(c, http.StatusInternalServerError, codeInternal, "")
+	})
+}
+
+// stdLogger adapts the default slog handler for APIs that take a
+// *log.Logger, such as http.Server.ErrorLog.
+func stdLogger(level slog.Level) *log.Logger {
+	return slog.NewLogLogger(slog.Default().Handler(), level)
+}
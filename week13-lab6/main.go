@@ -1,21 +1,30 @@
 package main
 
 import (
-    _ "week13-lab6/docs"
-	"fmt"
-	"os"
+	"context"
 	"database/sql"
-	_ "github.com/lib/pq"
+	"encoding/json"
+	"fmt"
 	"log"
-	"github.com/gin-gonic/gin"
+	"log/slog"
+	"maps"
 	"net/http"
-	"time"
+	"os"
+	"strconv"
 	"strings"
-	"encoding/json"
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
+	"time"
+
+	"week13-lab6/config"
+	_ "week13-lab6/docs"
+
 	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	_ "github.com/lib/pq"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -26,14 +35,89 @@ type ErrorResponse struct {
 
 // ===================== Book Model =====================
 type Book struct {
-	ID        int       `json:"id"`
-	Title     string    `json:"title"`
-	Author    string    `json:"author"`
-	ISBN      string    `json:"isbn"`
-	Year      int       `json:"year"`
-	Price     float64   `json:"price"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID     int     `json:"id"`
+	Title  string  `json:"title" binding:"required,max=255"`
+	Author string  `json:"author" binding:"max=255"`
+	ISBN   string  `json:"isbn" binding:"omitempty,isbn_any"`
+	Year   int     `json:"year" binding:"required,book_year"`
+	Price  float64 `json:"price" binding:"gte=0"`
+
+	// ราคา/ส่วนลด/ปก (เหมือน week11-assignment)
+	OriginalPrice *float64 `json:"original_price,omitempty" binding:"omitempty,gte=0"`
+	Discount      int      `json:"discount" binding:"gte=0,lte=100"`
+	CoverImage    string   `json:"cover_image" binding:"omitempty,http_url,max=500"`
+
+	// ผู้แต่ง/สำนักพิมพ์/หมวดหมู่ อ้างถึงตารางของตัวเอง ชื่อด้านบนเป็นค่าที่ sync มา
+	// ส่ง author_ids มาเพื่อเลือกผู้แต่งตามลำดับ ไม่ส่ง = แยกจากข้อความใน author
+	AuthorIDs   []int        `json:"author_ids,omitempty" binding:"omitempty,max=20,unique,dive,gt=0"`
+	Authors     []BookAuthor `json:"authors,omitempty"`
+	PublisherID *int         `json:"publisher_id,omitempty" binding:"omitempty,gt=0"`
+	Publisher   string       `json:"publisher" binding:"max=255"`
+	CategoryID  *int         `json:"category_id,omitempty" binding:"omitempty,gt=0"`
+	Category    string       `json:"category" binding:"max=100"`
+
+	// คำนวณจาก reviews ที่ published เท่านั้น แก้ผ่าน API ของ book ไม่ได้
+	Rating       float64 `json:"rating"`
+	ReviewsCount int     `json:"reviews_count"`
+
+	// ราคาเป็นหน่วยย่อยพร้อมสกุลและ VAT คำนวณจาก price/original_price/discount
+	// สกุลอื่นดูที่ /books/:id/price?currency=
+	Pricing *BookPricing `json:"pricing,omitempty"`
+
+	// มีของพร้อมขาย (on_hand มากกว่าที่จองไว้) รายละเอียดอยู่ที่ /books/:id/stock
+	InStock bool `json:"in_stock"`
+
+	// Publishing workflow
+	Status      string     `json:"status"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	// stock.updated_at: การเคลื่อนไหวของ stock ไม่แตะ books.updated_at แต่เปลี่ยน in_stock
+	stockUpdatedAt *time.Time
+}
+
+// lastModified is the Last-Modified of a single book: the newer of the
+// book row and its stock row, since in_stock comes from the latter.
+func (b Book) lastModified() time.Time {
+	if b.stockUpdatedAt != nil && b.stockUpdatedAt.After(b.UpdatedAt) {
+		return *b.stockUpdatedAt
+	}
+	return b.UpdatedAt
+}
+
+// bookColumns ต้องเรียงตรงกับ scanBook
+const bookColumns = `id, title, author, isbn, year, price,
+	original_price, discount, cover_image,
+	publisher_id, publisher, category_id, category,
+	rating, reviews_count,
+	EXISTS (SELECT 1 FROM stock WHERE stock.book_id = books.id AND stock.on_hand > stock.reserved) AS in_stock,
+	status, published_at, scheduled_at,
+	created_at, updated_at, deleted_at,
+	(SELECT stock.updated_at FROM stock WHERE stock.book_id = books.id) AS stock_updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBook(row rowScanner) (Book, error) {
+	var book Book
+	err := row.Scan(
+		&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Year, &book.Price,
+		&book.OriginalPrice, &book.Discount, &book.CoverImage,
+		&book.PublisherID, &book.Publisher, &book.CategoryID, &book.Category,
+		&book.Rating, &book.ReviewsCount, &book.InStock,
+		&book.Status, &book.PublishedAt, &book.ScheduledAt,
+		&book.CreatedAt, &book.UpdatedAt, &book.DeletedAt,
+		&book.stockUpdatedAt,
+	)
+	if err == nil {
+		book.Pricing = basePricing(book)
+	}
+	return book, err
 }
 
 // ===================== Auth Models =====================
@@ -47,8 +131,8 @@ type User struct {
 }
 
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username string `json:"username" binding:"required,max=50"`
+	Password string `json:"password" binding:"required,max=72"` // bcrypt ใช้แค่ 72 bytes แรก
 }
 
 type LoginResponse struct {
@@ -77,19 +161,32 @@ type CustomClaims struct {
 }
 
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+var db *sql.DB
+
+// cfg ถูกโหลดครั้งเดียวตอนเริ่มโปรแกรม (ดู loadConfig)
+var cfg *config.Config
+
+var jwtSecret []byte
+
+// loadConfig reads CONFIG_FILE (optional), the environment and secret files.
+// Any invalid setting stops the program with every problem listed.
+func loadConfig() {
+	var err error
+	cfg, err = config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatalf("invalid configuration:\n%v", err)
 	}
-	return defaultValue
-}
+	jwtSecret = []byte(cfg.Auth.JWTSecret)
+	initLogging()
 
-var db *sql.DB
-var jwtSecret = []byte("my-super-secret-key-change-in-production-2024")
+	if cfg.UsesDefaultJWTSecret() {
+		slog.Warn("using the default JWT_SECRET; set JWT_SECRET or JWT_SECRET_FILE before deploying")
+	}
+}
 
 // ===================== Password Hashing Functions =====================
 func hashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cfg.Auth.BcryptCost)
 	if err != nil {
 		return "", err
 	}
@@ -102,7 +199,7 @@ func verifyPassword(hashedPassword, password string) error {
 
 // ===================== JWT Functions =====================
 func generateAccessToken(userID int, username string, roles []string) (string, error) {
-	expirationTime := time.Now().Add(15 * time.Minute)
+	expirationTime := time.Now().Add(cfg.Auth.AccessTokenTTL)
 
 	claims := &CustomClaims{
 		UserID:   userID,
@@ -120,7 +217,7 @@ func generateAccessToken(userID int, username string, roles []string) (string, e
 }
 
 func generateRefreshToken(userID int, username string) (string, error) {
-	expirationTime := time.Now().Add(7 * 24 * time.Hour)
+	expirationTime := time.Now().Add(cfg.Auth.RefreshTokenTTL)
 
 	claims := &CustomClaims{
 		UserID:   userID,
@@ -183,7 +280,7 @@ func getUserRoles(userID int) ([]string, error) {
 	return roles, nil
 }
 
-func checkUserPermission(userID int, permission string) bool {
+func checkUserPermission(ctx context.Context, userID int, permission string) bool {
 	query := `
 		SELECT COUNT(*)
 		FROM permissions p
@@ -193,9 +290,9 @@ func checkUserPermission(userID int, permission string) bool {
 	`
 
 	var count int
-	err := db.QueryRow(query, userID, permission).Scan(&count)
+	err := db.QueryRowContext(ctx, query, userID, permission).Scan(&count)
 	if err != nil {
-		log.Printf("Error checking permission: %v", err)
+		slog.ErrorContext(ctx, "error checking permission", "permission", permission, "error", err)
 		return false
 	}
 
@@ -211,14 +308,19 @@ func storeRefreshToken(userID int, token string, expiresAt time.Time) error {
 	return err
 }
 
-func revokeRefreshToken(token string) error {
+// revokeRefreshToken reports whether token was valid and is now revoked.
+func revokeRefreshToken(token string) (bool, error) {
 	query := `
 		UPDATE refresh_tokens
 		SET revoked_at = NOW()
 		WHERE token = $1 AND revoked_at IS NULL
 	`
-	_, err := db.Exec(query, token)
-	return err
+	result, err := db.Exec(query, token)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
 }
 
 func isRefreshTokenValid(token string) (int, bool) {
@@ -239,7 +341,18 @@ func isRefreshTokenValid(token string) (int, bool) {
 	return userID, true
 }
 
+// logAudit accepts userID 0 and a nil context for actions taken by
+// background jobs rather than a request.
 func logAudit(userID int, action, resource string, resourceID interface{}, details map[string]interface{}, c *gin.Context) {
+	// แนบ request_id เพื่อโยง audit log กับ access log ของ request เดียวกัน
+	if c != nil {
+		if requestID := c.GetString("request_id"); requestID != "" {
+			merged := make(map[string]interface{}, len(details)+1)
+			maps.Copy(merged, details)
+			merged["request_id"] = requestID
+			details = merged
+		}
+	}
 	detailsJSON, _ := json.Marshal(details)
 
 	query := `
@@ -253,54 +366,51 @@ func logAudit(userID int, action, resource string, resourceID interface{}, detai
 		resourceIDStr = fmt.Sprintf("%v", resourceID)
 	}
 
+	var ipAddress, userAgent string
+	if c != nil {
+		ipAddress = c.ClientIP()
+		userAgent = c.GetHeader("User-Agent")
+	}
+
 	db.Exec(query,
-		userID,
+		sql.NullInt64{Int64: int64(userID), Valid: userID > 0},
 		action,
 		resource,
 		resourceIDStr,
 		detailsJSON,
-		c.ClientIP(),
-		c.GetHeader("User-Agent"),
+		ipAddress,
+		userAgent,
 	)
 }
 
 func initDB() {
 	var err error
 
-	host := getEnv("DB_HOST", "")
-	name := getEnv("DB_NAME", "")
-	user := getEnv("DB_USER", "")
-	password := getEnv("DB_PASSWORD", "")
-	port := getEnv("DB_PORT", "")
-
-	conSt := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, name)
-	// fmt.Println(conSt)
-	db, err = sql.Open("postgres", conSt)
+	db, err = openTracedDB(cfg.Database.DSN())
 	if err != nil {
 		log.Fatal("failed to open database")
 	}
 
 	// กำหนดจำนวน Connection สูงสุด
-	db.SetMaxOpenConns(25)
+	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
 
 	// กำหนดจำนวน Idle connection สูงสุด
-	db.SetMaxIdleConns(25)
+	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
 
 	// กำหนดอายุของ Connection
-	db.SetConnMaxLifetime(5 * time.Minute)
+	db.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
 
 	err = db.Ping()
 	if err != nil {
 		log.Fatal("failed to connect to database", err)
 	}
-	log.Println("successfully connected to database")
+	slog.Info("successfully connected to database")
 }
 
 // ===================== Authentication Endpoints =====================
 func login(c *gin.Context) {
 	var req LoginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -321,57 +431,72 @@ func login(c *gin.Context) {
 	)
 
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		loginsTotal.WithLabelValues("failed").Inc()
+		logAudit(0, "login_failed", "auth", nil, gin.H{
+			"username": req.Username,
+			"reason":   "unknown_user",
+		}, c)
+		respondProblem(c, http.StatusUnauthorized, codeInvalidCredentials, "invalid credentials")
 		return
 	} else if err != nil {
-		log.Printf("Database error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		slog.ErrorContext(c.Request.Context(), "database error during login", "error", err)
+		respondProblem(c, http.StatusInternalServerError, codeInternal, "")
 		return
 	}
 
 	// ตรวจสอบว่า user active หรือไม่
 	if !user.IsActive {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "account is disabled"})
+		loginsTotal.WithLabelValues("failed").Inc()
+		respondProblem(c, http.StatusUnauthorized, codeAccountDisabled, "account is disabled")
 		return
 	}
 
 	// ตรวจสอบ password
 	if err := verifyPassword(user.PasswordHash, req.Password); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		loginsTotal.WithLabelValues("failed").Inc()
+		logAudit(user.ID, "login_failed", "auth", nil, gin.H{
+			"username": user.Username,
+			"reason":   "wrong_password",
+		}, c)
+		respondProblem(c, http.StatusUnauthorized, codeInvalidCredentials, "invalid credentials")
 		return
 	}
 
 	// ดึง roles ของ user
 	roles, err := getUserRoles(user.ID)
 	if err != nil {
-		log.Printf("Error getting roles: %v", err)
+		slog.ErrorContext(c.Request.Context(), "error getting roles", "user_id", user.ID, "error", err)
 		roles = []string{} // ถ้าดึงไม่ได้ให้เป็น empty array
 	}
 
 	// สร้าง tokens
 	accessToken, err := generateAccessToken(user.ID, user.Username, roles)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate access token"})
+		respondInternalError(c, err)
 		return
 	}
 
 	refreshToken, err := generateRefreshToken(user.ID, user.Username)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate refresh token"})
+		respondInternalError(c, err)
 		return
 	}
 
 	// บันทึก refresh token ในฐานข้อมูล
-	expiresAt := time.Now().Add(7 * 24 * time.Hour)
+	expiresAt := time.Now().Add(cfg.Auth.RefreshTokenTTL)
 	if err := storeRefreshToken(user.ID, refreshToken, expiresAt); err != nil {
-		log.Printf("Error storing refresh token: %v", err)
+		slog.ErrorContext(c.Request.Context(), "error storing refresh token", "user_id", user.ID, "error", err)
 		// ไม่ return error เพราะ token ยังใช้ได้
 	}
 
 	// อัพเดท last_login
 	db.Exec("UPDATE users SET last_login = NOW() WHERE id = $1", user.ID)
 
+	// ย้ายตะกร้าที่ใส่ไว้ตอนยังไม่ login มารวมกับตะกร้าของ user
+	mergeGuestCart(c, user.ID)
+
 	// Log audit
+	loginsTotal.WithLabelValues("succeeded").Inc()
 	logAudit(user.ID, "login", "auth", nil, gin.H{
 		"username": user.Username,
 	}, c)
@@ -391,15 +516,14 @@ func login(c *gin.Context) {
 
 func refreshTokenHandler(c *gin.Context) {
 	var req RefreshRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	// ตรวจสอบ refresh token
 	userID, valid := isRefreshTokenValid(req.RefreshToken)
 	if !valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired refresh token"})
+		respondProblem(c, http.StatusUnauthorized, codeInvalidToken, "invalid or expired refresh token")
 		return
 	}
 
@@ -407,7 +531,7 @@ func refreshTokenHandler(c *gin.Context) {
 	var username string
 	err := db.QueryRow("SELECT username FROM users WHERE id = $1", userID).Scan(&username)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		respondProblem(c, http.StatusUnauthorized, codeInvalidToken, "user not found")
 		return
 	}
 
@@ -420,9 +544,10 @@ func refreshTokenHandler(c *gin.Context) {
 	// สร้าง access token ใหม่
 	accessToken, err := generateAccessToken(userID, username, roles)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate access token"})
+		respondInternalError(c, err)
 		return
 	}
+	tokensTotal.WithLabelValues("refreshed").Inc()
 
 	c.JSON(http.StatusOK, gin.H{
 		"access_token": accessToken,
@@ -432,14 +557,16 @@ func refreshTokenHandler(c *gin.Context) {
 func logout(c *gin.Context) {
 	// ดึง refresh token จาก request
 	var req RefreshRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	// Revoke refresh token
-	if err := revokeRefreshToken(req.RefreshToken); err != nil {
-		log.Printf("Error revoking token: %v", err)
+	// token ที่ไม่มีอยู่หรือ revoke ไปแล้วไม่นับ
+	if revoked, err := revokeRefreshToken(req.RefreshToken); err != nil {
+		slog.ErrorContext(c.Request.Context(), "error revoking refresh token", "error", err)
+	} else if revoked {
+		tokensTotal.WithLabelValues("revoked").Inc()
 	}
 
 	// Log audit (ถ้ามี user_id ใน context)
@@ -453,58 +580,70 @@ func logout(c *gin.Context) {
 // ===================== Middleware =====================
 func authMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// ดึง token จาก Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header required"})
-			c.Abort()
-			return
-		}
-
-		// ตรวจสอบ format: "Bearer <token>"
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header format"})
-			c.Abort()
-			return
+		end := startSpan(c, "authMiddleware")
+		ok := authenticate(c)
+		end()
+		if ok {
+			c.Next()
 		}
+	}
+}
 
-		tokenString := parts[1]
+// authenticate verifies the bearer token and stores the user in the
+// context. On failure it responds 401 and returns false.
+func authenticate(c *gin.Context) bool {
+	// ดึง token จาก Authorization header
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		respondProblem(c, http.StatusUnauthorized, codeUnauthorized, "authorization header required")
+		return false
+	}
 
-		// Verify token
-		claims, err := verifyToken(tokenString)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
-			c.Abort()
-			return
-		}
+	// ตรวจสอบ format: "Bearer <token>"
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		respondProblem(c, http.StatusUnauthorized, codeUnauthorized, "invalid authorization header format")
+		return false
+	}
 
-		// เก็บข้อมูล user ใน context
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("roles", claims.Roles)
+	tokenString := parts[1]
 
-		c.Next()
+	// Verify token
+	claims, err := verifyToken(tokenString)
+	if err != nil {
+		respondProblem(c, http.StatusUnauthorized, codeInvalidToken, "invalid or expired token")
+		return false
 	}
+
+	// เก็บข้อมูล user ใน context
+	c.Set("user_id", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("roles", claims.Roles)
+	trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.Int("enduser.id", claims.UserID))
+
+	return true
 }
 
 func requirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, exists := c.Get("user_id")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-			c.Abort()
+			respondProblem(c, http.StatusUnauthorized, codeUnauthorized, "unauthorized")
 			return
 		}
 
 		// ตรวจสอบ permission
-		hasPermission := checkUserPermission(userID.(int), permission)
+		end := startSpan(c, "requirePermission", attribute.String("permission", permission))
+		hasPermission := checkUserPermission(c.Request.Context(), userID.(int), permission)
+		end()
 		if !hasPermission {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error":   "insufficient permissions",
-				"required": permission,
+			permissionDenialsTotal.WithLabelValues(permission).Inc()
+			respondProblemWith(c, Problem{
+				Status:     http.StatusForbidden,
+				Code:       codeForbidden,
+				Detail:     "insufficient permissions",
+				Extensions: gin.H{"required": permission},
 			})
-			c.Abort()
 			return
 		}
 
@@ -517,26 +656,49 @@ func requirePermission(permission string) gin.HandlerFunc {
 // @Description Get details of books
 // @Tags Books
 // @Produce  json
+// @Param   q          query  string  false  "Search in title or author"
+// @Param   author     query  string  false  "Author contains"
+// @Param   isbn       query  string  false  "Exact ISBN"
+// @Param   year_from  query  int     false  "Minimum year"
+// @Param   year_to    query  int     false  "Maximum year"
+// @Param   min_price  query  number  false  "Minimum price"
+// @Param   max_price  query  number  false  "Maximum price"
+// @Param   author_id     query  int  false  "Author ID"
+// @Param   publisher_id  query  int  false  "Publisher ID"
+// @Param   category_id   query  int  false  "Category ID, including subcategories"
+// @Param   in_stock      query  bool  false  "Only books that are (true) or are not (false) available"
+// @Param   status     query  string  false  "Status (staff only)"
 // @Success 200  {array}  Book
-// @Failure 500  {object}  ErrorResponse
+// @Failure 400  {object}  Problem
+// @Failure 500  {object}  Problem
 // @Router  /books [get]
 func getAllBooks(c *gin.Context) {
-    var rows *sql.Rows
-    var err error
-    // ลูกค้าถาม "มีหนังสืออะไรบ้าง"
-    rows, err = db.Query("SELECT id, title, author, isbn, year, price, created_at, updated_at FROM books")
+    // ลูกค้าถาม "มีหนังสืออะไรบ้าง" (ลูกค้าทั่วไปเห็นเฉพาะที่เผยแพร่แล้ว)
+    filter, err := parseBookFilter(c)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+        return
+    }
+    listBooks(c, filter)
+}
+
+// listBooks writes the books matching filter, shared by every listing endpoint.
+func listBooks(c *gin.Context, filter *bookFilter) {
+    // อ่านก่อน query: ถ้ามีการแก้ระหว่างนั้น Last-Modified จะเก่ากว่าข้อมูล (ปลอดภัย) ไม่ใช่ใหม่กว่า
+    lastModified := booksModified(c.Request.Context())
+    rows, err := db.QueryContext(c.Request.Context(), "SELECT "+bookColumns+" FROM books"+filter.where()+" ORDER BY id", filter.args...)
+    if err != nil {
+        respondInternalError(c, err)
         return
     }
     defer rows.Close() // ต้องปิด rows เสมอ เพื่อคืน Connection กลับ pool
 
     var books []Book
     for rows.Next() {
-        var book Book
-        err := rows.Scan(&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Year, &book.Price, &book.CreatedAt, &book.UpdatedAt)
+        book, err := scanBook(rows)
         if err != nil {
-            // handle error
+            slog.ErrorContext(c.Request.Context(), "error scanning book", "error", err)
+            continue
         }
         books = append(books, book)
     }
@@ -544,57 +706,98 @@ func getAllBooks(c *gin.Context) {
 		books = []Book{}
 	}
 
-	c.JSON(http.StatusOK, books)
+	respondCached(c, books, lastModified)
 }
 
 func getBook(c *gin.Context) {
-    id := c.Param("id")
-    var book Book
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
 
-    // QueryRow ใช้เมื่อคาดว่าจะได้ผลลัพธ์ 0 หรือ 1 แถว
-    err := db.QueryRow("SELECT id, title, author FROM books WHERE id = $1", id).Scan(&book.ID, &book.Title, &book.Author)
+	book, err := loadBook(c.Request.Context(), id)
+	if err == nil && book.Status != statusPublished && !canSeeUnpublished(c) {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
 
-    if err == sql.ErrNoRows {
-        c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
-        return
-    } else if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
-    }
+	// เก็บการเปิดดูไว้คำนวณ "also viewed"
+	if userID := c.GetInt("user_id"); userID > 0 && book.Status == statusPublished {
+		go recordBookView(userID, id)
+	}
 
-    c.JSON(http.StatusOK, book)
+	respondCached(c, book, book.lastModified())
 }
 
 func createBook(c *gin.Context) {
     var newBook Book
 
-    if err := c.ShouldBindJSON(&newBook); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-        return
+    if !bindJSON(c, &newBook) {
+    	return
     }
 
+    normalizeBookISBN(&newBook)
+
     // ใช้ RETURNING เพื่อดึงค่าที่ database generate (id, timestamps)
+    // หนังสือใหม่เริ่มที่ draft เสมอ ต้องผ่าน workflow ก่อนเผยแพร่
     var id int
     var createdAt, updatedAt time.Time
 
-    err := db.QueryRow(
-        `INSERT INTO books (title, author, isbn, year, price)
-         VALUES ($1, $2, $3, $4, $5)
+    tx, err := db.Begin()
+    if err != nil {
+        respondInternalError(c, err)
+        return
+    }
+    defer tx.Rollback()
+
+    err = tx.QueryRow(
+        `INSERT INTO books (title, author, isbn, year, price, original_price, discount, cover_image, status)
+         VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
          RETURNING id, created_at, updated_at`,
         newBook.Title, newBook.Author, newBook.ISBN, newBook.Year, newBook.Price,
+        newBook.OriginalPrice, newBook.Discount, newBook.CoverImage, statusDraft,
     ).Scan(&id, &createdAt, &updatedAt)
 
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if isUniqueViolation(err) {
+        respondProblemWith(c, Problem{
+            Status: http.StatusConflict,
+            Code:   codeConflict,
+            Detail: "a book with this isbn already exists",
+            Errors: []FieldError{{Field: "isbn", Code: fieldDuplicate, Message: "already exists"}},
+        })
+        return
+    } else if err != nil {
+        respondInternalError(c, err)
         return
     }
 
     newBook.ID = id
+    if err := applyBookRelations(tx, &newBook); err != nil {
+        respondRelationError(c, err)
+        return
+    }
+    if err := tx.Commit(); err != nil {
+        respondInternalError(c, err)
+        return
+    }
+
+    newBook.Status = statusDraft
+    newBook.PublishedAt = nil
+    newBook.ScheduledAt = nil
     newBook.CreatedAt = createdAt
     newBook.UpdatedAt = updatedAt
+	bookCache.invalidate(newBook.ID)
 
 	// Log audit
 	userID := c.GetInt("user_id")
+	bookChangesTotal.WithLabelValues("created").Inc()
 	logAudit(userID, "create", "books", newBook.ID, gin.H{
 		"title":  newBook.Title,
 		"author": newBook.Author,
@@ -610,33 +813,62 @@ func updateBook(c *gin.Context) {
     id := c.Param("id")
     var updateBook Book
 
-    if err := c.ShouldBindJSON(&updateBook); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    if !bindJSON(c, &updateBook) {
+    	return
+    }
+
+    normalizeBookISBN(&updateBook)
+
+    tx, err := db.Begin()
+    if err != nil {
+        respondInternalError(c, err)
         return
     }
+    defer tx.Rollback()
 
     var updatedAt time.Time
-    err := db.QueryRow(
+    err = tx.QueryRow(
         `UPDATE books
-         SET title = $1, author = $2, isbn = $3, year = $4, price = $5
-         WHERE id = $6
+         SET title = $1, author = $2, isbn = $3, year = $4, price = $5,
+             original_price = $6, discount = $7, cover_image = $8
+         WHERE id = $9 AND deleted_at IS NULL
          RETURNING id, updated_at`,
         updateBook.Title, updateBook.Author, updateBook.ISBN,
-        updateBook.Year, updateBook.Price, id,
+        updateBook.Year, updateBook.Price,
+        updateBook.OriginalPrice, updateBook.Discount, updateBook.CoverImage, id,
     ).Scan(&ID, &updatedAt)
 
     if err == sql.ErrNoRows {
-        c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+        respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+        return
+    } else if isUniqueViolation(err) {
+        respondProblemWith(c, Problem{
+            Status: http.StatusConflict,
+            Code:   codeConflict,
+            Detail: "a book with this isbn already exists",
+            Errors: []FieldError{{Field: "isbn", Code: fieldDuplicate, Message: "already exists"}},
+        })
         return
     } else if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondInternalError(c, err)
         return
     }
 	updateBook.ID = ID
+	if err := applyBookRelations(tx, &updateBook); err != nil {
+		respondRelationError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
 	updateBook.UpdatedAt = updatedAt
+	bookCache.invalidate(updateBook.ID)
 
 	// Log audit
 	userID := c.GetInt("user_id")
+	bookChangesTotal.WithLabelValues("updated").Inc()
 	logAudit(userID, "update", "books", updateBook.ID, gin.H{
 		"title":  updateBook.Title,
 		"author": updateBook.Author,
@@ -648,28 +880,34 @@ func updateBook(c *gin.Context) {
 func deleteBook(c *gin.Context) {
     id := c.Param("id")
 
-    result, err := db.Exec("DELETE FROM books WHERE id = $1", id)
+    // Soft delete: ย้ายไปถังขยะ ลบถาวรทำผ่าน purge เท่านั้น
+    result, err := db.Exec("UPDATE books SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL", id)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondInternalError(c, err)
         return
     }
 
     rowsAffected, err := result.RowsAffected()
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondInternalError(c, err)
         return
     }
 
     if rowsAffected == 0 {
-        c.JSON(http.StatusNotFound, gin.H{"error": "book not found"})
+        respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
         return
     }
 
+	if bookID, err := strconv.Atoi(id); err == nil {
+		bookCache.invalidate(bookID)
+	}
+
 	// Log audit
 	userID := c.GetInt("user_id")
+	bookChangesTotal.WithLabelValues("deleted").Inc()
 	logAudit(userID, "delete", "books", id, nil, c)
 
-    c.JSON(http.StatusOK, gin.H{"message": "book deleted successfully"})
+    c.JSON(http.StatusOK, gin.H{"message": "book moved to trash"})
 }
 
 // @title           Bookstore API with Authentication
@@ -678,25 +916,64 @@ func deleteBook(c *gin.Context) {
 // @host            localhost:8080
 // @BasePath        /api/v1
 func main() {
-	initDB()
-	defer db.Close()
+	loadConfig()
+	if runCLI(os.Args[1:]) {
+		return
+	}
+	shutdownTracing := initTracing()
 
-	r := gin.Default()
-	r.Use(cors.Default())
+	initDB()
+	initBookCache()
+	initValidation()
+	initPricing()
+	initPayments()
+	initCovers()
+	initHealthChecks()
+	initMetrics()
+	jobs := newBackgroundJobs()
+	jobs.Go(runTrashPurger)
+	jobs.Go(runScheduledPublisher)
+	jobs.Go(runGuestCartPurger)
+	jobs.Go(runWishlistWatcher)
+	jobs.Go(runRecommender)
+	jobs.Go(runReportRefresher)
+
+	// gin.New แทน gin.Default: ใช้ access log / recovery ของเราเอง (JSON + redaction)
+	r := gin.New()
+	r.Use(requestIDMiddleware())
+	r.Use(accessLogMiddleware())
+	// tracing / metrics ต้องอยู่นอก recovery ไม่งั้น panic ข้ามโค้ดหลัง c.Next() และ 500 ไม่ถูกนับ
+	r.Use(tracingMiddleware())
+	r.Use(metricsMiddleware())
+	r.Use(recoveryMiddleware())
+	// เหมือน cors.Default() แต่ให้ frontend อ่าน X-Request-ID ได้ (อ้างอิงตอนแจ้งปัญหา)
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowAllOrigins = true
+	corsConfig.ExposeHeaders = []string{requestIDHeader}
+	r.Use(cors.New(corsConfig))
+	r.Use(handlerSpanMiddleware())
 
 	// ===================== Public Endpoints =====================
 	// Swagger documentation
 	r.GET("/docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	// Health check endpoint (for Docker healthcheck)
-	r.GET("/health", func(c *gin.Context){
-		err := db.Ping()
-		if err != nil {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"message":"unhealthy", "error":err.Error()})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{"message" : "healthy"})
-	})
+	// Liveness / readiness (for Docker healthcheck, load balancers)
+	// ส่ง Bearer token ของผู้มีสิทธิ์ health:read เพื่อดูผลของแต่ละ check
+	r.GET("/livez", livez)
+	r.GET("/readyz", optionalAuthMiddleware(), readyz)
+	r.GET("/health", optionalAuthMiddleware(), readyz) // ชื่อเดิม
+
+	// Prometheus (ถ้าตั้ง METRICS_TOKEN ต้องส่งเป็น Bearer token)
+	r.GET("/metrics", metricsHandler())
+
+	// Payment provider webhooks (ยืนยันตัวตนด้วยลายเซ็นของ provider)
+	r.POST("/webhooks/payments/:provider", paymentWebhook)
+
+	// Cover images (public เพื่อให้ใช้ใน <img> ได้โดยไม่ต้องมี token)
+	r.GET("/covers/:book_id/:hash/:size", serveCover)
+
+	// Shared wishlists (unlisted/public) เปิดด้วยลิงก์ ไม่ต้อง login
+	r.GET("/shared/wishlists/:token", cacheControl(cachePolicyNone), getSharedWishlist)
 
 	// ===================== Authentication Endpoints =====================
 	auth := r.Group("/auth")
@@ -706,6 +983,20 @@ func main() {
 		auth.POST("/logout", logout)         // Logout และ revoke token
 	}
 
+	// ===================== Cart Endpoints =====================
+	// guest ใช้ได้โดยไม่ต้อง login (ระบุตัวด้วย cookie cart_token)
+	cart := r.Group("/api/v1/cart")
+	cart.Use(optionalAuthMiddleware(), cacheControl(cachePolicyNone))
+	{
+		cart.GET("", getCart)
+		cart.DELETE("", clearCart)
+		cart.POST("/items", addCartItem)
+		cart.PUT("/items/:book_id", updateCartItem)
+		cart.DELETE("/items/:book_id", removeCartItem)
+		cart.PUT("/coupon", applyCartCoupon)
+		cart.DELETE("/coupon", removeCartCoupon)
+	}
+
 	// ===================== Protected API Endpoints =====================
 	api := r.Group("/api/v1")
 	api.Use(authMiddleware()) // ทุก endpoint ต้อง authenticate
@@ -713,24 +1004,529 @@ func main() {
 		// Books endpoints with permission checks
 		api.GET("/books",
 			requirePermission("books:read"),
+			cacheControl(cachePolicyList),
 			getAllBooks)
 
+		// ?update=true เขียนทับเล่มที่ ISBN ซ้ำ ต้องมี books:update ด้วย (ตรวจใน handler)
+		api.POST("/books/import",
+			bulkTransfer(),
+			requirePermission("books:create"),
+			cacheControl(cachePolicyNone),
+			importBooksHandler)
+
+		api.GET("/books/export",
+			bulkTransfer(),
+			requirePermission("books:read"),
+			cacheControl(cachePolicyNone),
+			exportBooks)
+
+		api.GET("/books/featured",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyList),
+			getFeaturedBooks)
+
+		api.GET("/books/by-isbn/:isbn",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyDetail),
+			getBookByISBN)
+
+		api.GET("/books/trash",
+			requirePermission("books:delete"),
+			cacheControl(cachePolicyNone),
+			getTrashedBooks)
+
 		api.GET("/books/:id",
 			requirePermission("books:read"),
+			cacheControl(cachePolicyDetail),
 			getBook)
 
 		api.POST("/books",
 			requirePermission("books:create"),
+			cacheControl(cachePolicyNone),
 			createBook)
 
 		api.PUT("/books/:id",
 			requirePermission("books:update"),
+			cacheControl(cachePolicyNone),
 			updateBook)
 
 		api.DELETE("/books/:id",
 			requirePermission("books:delete"),
+			cacheControl(cachePolicyNone),
 			deleteBook)
+
+		// Publishing workflow
+		api.POST("/books/:id/submit",
+			requirePermission("books:update"),
+			cacheControl(cachePolicyNone),
+			transitionBook(actionSubmit))
+
+		api.POST("/books/:id/publish",
+			requirePermission("books:publish"),
+			cacheControl(cachePolicyNone),
+			publishBook)
+
+		api.POST("/books/:id/reject",
+			requirePermission("books:publish"),
+			cacheControl(cachePolicyNone),
+			transitionBook(actionReject))
+
+		api.POST("/books/:id/archive",
+			requirePermission("books:publish"),
+			cacheControl(cachePolicyNone),
+			transitionBook(actionArchive))
+
+		api.POST("/books/:id/unarchive",
+			requirePermission("books:publish"),
+			cacheControl(cachePolicyNone),
+			transitionBook(actionUnarchive))
+
+		api.POST("/books/:id/restore",
+			requirePermission("books:delete"),
+			cacheControl(cachePolicyNone),
+			restoreBook)
+
+		api.DELETE("/books/:id/permanent",
+			requirePermission("books:purge"),
+			cacheControl(cachePolicyNone),
+			purgeBook)
+
+		// Cover images
+		api.POST("/books/:id/cover",
+			requirePermission("books:update"),
+			cacheControl(cachePolicyNone),
+			uploadBookCover)
+
+		api.GET("/books/:id/cover",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyDetail),
+			getBookCover)
+
+		api.DELETE("/books/:id/cover",
+			requirePermission("books:update"),
+			cacheControl(cachePolicyNone),
+			deleteBookCover)
+
+		// Orders
+		api.POST("/orders",
+			requirePermission("orders:place"),
+			cacheControl(cachePolicyNone),
+			createOrder)
+
+		api.GET("/orders",
+			requirePermission("orders:place"),
+			cacheControl(cachePolicyNone),
+			getOrders)
+
+		// เจ้าของ order หรือผู้มี orders:read (ตรวจใน handler)
+		api.GET("/orders/:id",
+			cacheControl(cachePolicyNone),
+			getOrder)
+
+		api.POST("/orders/:id/cancel",
+			requirePermission("orders:place"),
+			cacheControl(cachePolicyNone),
+			cancelOrder)
+
+		api.POST("/orders/:id/pay",
+			requirePermission("orders:update"),
+			cacheControl(cachePolicyNone),
+			orderTransitionHandler(orderActionPay))
+
+		api.POST("/orders/:id/ship",
+			requirePermission("orders:update"),
+			cacheControl(cachePolicyNone),
+			orderTransitionHandler(orderActionShip))
+
+		api.POST("/orders/:id/deliver",
+			requirePermission("orders:update"),
+			cacheControl(cachePolicyNone),
+			orderTransitionHandler(orderActionDeliver))
+
+		// Pricing: currencies, exchange rates & price lists
+		api.GET("/books/:id/price",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyNone),
+			getBookPrice)
+
+		api.GET("/books/:id/prices",
+			requirePermission("pricing:manage"),
+			cacheControl(cachePolicyNone),
+			getBookPriceList)
+
+		api.PUT("/books/:id/prices/:currency",
+			requirePermission("pricing:manage"),
+			cacheControl(cachePolicyNone),
+			putBookPrice)
+
+		api.DELETE("/books/:id/prices/:currency",
+			requirePermission("pricing:manage"),
+			cacheControl(cachePolicyNone),
+			deleteBookPrice)
+
+		api.GET("/fx-rates",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyList),
+			getFXRates)
+
+		api.PUT("/fx-rates/:currency",
+			requirePermission("pricing:manage"),
+			cacheControl(cachePolicyNone),
+			putFXRate)
+
+		api.DELETE("/fx-rates/:currency",
+			requirePermission("pricing:manage"),
+			cacheControl(cachePolicyNone),
+			deleteFXRate)
+
+		// Promotions & coupons
+		api.GET("/promotions",
+			requirePermission("promotions:manage"),
+			cacheControl(cachePolicyNone),
+			getPromotions)
+
+		api.GET("/promotions/:id",
+			requirePermission("promotions:manage"),
+			cacheControl(cachePolicyNone),
+			getPromotion)
+
+		api.POST("/promotions",
+			requirePermission("promotions:manage"),
+			cacheControl(cachePolicyNone),
+			createPromotion)
+
+		api.PUT("/promotions/:id",
+			requirePermission("promotions:manage"),
+			cacheControl(cachePolicyNone),
+			updatePromotion)
+
+		api.DELETE("/promotions/:id",
+			requirePermission("promotions:manage"),
+			cacheControl(cachePolicyNone),
+			deletePromotion)
+
+		// Payments
+		api.POST("/orders/:id/payments",
+			requirePermission("orders:place"),
+			cacheControl(cachePolicyNone),
+			createPayment)
+
+		// เจ้าของ order หรือผู้มี orders:read (ตรวจใน handler)
+		api.GET("/orders/:id/payments",
+			cacheControl(cachePolicyNone),
+			getOrderPayments)
+
+		api.POST("/payments/:id/capture",
+			requirePermission("orders:update"),
+			cacheControl(cachePolicyNone),
+			capturePayment)
+
+		api.POST("/payments/:id/refund",
+			requirePermission("orders:update"),
+			cacheControl(cachePolicyNone),
+			refundPayment)
+
+		// ใช้ได้เฉพาะเมื่อเปิด fake provider (PAYMENT_FAKE_SECRET)
+		api.POST("/payments/:id/simulate",
+			requirePermission("orders:update"),
+			cacheControl(cachePolicyNone),
+			simulatePayment)
+
+		// Inventory
+		api.GET("/books/:id/stock",
+			requirePermission("inventory:read"),
+			cacheControl(cachePolicyNone),
+			getBookStock)
+
+		api.PUT("/books/:id/stock/threshold",
+			requirePermission("inventory:manage"),
+			cacheControl(cachePolicyNone),
+			updateStockThreshold)
+
+		api.GET("/books/:id/stock/movements",
+			requirePermission("inventory:read"),
+			cacheControl(cachePolicyNone),
+			getStockMovements)
+
+		api.POST("/books/:id/stock/movements",
+			requirePermission("inventory:manage"),
+			cacheControl(cachePolicyNone),
+			createStockMovement)
+
+		api.GET("/inventory/low-stock",
+			requirePermission("inventory:read"),
+			cacheControl(cachePolicyNone),
+			getLowStockReport)
+
+		// Reviews
+		api.GET("/books/:id/reviews",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyList),
+			getBookReviews)
+
+		api.POST("/books/:id/reviews",
+			requirePermission("reviews:write"),
+			cacheControl(cachePolicyNone),
+			createReview)
+
+		api.PUT("/reviews/:id",
+			requirePermission("reviews:write"),
+			cacheControl(cachePolicyNone),
+			updateReview)
+
+		api.DELETE("/reviews/:id",
+			requirePermission("reviews:write"),
+			cacheControl(cachePolicyNone),
+			deleteReview)
+
+		api.POST("/reviews/:id/moderate",
+			requirePermission("reviews:moderate"),
+			cacheControl(cachePolicyNone),
+			moderateReview)
+
+		api.PUT("/reviews/:id/vote",
+			requirePermission("reviews:write"),
+			cacheControl(cachePolicyNone),
+			voteReview)
+
+		api.DELETE("/reviews/:id/vote",
+			requirePermission("reviews:write"),
+			cacheControl(cachePolicyNone),
+			deleteReviewVote)
+
+		// Recommendations (คำนวณล่วงหน้าโดย job เป็นระยะ)
+		api.GET("/books/:id/recommendations",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyList),
+			getBookRecommendations)
+
+		api.GET("/recommendations",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyList),
+			getMyRecommendations)
+
+		api.POST("/recommendations/refresh",
+			requirePermission("recommendations:manage"),
+			cacheControl(cachePolicyNone),
+			refreshRecommendations)
+
+		// Wishlists & reading lists (เจ้าของแก้ไขได้คนเดียว ตรวจใน handler)
+		api.GET("/wishlists",
+			requirePermission("wishlists:manage"),
+			cacheControl(cachePolicyNone),
+			getMyWishlists)
+
+		api.POST("/wishlists",
+			requirePermission("wishlists:manage"),
+			cacheControl(cachePolicyNone),
+			createWishlist)
+
+		api.GET("/wishlists/public",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyList),
+			getPublicWishlists)
+
+		api.GET("/wishlists/alerts",
+			requirePermission("wishlists:manage"),
+			cacheControl(cachePolicyNone),
+			getWishlistAlerts)
+
+		api.POST("/wishlists/alerts/read",
+			requirePermission("wishlists:manage"),
+			cacheControl(cachePolicyNone),
+			markWishlistAlertsRead)
+
+		api.POST("/wishlists/alerts/:alert_id/read",
+			requirePermission("wishlists:manage"),
+			cacheControl(cachePolicyNone),
+			markWishlistAlertsRead)
+
+		api.GET("/wishlists/:id",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyNone),
+			getWishlist)
+
+		api.PUT("/wishlists/:id",
+			requirePermission("wishlists:manage"),
+			cacheControl(cachePolicyNone),
+			updateWishlist)
+
+		api.DELETE("/wishlists/:id",
+			requirePermission("wishlists:manage"),
+			cacheControl(cachePolicyNone),
+			deleteWishlist)
+
+		api.POST("/wishlists/:id/share-link",
+			requirePermission("wishlists:manage"),
+			cacheControl(cachePolicyNone),
+			rotateWishlistShareLink)
+
+		api.POST("/wishlists/:id/items",
+			requirePermission("wishlists:manage"),
+			cacheControl(cachePolicyNone),
+			addWishlistItem)
+
+		api.PUT("/wishlists/:id/items/:book_id",
+			requirePermission("wishlists:manage"),
+			cacheControl(cachePolicyNone),
+			updateWishlistItem)
+
+		api.DELETE("/wishlists/:id/items/:book_id",
+			requirePermission("wishlists:manage"),
+			cacheControl(cachePolicyNone),
+			removeWishlistItem)
+
+		api.PUT("/wishlists/:id/order",
+			requirePermission("wishlists:manage"),
+			cacheControl(cachePolicyNone),
+			reorderWishlist)
+
+		// Reports (อ่านจาก materialized view ที่ refresh เป็นระยะ; ?format=csv เพื่อดาวน์โหลด)
+		api.GET("/reports/revenue",
+			requirePermission("reports:financial"),
+			cacheControl(cachePolicyNone),
+			getRevenueReport)
+
+		api.GET("/reports/sales-by-category",
+			requirePermission("reports:financial"),
+			cacheControl(cachePolicyNone),
+			getSalesByCategoryReport)
+
+		api.GET("/reports/sales-by-author",
+			requirePermission("reports:financial"),
+			cacheControl(cachePolicyNone),
+			getSalesByAuthorReport)
+
+		api.GET("/reports/inventory-valuation",
+			requirePermission("reports:financial"),
+			cacheControl(cachePolicyNone),
+			getInventoryValuationReport)
+
+		api.GET("/reports/top-sellers",
+			requirePermission("reports:analytics"),
+			cacheControl(cachePolicyNone),
+			getTopSellersReport)
+
+		api.GET("/reports/logins",
+			requirePermission("reports:analytics"),
+			cacheControl(cachePolicyNone),
+			getLoginReport)
+
+		api.GET("/reports/activity",
+			requirePermission("reports:analytics"),
+			cacheControl(cachePolicyNone),
+			getActivityReport)
+
+		api.POST("/reports/refresh",
+			requirePermission("reports:analytics"),
+			cacheControl(cachePolicyNone),
+			refreshReports)
+
+		// Authors, publishers, categories (ใช้สิทธิ์ชุดเดียวกับ books)
+		api.GET("/authors",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyList),
+			getAuthors)
+
+		api.GET("/authors/:id",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyDetail),
+			getAuthor)
+
+		api.GET("/authors/:id/books",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyList),
+			getBooksByAuthor)
+
+		api.POST("/authors",
+			requirePermission("books:create"),
+			cacheControl(cachePolicyNone),
+			createAuthor)
+
+		api.PUT("/authors/:id",
+			requirePermission("books:update"),
+			cacheControl(cachePolicyNone),
+			updateAuthor)
+
+		api.DELETE("/authors/:id",
+			requirePermission("books:delete"),
+			cacheControl(cachePolicyNone),
+			deleteAuthor)
+
+		api.GET("/publishers",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyList),
+			getPublishers)
+
+		api.GET("/publishers/:id",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyDetail),
+			getPublisher)
+
+		api.GET("/publishers/:id/books",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyList),
+			getBooksByPublisher)
+
+		api.POST("/publishers",
+			requirePermission("books:create"),
+			cacheControl(cachePolicyNone),
+			createPublisher)
+
+		api.PUT("/publishers/:id",
+			requirePermission("books:update"),
+			cacheControl(cachePolicyNone),
+			updatePublisher)
+
+		api.DELETE("/publishers/:id",
+			requirePermission("books:delete"),
+			cacheControl(cachePolicyNone),
+			deletePublisher)
+
+		api.GET("/categories",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyList),
+			getCategories)
+
+		api.GET("/categories/:id",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyDetail),
+			getCategory)
+
+		api.GET("/categories/:id/books",
+			requirePermission("books:read"),
+			cacheControl(cachePolicyList),
+			getBooksByCategory)
+
+		api.POST("/categories",
+			requirePermission("books:create"),
+			cacheControl(cachePolicyNone),
+			createCategory)
+
+		api.PUT("/categories/:id",
+			requirePermission("books:update"),
+			cacheControl(cachePolicyNone),
+			updateCategory)
+
+		api.DELETE("/categories/:id",
+			requirePermission("books:delete"),
+			cacheControl(cachePolicyNone),
+			deleteCategory)
 	}
 
-	r.Run(":8080")
+	// รอ request ที่ค้างอยู่และงานเบื้องหลังที่กำลังรันให้เสร็จก่อนปิด database (SIGINT/SIGTERM)
+	err := runServer(r)
+	jobsCtx, cancelJobs := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	if err := jobs.Stop(jobsCtx); err != nil {
+		slog.Warn("background jobs still running at shutdown", "error", err)
+	}
+	cancelJobs()
+	db.Close()
+	if err := shutdownTracing(context.Background()); err != nil {
+		slog.Error("error flushing traces", "error", err)
+	}
+	if err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+	slog.Info("server stopped")
 }
\ No newline at end of file
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ===================== Metrics =====================
+
+const metricsNamespace = "bookstore"
+
+// metricsRegistry is separate from prometheus.DefaultRegisterer so only
+// the metrics registered here are exported.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route template and status code.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"method", "route", "status"})
+
+	httpRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests currently being served.",
+	})
+
+	// result: succeeded | failed
+	loginsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "auth_logins_total",
+		Help:      "Login attempts by result.",
+	}, []string{"result"})
+
+	// event: refreshed | revoked
+	tokensTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "auth_tokens_total",
+		Help:      "Access tokens issued from refresh tokens and refresh tokens revoked.",
+	}, []string{"event"})
+
+	permissionDenialsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "auth_permission_denials_total",
+		Help:      "Requests rejected by requirePermission, by required permission.",
+	}, []string{"permission"})
+
+	// action: created | updated | deleted
+	bookChangesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "books_changes_total",
+		Help:      "Book changes by action: created, updated, deleted, restored, purged (including the trash purger), status_changed (publishing workflow, including scheduled publishing) and price_changed (per-currency prices). Bulk imports count as created/updated.",
+	}, []string{"action"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestsTotal,
+		httpRequestDuration,
+		httpRequestsInFlight,
+		loginsTotal,
+		tokensTotal,
+		permissionDenialsTotal,
+		bookChangesTotal,
+	)
+
+	// ให้ label มีค่าตั้งแต่เริ่ม แม้ยังไม่มีเหตุการณ์
+	for _, r := range []string{"succeeded", "failed"} {
+		loginsTotal.WithLabelValues(r)
+	}
+	for _, e := range []string{"refreshed", "revoked"} {
+		tokensTotal.WithLabelValues(e)
+	}
+	for _, a := range []string{"created", "updated", "deleted", "restored", "purged", "status_changed", "price_changed"} {
+		bookChangesTotal.WithLabelValues(a)
+	}
+}
+
+// initMetrics registers the sql.DBStats of the pool opened by initDB
+// (open/in-use/idle connections, wait count and duration, closed connections).
+func initMetrics() {
+	metricsRegistry.MustRegister(collectors.NewDBStatsCollector(db, "postgres"))
+}
+
+// metricsMiddleware records every request under its route template
+// (e.g. /api/v1/books/:id) so IDs do not create new series.
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched" // 404 ไม่แยกตาม path
+		}
+		labels := prometheus.Labels{
+			"method": c.Request.Method,
+			"route":  route,
+			"status": strconv.Itoa(c.Writer.Status()),
+		}
+		httpRequestsTotal.With(labels).Inc()
+		httpRequestDuration.With(labels).Observe(time.Since(start).Seconds())
+	}
+}
+
+// metricsHandler serves the Prometheus text format. When METRICS_TOKEN is
+// set, scrapers must send it as a bearer token.
+func metricsHandler() gin.HandlerFunc {
+	h := promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+	return func(c *gin.Context) {
+		if token := cfg.Server.MetricsToken; token != "" {
+			got := c.GetHeader("Authorization")
+			if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+token)) != 1 {
+				respondProblem(c, http.StatusUnauthorized, codeUnauthorized, "metrics token required")
+				return
+			}
+		}
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,59 @@
+-- 13. Reviews และ rating ของหนังสือ
+-- rating/reviews_count บน books เป็นค่าสรุปที่ Go คำนวณใหม่ใน transaction เดียวกับการเขียน review
+ALTER TABLE books ADD COLUMN IF NOT EXISTS rating DECIMAL(3,2);
+ALTER TABLE books ADD COLUMN IF NOT EXISTS reviews_count INTEGER;
+UPDATE books SET rating = 0 WHERE rating IS NULL;
+UPDATE books SET reviews_count = 0 WHERE reviews_count IS NULL;
+ALTER TABLE books ALTER COLUMN rating SET DEFAULT 0;
+ALTER TABLE books ALTER COLUMN rating SET NOT NULL;
+ALTER TABLE books ALTER COLUMN reviews_count SET DEFAULT 0;
+ALTER TABLE books ALTER COLUMN reviews_count SET NOT NULL;
+
+CREATE TABLE IF NOT EXISTS reviews (
+    id SERIAL PRIMARY KEY,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    title VARCHAR(200) NOT NULL DEFAULT '',
+    body TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'published' CHECK (status IN ('published', 'hidden')),
+    helpful_count INTEGER NOT NULL DEFAULT 0,
+    unhelpful_count INTEGER NOT NULL DEFAULT 0,
+    moderated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    moderated_at TIMESTAMP WITH TIME ZONE,
+    moderation_note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    -- ไม่ใช้ trigger: โหวต helpful ไม่ควรทำให้ review ดูเหมือนถูกแก้ไข
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (book_id, user_id)  -- หนึ่งคนหนึ่ง review ต่อเล่ม
+);
+
+CREATE INDEX IF NOT EXISTS idx_reviews_book ON reviews(book_id, status);
+CREATE INDEX IF NOT EXISTS idx_reviews_user ON reviews(user_id);
+
+CREATE TABLE IF NOT EXISTS review_votes (
+    review_id INTEGER NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    helpful BOOLEAN NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (review_id, user_id)
+);
+
+-- Permissions
+INSERT INTO permissions (name, description, resource, action) VALUES
+('reviews:write', 'Can write, edit and vote on own reviews', 'reviews', 'write'),
+('reviews:moderate', 'Can hide, restore and delete any review', 'reviews', 'moderate')
+ON CONFLICT (name) DO NOTHING;
+
+-- ทุก role ที่ login ได้เขียน review ได้ ยกเว้น viewer (read-only)
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('admin', 'editor', 'user') AND p.name = 'reviews:write'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('admin', 'editor') AND p.name = 'reviews:moderate'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,66 @@
+-- 14. Inventory: จำนวนคงคลังและยอดที่จองไว้ต่อเล่ม
+CREATE TABLE IF NOT EXISTS stock (
+    book_id INTEGER PRIMARY KEY REFERENCES books(id) ON DELETE CASCADE,
+    on_hand INTEGER NOT NULL DEFAULT 0 CHECK (on_hand >= 0),
+    reserved INTEGER NOT NULL DEFAULT 0 CHECK (reserved >= 0),
+    low_stock_threshold INTEGER NOT NULL DEFAULT 5 CHECK (low_stock_threshold >= 0),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (reserved <= on_hand)
+);
+
+DROP TRIGGER IF EXISTS update_stock_modtime ON stock;
+CREATE TRIGGER update_stock_modtime BEFORE UPDATE ON stock
+FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+
+-- หนังสือทุกเล่มมีแถว stock เสมอ (รวมเล่มที่มาจาก import)
+INSERT INTO stock (book_id) SELECT id FROM books ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION create_book_stock() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO stock (book_id) VALUES (NEW.id) ON CONFLICT DO NOTHING;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS create_book_stock ON books;
+CREATE TRIGGER create_book_stock AFTER INSERT ON books
+FOR EACH ROW EXECUTE FUNCTION create_book_stock();
+
+-- Ledger ของการเปลี่ยน on_hand (append-only)
+-- ไม่มี FK ไปที่ books: ประวัติต้องอยู่ต่อแม้หนังสือถูก purge
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id BIGSERIAL PRIMARY KEY,
+    book_id INTEGER NOT NULL,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('receive', 'sell', 'adjust', 'return')),
+    quantity INTEGER NOT NULL CHECK (quantity <> 0),  -- + เข้า, - ออก
+    on_hand_after INTEGER NOT NULL,
+    reference VARCHAR(100) NOT NULL DEFAULT '',        -- เช่น order:42, PO-2024-001
+    note TEXT NOT NULL DEFAULT '',
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_movements_book ON stock_movements(book_id, created_at DESC);
+
+CREATE OR REPLACE FUNCTION reject_stock_movement_change() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'stock_movements is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS stock_movements_append_only ON stock_movements;
+CREATE TRIGGER stock_movements_append_only BEFORE UPDATE OR DELETE ON stock_movements
+FOR EACH ROW EXECUTE FUNCTION reject_stock_movement_change();
+
+-- Permissions
+INSERT INTO permissions (name, description, resource, action) VALUES
+('inventory:read', 'Can view stock levels and movements', 'inventory', 'read'),
+('inventory:manage', 'Can receive, adjust and return stock', 'inventory', 'manage')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE (r.name = 'admin' AND p.name IN ('inventory:read', 'inventory:manage'))
+   OR (r.name IN ('editor', 'viewer') AND p.name = 'inventory:read')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,21 @@
+-- 15. Shopping cart
+-- ตะกร้าของ user (user_id) หรือของ guest (guest_token จาก cookie) อย่างใดอย่างหนึ่ง
+CREATE TABLE IF NOT EXISTS carts (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    guest_token VARCHAR(64) UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((user_id IS NULL) <> (guest_token IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_carts_guest_updated ON carts(updated_at) WHERE guest_token IS NOT NULL;
+
+-- เก็บแค่จำนวน ราคาคำนวณจาก books ทุกครั้งที่อ่านตะกร้า
+CREATE TABLE IF NOT EXISTS cart_items (
+    cart_id INTEGER NOT NULL REFERENCES carts(id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity BETWEEN 1 AND 99),
+    added_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (cart_id, book_id)
+);
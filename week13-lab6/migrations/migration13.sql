@@ -0,0 +1,60 @@
+-- 16. Orders
+-- pending -> paid -> shipped -> delivered, pending/paid -> cancelled
+CREATE TABLE IF NOT EXISTS orders (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'paid', 'shipped', 'delivered', 'cancelled')),
+    subtotal DECIMAL(10,2) NOT NULL CHECK (subtotal >= 0),
+    discount_total DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (discount_total >= 0),
+    total DECIMAL(10,2) NOT NULL CHECK (total >= 0),
+    shipping_address TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    tracking_number VARCHAR(100) NOT NULL DEFAULT '',
+    cancel_reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    paid_at TIMESTAMP WITH TIME ZONE,
+    shipped_at TIMESTAMP WITH TIME ZONE,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    cancelled_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_user ON orders(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status, created_at DESC);
+
+DROP TRIGGER IF EXISTS update_orders_modtime ON orders;
+CREATE TRIGGER update_orders_modtime BEFORE UPDATE ON orders
+FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+
+-- snapshot ของหนังสือและราคา ณ ตอนสั่งซื้อ ไม่เปลี่ยนตาม books ภายหลัง
+CREATE TABLE IF NOT EXISTS order_items (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    book_id INTEGER REFERENCES books(id) ON DELETE SET NULL,
+    title VARCHAR(255) NOT NULL,
+    isbn VARCHAR(20) NOT NULL DEFAULT '',
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    list_price DECIMAL(10,2) NOT NULL,
+    unit_price DECIMAL(10,2) NOT NULL,
+    discount INTEGER NOT NULL DEFAULT 0,
+    line_total DECIMAL(10,2) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_items_order ON order_items(order_id);
+CREATE INDEX IF NOT EXISTS idx_order_items_book ON order_items(book_id);
+
+-- Permissions
+INSERT INTO permissions (name, description, resource, action) VALUES
+('orders:place', 'Can check out and manage own orders', 'orders', 'place'),
+('orders:read', 'Can view all orders', 'orders', 'read'),
+('orders:update', 'Can mark orders paid, shipped, delivered or cancelled', 'orders', 'update')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE (r.name IN ('admin', 'editor', 'user') AND p.name = 'orders:place')
+   OR (r.name IN ('admin', 'editor', 'viewer') AND p.name = 'orders:read')
+   OR (r.name = 'admin' AND p.name = 'orders:update')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,38 @@
+-- 17. Payments
+-- จำนวนเงินเก็บเป็นหน่วยย่อย (สตางค์) ตามที่ส่งให้ payment provider
+CREATE TABLE IF NOT EXISTS payments (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    provider VARCHAR(30) NOT NULL,
+    provider_intent_id VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL
+        CHECK (status IN ('requires_action', 'authorized', 'succeeded', 'failed', 'refunded')),
+    amount_minor BIGINT NOT NULL CHECK (amount_minor > 0),
+    currency CHAR(3) NOT NULL DEFAULT 'THB',
+    refunded_minor BIGINT NOT NULL DEFAULT 0 CHECK (refunded_minor >= 0),
+    client_secret VARCHAR(200) NOT NULL DEFAULT '',
+    qr_payload TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    succeeded_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, provider_intent_id),
+    CONSTRAINT payments_refund_within_amount CHECK (refunded_minor <= amount_minor)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_order ON payments(order_id);
+
+DROP TRIGGER IF EXISTS update_payments_modtime ON payments;
+CREATE TRIGGER update_payments_modtime BEFORE UPDATE ON payments
+FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+
+-- event ที่ประมวลผลแล้ว provider ส่ง event เดิมซ้ำได้ จึงใช้ PK กันทำซ้ำ
+CREATE TABLE IF NOT EXISTS payment_events (
+    provider VARCHAR(30) NOT NULL,
+    event_id VARCHAR(100) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    provider_intent_id VARCHAR(100) NOT NULL,
+    payload JSONB,
+    received_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, event_id)
+);
@@ -0,0 +1,63 @@
+-- 18. Promotions & coupons
+-- code = NULL คือโปรโมชันอัตโนมัติ (ใช้กับทุกตะกร้าที่เข้าเงื่อนไข)
+-- code ไม่ว่างคือคูปองที่ลูกค้าต้องกรอกเอง (ใช้ได้ครั้งละหนึ่งใบ)
+CREATE TABLE IF NOT EXISTS promotions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    code VARCHAR(50),
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('percentage', 'fixed')),
+    value DECIMAL(10,2) NOT NULL CHECK (value > 0),
+    min_subtotal DECIMAL(10,2) NOT NULL DEFAULT 0 CHECK (min_subtotal >= 0),
+    min_quantity INTEGER NOT NULL DEFAULT 0 CHECK (min_quantity >= 0),
+    max_uses INTEGER CHECK (max_uses > 0),
+    max_uses_per_user INTEGER CHECK (max_uses_per_user > 0),
+    category_ids INTEGER[] NOT NULL DEFAULT '{}',
+    author_ids INTEGER[] NOT NULL DEFAULT '{}',
+    priority INTEGER NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ends_at TIMESTAMP WITH TIME ZONE,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (kind <> 'percentage' OR value <= 100),
+    CHECK (ends_at IS NULL OR ends_at > starts_at)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_promotions_code ON promotions(upper(code)) WHERE code IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_promotions_automatic ON promotions(priority DESC, id) WHERE code IS NULL AND active;
+
+DROP TRIGGER IF EXISTS update_promotions_modtime ON promotions;
+CREATE TRIGGER update_promotions_modtime BEFORE UPDATE ON promotions
+FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+
+-- ส่วนลดที่ใช้จริงในแต่ละ order (name/code เป็น snapshot)
+-- การนับสิทธิ์ใช้คูปองไม่นับ order ที่ถูกยกเลิก
+CREATE TABLE IF NOT EXISTS promotion_redemptions (
+    id SERIAL PRIMARY KEY,
+    promotion_id INTEGER NOT NULL REFERENCES promotions(id) ON DELETE RESTRICT,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    name VARCHAR(255) NOT NULL,
+    code VARCHAR(50),
+    amount DECIMAL(10,2) NOT NULL CHECK (amount >= 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (promotion_id, order_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_promotion_redemptions_user ON promotion_redemptions(promotion_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_promotion_redemptions_order ON promotion_redemptions(order_id);
+
+-- คูปองที่ลูกค้ากรอกไว้ในตะกร้า ตรวจใหม่ทุกครั้งที่คำนวณราคา
+ALTER TABLE carts ADD COLUMN IF NOT EXISTS coupon_code VARCHAR(50);
+
+-- Permissions
+INSERT INTO permissions (name, description, resource, action) VALUES
+('promotions:manage', 'Can create and edit coupons and promotions', 'promotions', 'manage')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('admin', 'editor') AND p.name = 'promotions:manage'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,82 @@
+-- 19. Money in minor units, currencies & VAT
+-- ราคาใน books ยังเป็น DECIMAL(10,2) หน่วยบาท (สกุลหลักของร้าน)
+-- ยอดเงินของ order เก็บเป็นหน่วยย่อย (BIGINT) ในสกุลที่ลูกค้าเลือกตอน checkout
+
+-- อัตราแลกเปลี่ยน: rate = จำนวนหน่วยของ currency ต่อ 1 บาท
+CREATE TABLE IF NOT EXISTS fx_rates (
+    currency CHAR(3) PRIMARY KEY CHECK (currency <> 'THB'),
+    rate NUMERIC(18,8) NOT NULL CHECK (rate > 0),
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+DROP TRIGGER IF EXISTS update_fx_rates_modtime ON fx_rates;
+CREATE TRIGGER update_fx_rates_modtime BEFORE UPDATE ON fx_rates
+FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+
+-- price list: ราคาตั้งของหนังสือในสกุลอื่น ใช้แทนการแปลงด้วย fx_rates
+-- ส่วนลด (discount/original_price) ของหนังสือใช้ในสัดส่วนเดียวกัน
+CREATE TABLE IF NOT EXISTS book_prices (
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    currency CHAR(3) NOT NULL CHECK (currency <> 'THB'),
+    amount_minor BIGINT NOT NULL CHECK (amount_minor >= 0),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (book_id, currency)
+);
+
+DROP TRIGGER IF EXISTS update_book_prices_modtime ON book_prices;
+CREATE TRIGGER update_book_prices_modtime BEFORE UPDATE ON book_prices
+FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+
+-- Orders: DECIMAL บาท -> หน่วยย่อย + currency + VAT
+-- rename/แปลงชนิดเฉพาะเมื่อยังเป็นคอลัมน์เดิม เพื่อให้รันไฟล์นี้ซ้ำได้
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'THB';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS fx_rate NUMERIC(18,8) NOT NULL DEFAULT 1;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS vat_rate_bp INTEGER NOT NULL DEFAULT 700;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS prices_include_vat BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS vat_minor BIGINT NOT NULL DEFAULT 0 CHECK (vat_minor >= 0);
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'orders' AND column_name = 'subtotal') THEN
+        ALTER TABLE orders RENAME COLUMN subtotal TO subtotal_minor;
+        ALTER TABLE orders RENAME COLUMN discount_total TO discount_minor;
+        ALTER TABLE orders RENAME COLUMN total TO total_minor;
+        ALTER TABLE orders ALTER COLUMN subtotal_minor TYPE BIGINT USING ROUND(subtotal_minor * 100);
+        ALTER TABLE orders ALTER COLUMN discount_minor TYPE BIGINT USING ROUND(discount_minor * 100);
+        ALTER TABLE orders ALTER COLUMN total_minor TYPE BIGINT USING ROUND(total_minor * 100);
+
+        -- order เดิมทั้งหมดเป็นราคารวม VAT 7%
+        UPDATE orders SET vat_minor = total_minor - ROUND(total_minor * 10000.0 / 10700);
+    END IF;
+
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'order_items' AND column_name = 'list_price') THEN
+        ALTER TABLE order_items RENAME COLUMN list_price TO list_price_minor;
+        ALTER TABLE order_items RENAME COLUMN unit_price TO unit_price_minor;
+        ALTER TABLE order_items RENAME COLUMN line_total TO line_total_minor;
+        ALTER TABLE order_items ALTER COLUMN list_price_minor TYPE BIGINT USING ROUND(list_price_minor * 100);
+        ALTER TABLE order_items ALTER COLUMN unit_price_minor TYPE BIGINT USING ROUND(unit_price_minor * 100);
+        ALTER TABLE order_items ALTER COLUMN line_total_minor TYPE BIGINT USING ROUND(line_total_minor * 100);
+    END IF;
+
+    -- ส่วนลดที่ใช้จริงอยู่ในสกุลของ order
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'promotion_redemptions' AND column_name = 'amount') THEN
+        ALTER TABLE promotion_redemptions RENAME COLUMN amount TO amount_minor;
+        ALTER TABLE promotion_redemptions ALTER COLUMN amount_minor TYPE BIGINT USING ROUND(amount_minor * 100);
+    END IF;
+END;
+$$;
+
+-- Permissions
+INSERT INTO permissions (name, description, resource, action) VALUES
+('pricing:manage', 'Can manage exchange rates and per-currency price lists', 'pricing', 'manage')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name = 'admin' AND p.name = 'pricing:manage'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,14 @@
+-- 20. Book cover images
+-- ไฟล์จริงอยู่ใน blob store (local หรือ S3) ที่ key covers/<book_id>/<hash>/<size>.<ext>
+-- books.cover_image ถูกตั้งเป็น URL ของ endpoint /covers อัตโนมัติ
+
+CREATE TABLE IF NOT EXISTS book_covers (
+    book_id INTEGER PRIMARY KEY REFERENCES books(id) ON DELETE CASCADE,
+    hash VARCHAR(64) NOT NULL,
+    content_type VARCHAR(50) NOT NULL,
+    width INTEGER NOT NULL CHECK (width > 0),
+    height INTEGER NOT NULL CHECK (height > 0),
+    size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+    uploaded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,61 @@
+-- 21. Wishlists & reading lists
+-- private = เจ้าของเห็นคนเดียว, unlisted = ใครมีลิงก์ (share_token) ก็ดูได้, public = แสดงในรายการสาธารณะด้วย
+
+CREATE TABLE IF NOT EXISTS wishlists (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    visibility VARCHAR(10) NOT NULL DEFAULT 'private' CHECK (visibility IN ('private', 'unlisted', 'public')),
+    share_token VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_wishlists_public ON wishlists(updated_at DESC) WHERE visibility = 'public';
+
+DROP TRIGGER IF EXISTS update_wishlists_modtime ON wishlists;
+CREATE TRIGGER update_wishlists_modtime BEFORE UPDATE ON wishlists
+FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+
+-- seen_*: ราคา (หน่วยย่อยของบาท) และสถานะ stock ล่าสุดที่ watcher เห็น
+-- NULL = ยังไม่มี baseline (เพิ่งเปิด notify) จะไม่แจ้งเตือนรอบแรก
+CREATE TABLE IF NOT EXISTS wishlist_items (
+    wishlist_id INTEGER NOT NULL REFERENCES wishlists(id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    note VARCHAR(500) NOT NULL DEFAULT '',
+    notify BOOLEAN NOT NULL DEFAULT FALSE,
+    seen_price_minor BIGINT,
+    seen_in_stock BOOLEAN,
+    added_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (wishlist_id, book_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_wishlist_items_notify ON wishlist_items(book_id) WHERE notify;
+
+CREATE TABLE IF NOT EXISTS wishlist_alerts (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    wishlist_id INTEGER NOT NULL REFERENCES wishlists(id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('discounted', 'back_in_stock')),
+    previous_price_minor BIGINT,
+    price_minor BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_wishlist_alerts_user ON wishlist_alerts(user_id, created_at DESC);
+
+-- Permissions
+INSERT INTO permissions (name, description, resource, action) VALUES
+('wishlists:manage', 'Can create and manage own wishlists and reading lists', 'wishlists', 'manage')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name IN ('admin', 'editor', 'user') AND p.name = 'wishlists:manage'
+ON CONFLICT DO NOTHING;
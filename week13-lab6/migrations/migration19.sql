@@ -0,0 +1,50 @@
+-- 22. Recommendations
+-- ตารางผลลัพธ์ถูกสร้างใหม่ทั้งหมดโดย job เป็นระยะ (RECOMMENDATIONS_INTERVAL)
+
+-- การเปิดดูหนังสือของ user ที่ login (ใช้คำนวณ "also viewed")
+CREATE TABLE IF NOT EXISTS book_views (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    views INTEGER NOT NULL DEFAULT 1,
+    last_viewed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, book_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_views_book ON book_views(book_id);
+
+-- item-to-item: bought/viewed = co-occurrence (cosine), content = category/author/publisher
+-- score อยู่ในช่วง 0..1 ต่อ book_id
+CREATE TABLE IF NOT EXISTS book_similarities (
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('bought', 'viewed', 'content')),
+    similar_book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    computed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (book_id, kind, similar_book_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_similarities_rank ON book_similarities(book_id, kind, score DESC);
+
+-- reason_*: หนังสือของ user ที่ส่งผลต่อคะแนนมากที่สุด ("เพราะคุณซื้อ ...")
+CREATE TABLE IF NOT EXISTS user_recommendations (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    reason_book_id INTEGER REFERENCES books(id) ON DELETE SET NULL,
+    reason_kind VARCHAR(10),
+    computed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, book_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_recommendations_rank ON user_recommendations(user_id, score DESC);
+
+-- Permissions
+INSERT INTO permissions (name, description, resource, action) VALUES
+('recommendations:manage', 'Can trigger a rebuild of precomputed recommendations', 'recommendations', 'manage')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name = 'admin' AND p.name = 'recommendations:manage'
+ON CONFLICT DO NOTHING;
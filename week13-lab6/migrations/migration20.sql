@@ -0,0 +1,66 @@
+-- 23. Reporting: materialized views
+-- สรุปรายวัน refresh เป็นระยะโดย job (REPORTS_REFRESH_INTERVAL) ด้วย REFRESH ... CONCURRENTLY
+-- จึงต้องมี unique index ทุก view; วันที่ของ order นับตามเวลาไทย
+-- ยอดเงินแยกตามสกุลของ order (หน่วยย่อย) ไม่แปลงข้ามสกุล
+
+-- ยอดขายรายวันต่อสกุลเงิน (order ที่จ่ายแล้ว ไม่รวมที่ยกเลิก)
+CREATE MATERIALIZED VIEW IF NOT EXISTS report_daily_sales AS
+SELECT (COALESCE(o.paid_at, o.created_at) AT TIME ZONE 'Asia/Bangkok')::date AS day,
+       o.currency,
+       COUNT(*) AS orders,
+       COALESCE(SUM(u.units), 0) AS units,
+       SUM(o.subtotal_minor) AS subtotal_minor,
+       SUM(o.discount_minor) AS discount_minor,
+       SUM(o.vat_minor) AS vat_minor,
+       SUM(o.total_minor) AS total_minor
+FROM orders o
+LEFT JOIN LATERAL (
+    SELECT SUM(oi.quantity) AS units FROM order_items oi WHERE oi.order_id = o.id
+) u ON true
+WHERE o.status IN ('paid', 'shipped', 'delivered')
+GROUP BY 1, 2;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_report_daily_sales ON report_daily_sales(day, currency);
+
+-- ยอดขายรายวันต่อเล่ม; book_id = 0 คือหนังสือที่ถูกลบถาวรไปแล้ว
+CREATE MATERIALIZED VIEW IF NOT EXISTS report_daily_book_sales AS
+SELECT (COALESCE(o.paid_at, o.created_at) AT TIME ZONE 'Asia/Bangkok')::date AS day,
+       COALESCE(oi.book_id, 0) AS book_id,
+       o.currency,
+       MAX(oi.title) AS title,
+       COUNT(DISTINCT o.id) AS orders,
+       SUM(oi.quantity) AS units,
+       SUM(oi.line_total_minor) AS revenue_minor
+FROM orders o
+JOIN order_items oi ON oi.order_id = o.id
+WHERE o.status IN ('paid', 'shipped', 'delivered')
+GROUP BY 1, 2, 3;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_report_daily_book_sales ON report_daily_book_sales(day, book_id, currency);
+
+-- กิจกรรมรายวันต่อ user จาก audit_logs (user_id = 0 คือไม่ระบุตัว เช่น login ไม่สำเร็จ)
+-- เก็บระดับ user เพื่อนับ unique users ข้ามหลายวันได้ถูกต้อง
+-- audit_logs.created_at เป็น TIMESTAMP ไม่มี zone จึงใช้วันตามที่บันทึกไว้ตรง ๆ
+CREATE MATERIALIZED VIEW IF NOT EXISTS report_daily_user_activity AS
+SELECT created_at::date AS day,
+       COALESCE(user_id, 0) AS user_id,
+       action,
+       COALESCE(resource, '') AS resource,
+       COUNT(*) AS events
+FROM audit_logs
+GROUP BY 1, 2, 3, 4;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_report_daily_user_activity ON report_daily_user_activity(day, user_id, action, resource);
+
+-- เวลาที่ refresh ล่าสุดของแต่ละ view (แสดงใน response ของ report)
+CREATE TABLE IF NOT EXISTS report_refreshes (
+    view_name VARCHAR(63) PRIMARY KEY,
+    refreshed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    duration_ms INTEGER NOT NULL DEFAULT 0
+);
+
+INSERT INTO report_refreshes (view_name, refreshed_at) VALUES
+('report_daily_sales', NOW()),
+('report_daily_book_sales', NOW()),
+('report_daily_user_activity', NOW())
+ON CONFLICT (view_name) DO NOTHING;
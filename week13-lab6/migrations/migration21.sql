@@ -0,0 +1,20 @@
+-- 24. Schema version & health checks
+-- /readyz เทียบเลขใน schema_migrations กับ header "-- N." ของไฟล์ migration ที่ฝังใน binary
+-- ทุก migration ต่อจากนี้ต้องจบด้วย INSERT INTO schema_migrations (version) VALUES (N)
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Permissions
+INSERT INTO permissions (name, description, resource, action) VALUES
+('health:read', 'Can see detailed dependency health checks', 'health', 'read')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE r.name = 'admin' AND p.name = 'health:read'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO schema_migrations (version) VALUES (24) ON CONFLICT DO NOTHING;
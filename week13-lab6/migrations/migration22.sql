@@ -0,0 +1,35 @@
+-- 25. Collection change timestamps
+-- Last-Modified ของ endpoint แบบ list ใช้เวลาที่ตารางเปลี่ยนล่าสุด (รวม DELETE)
+-- เพราะ updated_at ล่าสุดในผลลัพธ์ไม่ขยับเมื่อมีแถวหลุดออกจากผลลัพธ์ (ลบ, ย้ายลงถังขยะ, unpublish)
+CREATE TABLE IF NOT EXISTS table_changes (
+    table_name TEXT PRIMARY KEY,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE OR REPLACE FUNCTION record_table_change() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO table_changes (table_name, changed_at)
+    VALUES (TG_TABLE_NAME, clock_timestamp())
+    ON CONFLICT (table_name) DO UPDATE
+    SET changed_at = GREATEST(table_changes.changed_at, EXCLUDED.changed_at);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- FOR EACH STATEMENT: bulk update/import บันทึกครั้งเดียวต่อคำสั่ง
+-- stock ไม่ใส่ trigger เพราะ checkout แก้ทุกครั้ง (จะรอ lock แถวเดียวกัน) ใช้ MAX(stock.updated_at) แทน
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['books', 'authors', 'publishers', 'categories', 'reviews', 'fx_rates', 'wishlists', 'wishlist_items'] LOOP
+        EXECUTE format('DROP TRIGGER IF EXISTS record_%s_change ON %I', t, t);
+        EXECUTE format(
+            'CREATE TRIGGER record_%s_change AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON %I
+             FOR EACH STATEMENT EXECUTE FUNCTION record_table_change()', t, t);
+        INSERT INTO table_changes (table_name) VALUES (t) ON CONFLICT DO NOTHING;
+    END LOOP;
+END;
+$$;
+
+INSERT INTO schema_migrations (version) VALUES (25) ON CONFLICT DO NOTHING;
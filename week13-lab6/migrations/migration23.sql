@@ -0,0 +1,27 @@
+-- 26. Payment refunds
+-- refund ที่บันทึกแล้ว ทั้งที่สั่งผ่าน API และที่ provider แจ้งผ่าน webhook
+-- provider มักส่ง payment.refunded ตามหลัง refund ที่เราสั่งเอง (event ID ต่างกัน)
+-- จึงกันการนับซ้ำด้วย refund ID ของ provider แทน event ID
+CREATE TABLE IF NOT EXISTS payment_refunds (
+    provider VARCHAR(30) NOT NULL,
+    refund_id VARCHAR(100) NOT NULL,
+    payment_id INTEGER NOT NULL REFERENCES payments(id) ON DELETE RESTRICT,
+    amount_minor BIGINT NOT NULL CHECK (amount_minor > 0),
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL, -- NULL = webhook
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, refund_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_refunds_payment ON payment_refunds(payment_id);
+
+-- ฐานข้อมูลที่สร้าง payments ก่อนมี constraint นี้ใน migration14
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'payments_refund_within_amount') THEN
+        ALTER TABLE payments ADD CONSTRAINT payments_refund_within_amount
+            CHECK (refunded_minor <= amount_minor);
+    END IF;
+END;
+$$;
+
+INSERT INTO schema_migrations (version) VALUES (26) ON CONFLICT DO NOTHING;
@@ -0,0 +1,26 @@
+-- 27. Promotion amounts in minor units
+-- ส่วนลดแบบเปอร์เซ็นต์เก็บเป็น basis points (1000 = 10%)
+-- ส่วนลดแบบ fixed และยอดขั้นต่ำเก็บเป็นหน่วยย่อยของบาท (สกุลหลักของร้าน)
+-- แปลงเฉพาะเมื่อยังมีคอลัมน์ value เดิม เพื่อให้รันไฟล์นี้ซ้ำได้
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'promotions' AND column_name = 'value') THEN
+        ALTER TABLE promotions ADD COLUMN value_bp INTEGER CHECK (value_bp > 0 AND value_bp <= 10000);
+        ALTER TABLE promotions ADD COLUMN value_minor BIGINT CHECK (value_minor > 0);
+        UPDATE promotions SET value_bp = ROUND(value * 100) WHERE kind = 'percentage';
+        UPDATE promotions SET value_minor = ROUND(value * 100) WHERE kind = 'fixed';
+        -- constraint เดิมที่อ้างถึง value ถูกลบไปพร้อมคอลัมน์
+        ALTER TABLE promotions DROP COLUMN value;
+        ALTER TABLE promotions ADD CONSTRAINT promotions_value_by_kind CHECK (
+            (kind = 'percentage' AND value_bp IS NOT NULL AND value_minor IS NULL) OR
+            (kind = 'fixed' AND value_minor IS NOT NULL AND value_bp IS NULL)
+        );
+
+        ALTER TABLE promotions RENAME COLUMN min_subtotal TO min_subtotal_minor;
+        ALTER TABLE promotions ALTER COLUMN min_subtotal_minor TYPE BIGINT USING ROUND(min_subtotal_minor * 100);
+    END IF;
+END;
+$$;
+
+INSERT INTO schema_migrations (version) VALUES (27) ON CONFLICT DO NOTHING;
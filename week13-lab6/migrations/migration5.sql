@@ -0,0 +1,20 @@
+-- 8. Soft delete สำหรับ books
+ALTER TABLE books ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- query ปกติดูเฉพาะแถวที่ยังไม่ถูกลบ
+CREATE INDEX IF NOT EXISTS idx_books_not_deleted ON books(id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_books_deleted_at ON books(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Permanent delete แยก permission ออกจาก books:delete
+INSERT INTO permissions (name, description, resource, action) VALUES
+('books:purge', 'Can permanently delete books from trash', 'books', 'purge')
+ON CONFLICT (name) DO NOTHING;
+
+-- Admin only
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT
+    (SELECT id FROM roles WHERE name = 'admin'),
+    id
+FROM permissions
+WHERE name = 'books:purge'
+ON CONFLICT DO NOTHING;
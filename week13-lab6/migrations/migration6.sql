@@ -0,0 +1,14 @@
+-- 9. Publishing workflow สำหรับ books
+-- draft -> in_review -> published -> archived
+ALTER TABLE books ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'draft';
+ALTER TABLE books ADD COLUMN IF NOT EXISTS published_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS scheduled_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE books ADD CONSTRAINT chk_books_status
+    CHECK (status IN ('draft', 'in_review', 'published', 'archived'));
+
+-- หนังสือที่มีอยู่แล้วถือว่าเผยแพร่แล้ว
+UPDATE books SET status = 'published', published_at = created_at WHERE status = 'draft';
+
+CREATE INDEX IF NOT EXISTS idx_books_status ON books(status);
+CREATE INDEX IF NOT EXISTS idx_books_scheduled ON books(scheduled_at) WHERE scheduled_at IS NOT NULL;
@@ -0,0 +1,64 @@
+-- 10. ISBN normalisation และ unique index
+-- เก็บ ISBN เป็น ISBN-13 แบบไม่มีขีด (เหมือน isbn.Normalize ฝั่ง Go)
+CREATE OR REPLACE FUNCTION isbn_compact(raw TEXT) RETURNS TEXT AS $$
+DECLARE
+    digits TEXT := regexp_replace(upper(coalesce(raw, '')), '[^0-9X]', '', 'g');
+    body TEXT;
+    total INTEGER := 0;
+BEGIN
+    IF digits !~ '^[0-9]{9}[0-9X]$' THEN
+        RETURN digits;
+    END IF;
+
+    -- ISBN-10 -> ISBN-13: เติม 978 แล้วคำนวณ check digit ใหม่
+    body := '978' || left(digits, 9);
+    FOR i IN 1..12 LOOP
+        total := total + substr(body, i, 1)::INTEGER * (CASE WHEN i % 2 = 0 THEN 3 ELSE 1 END);
+    END LOOP;
+    RETURN body || ((10 - total % 10) % 10)::TEXT;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- ISBN-13 ที่ check digit ถูกต้อง (เหมือน isbn.Validate ฝั่ง Go)
+CREATE OR REPLACE FUNCTION isbn13_valid(digits TEXT) RETURNS BOOLEAN AS $$
+DECLARE
+    total INTEGER := 0;
+BEGIN
+    IF digits !~ '^[0-9]{13}$' THEN
+        RETURN FALSE;
+    END IF;
+    FOR i IN 1..12 LOOP
+        total := total + substr(digits, i, 1)::INTEGER * (CASE WHEN i % 2 = 0 THEN 3 ELSE 1 END);
+    END LOOP;
+    RETURN substr(digits, 13, 1)::INTEGER = (10 - total % 10) % 10;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+UPDATE books SET isbn = isbn_compact(isbn) WHERE isbn IS NOT NULL;
+UPDATE books SET isbn = '' WHERE isbn IS NULL;
+
+-- ISBN ที่ไม่ผ่านการตรวจ (เช่นข้อมูลตัวอย่าง 978-1234567890) ล้างเป็นค่าว่าง
+-- ไม่เช่นนั้น PUT ที่ส่ง ISBN เดิมกลับมาจะไม่ผ่าน validation; ค่าเดิมเก็บไว้ใน audit_logs
+INSERT INTO audit_logs (action, resource, resource_id, details)
+SELECT 'isbn_cleared', 'books', id::TEXT, jsonb_build_object('isbn', isbn, 'reason', 'invalid check digit or length')
+FROM books
+WHERE isbn <> '' AND NOT isbn13_valid(isbn);
+UPDATE books SET isbn = '' WHERE isbn <> '' AND NOT isbn13_valid(isbn);
+
+-- ISBN ซ้ำ: เก็บแถวที่แก้ไขล่าสุด ที่เหลือย้ายไปถังขยะ (กู้คืนได้ถ้าแก้ ISBN ก่อน)
+UPDATE books SET deleted_at = NOW()
+WHERE id IN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (PARTITION BY isbn ORDER BY updated_at DESC, id DESC) AS rn
+        FROM books
+        WHERE deleted_at IS NULL AND isbn <> ''
+    ) dup
+    WHERE dup.rn > 1
+);
+
+ALTER TABLE books ALTER COLUMN isbn SET DEFAULT '';
+ALTER TABLE books ALTER COLUMN isbn SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_books_isbn_unique
+    ON books(isbn)
+    WHERE deleted_at IS NULL AND isbn <> '';
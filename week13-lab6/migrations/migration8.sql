@@ -0,0 +1,18 @@
+-- 11. ฟิลด์ราคา/ส่วนลด/ปก (ชื่อเดียวกับ schema ของ week11-assignment)
+ALTER TABLE books ADD COLUMN IF NOT EXISTS original_price DECIMAL(10,2);
+ALTER TABLE books ADD COLUMN IF NOT EXISTS discount INTEGER;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS cover_image VARCHAR(500);
+
+UPDATE books SET discount = 0 WHERE discount IS NULL;
+UPDATE books SET cover_image = '' WHERE cover_image IS NULL;
+UPDATE books SET price = 0 WHERE price IS NULL;
+
+ALTER TABLE books ALTER COLUMN discount SET DEFAULT 0;
+ALTER TABLE books ALTER COLUMN discount SET NOT NULL;
+ALTER TABLE books ALTER COLUMN cover_image SET DEFAULT '';
+ALTER TABLE books ALTER COLUMN cover_image SET NOT NULL;
+
+-- กฎเดียวกับ binding tags ของ Book ฝั่ง Go
+ALTER TABLE books ADD CONSTRAINT chk_books_price CHECK (price >= 0);
+ALTER TABLE books ADD CONSTRAINT chk_books_original_price CHECK (original_price IS NULL OR original_price >= 0);
+ALTER TABLE books ADD CONSTRAINT chk_books_discount CHECK (discount BETWEEN 0 AND 100);
@@ -0,0 +1,153 @@
+-- 12. Authors, Publishers, Categories แยกเป็นตารางของตัวเอง
+CREATE TABLE IF NOT EXISTS authors (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    bio TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_authors_name ON authors(lower(name));
+
+CREATE TABLE IF NOT EXISTS publishers (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    website VARCHAR(500) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_publishers_name ON publishers(lower(name));
+
+-- categories เป็น tree ผ่าน parent_id
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    slug VARCHAR(120) UNIQUE NOT NULL,
+    parent_id INTEGER REFERENCES categories(id) ON DELETE RESTRICT,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (parent_id IS NULL OR parent_id <> id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_categories_parent ON categories(parent_id);
+
+-- Book <-> Author (many-to-many) เก็บลำดับผู้แต่งใน position
+CREATE TABLE IF NOT EXISTS book_authors (
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    author_id INTEGER NOT NULL REFERENCES authors(id) ON DELETE RESTRICT,
+    position SMALLINT NOT NULL,
+    PRIMARY KEY (book_id, author_id),
+    UNIQUE (book_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS idx_book_authors_author ON book_authors(author_id);
+
+DROP TRIGGER IF EXISTS update_authors_modtime ON authors;
+CREATE TRIGGER update_authors_modtime BEFORE UPDATE ON authors
+FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+DROP TRIGGER IF EXISTS update_publishers_modtime ON publishers;
+CREATE TRIGGER update_publishers_modtime BEFORE UPDATE ON publishers
+FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+DROP TRIGGER IF EXISTS update_categories_modtime ON categories;
+CREATE TRIGGER update_categories_modtime BEFORE UPDATE ON categories
+FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+
+-- books.publisher / books.category มีอยู่แล้วใน schema ของ week11-assignment
+-- ต่อจากนี้เป็นชื่อที่ sync มาจาก publishers/categories (FK คือ source of truth)
+ALTER TABLE books ADD COLUMN IF NOT EXISTS publisher VARCHAR(255);
+ALTER TABLE books ADD COLUMN IF NOT EXISTS category VARCHAR(100);
+UPDATE books SET publisher = '' WHERE publisher IS NULL;
+UPDATE books SET category = '' WHERE category IS NULL;
+UPDATE books SET author = '' WHERE author IS NULL;
+ALTER TABLE books ALTER COLUMN publisher SET DEFAULT '';
+ALTER TABLE books ALTER COLUMN publisher SET NOT NULL;
+ALTER TABLE books ALTER COLUMN category SET DEFAULT '';
+ALTER TABLE books ALTER COLUMN category SET NOT NULL;
+ALTER TABLE books ALTER COLUMN author SET DEFAULT '';
+ALTER TABLE books ALTER COLUMN author SET NOT NULL;
+
+ALTER TABLE books ADD COLUMN IF NOT EXISTS publisher_id INTEGER REFERENCES publishers(id) ON DELETE SET NULL;
+ALTER TABLE books ADD COLUMN IF NOT EXISTS category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_books_publisher ON books(publisher_id);
+CREATE INDEX IF NOT EXISTS idx_books_category ON books(category_id);
+
+-- แยกชื่อผู้แต่งจากข้อความ เช่น 'Nuttachot Promrit and Sajjaporn Waijanya'
+-- รองรับรูปแบบ "Last, First" ด้วย:
+--   'Promrit, Nuttachot'                           -> Nuttachot Promrit
+--   'Promrit, Nuttachot and Waijanya, Sajjaporn'   -> ทุกส่วนมี comma เดียว จึงเป็น "Last, First"
+--   'Promrit, Nuttachot; Waijanya, Sajjaporn'      -> มี ; ใช้ ; คั่นรายชื่อ
+--   'A, B and C'                                   -> comma คั่นรายชื่อ (รูปแบบของ joinAuthorNames)
+-- ข้อจำกัด: ชื่อแบบนามสกุลอย่างเดียวสองคน เช่น 'Smith, Jones' จะถูกอ่านเป็น "Jones Smith"
+-- ให้ใช้ 'Smith and Jones' หรือ author_ids แทน
+CREATE OR REPLACE FUNCTION split_author_names(raw TEXT)
+RETURNS TABLE(name TEXT, pos INTEGER) AS $$
+DECLARE
+    list_sep CONSTANT TEXT := '\s*,?\s+and\s+|\s*&\s*';
+    parts TEXT[];
+    part TEXT;
+BEGIN
+    raw := trim(coalesce(raw, ''));
+    IF raw LIKE '%;%' THEN
+        parts := regexp_split_to_array(raw, '\s*;\s*');
+    ELSE
+        parts := regexp_split_to_array(raw, list_sep);
+        IF EXISTS (SELECT 1 FROM unnest(parts) p WHERE p !~ '^[^,]+,[^,]+$') THEN
+            parts := regexp_split_to_array(raw, list_sep || '|\s*,\s*');
+        END IF;
+    END IF;
+
+    pos := 0;
+    FOREACH part IN ARRAY parts LOOP
+        part := trim(part);
+        CONTINUE WHEN part = '';
+        IF part ~ '^[^,]+,[^,]+$' THEN
+            part := trim(split_part(part, ',', 2)) || ' ' || trim(split_part(part, ',', 1));
+        END IF;
+        name := part;
+        pos := pos + 1;
+        RETURN NEXT;
+    END LOOP;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- สร้าง book_authors ใหม่จาก books.author (ใช้ตอน migrate และตอน import)
+CREATE OR REPLACE FUNCTION sync_book_authors(p_book_id INTEGER) RETURNS VOID AS $$
+BEGIN
+    DELETE FROM book_authors WHERE book_id = p_book_id;
+
+    INSERT INTO authors (name)
+    SELECT s.name FROM books b, split_author_names(b.author) s
+    WHERE b.id = p_book_id
+    ON CONFLICT DO NOTHING;
+
+    INSERT INTO book_authors (book_id, author_id, position)
+    SELECT p_book_id, a.id, s.pos
+    FROM books b
+    CROSS JOIN split_author_names(b.author) s
+    JOIN authors a ON lower(a.name) = lower(s.name)
+    WHERE b.id = p_book_id
+    ON CONFLICT DO NOTHING;
+END;
+$$ LANGUAGE plpgsql;
+
+-- ย้ายข้อมูลเดิม
+SELECT sync_book_authors(id) FROM books;
+
+INSERT INTO publishers (name)
+SELECT DISTINCT trim(publisher) FROM books WHERE trim(publisher) <> ''
+ON CONFLICT DO NOTHING;
+
+UPDATE books b SET publisher_id = p.id, publisher = p.name
+FROM publishers p
+WHERE lower(p.name) = lower(trim(b.publisher));
+
+INSERT INTO categories (name, slug)
+SELECT DISTINCT trim(category), lower(regexp_replace(trim(category), '\s+', '-', 'g'))
+FROM books WHERE trim(category) <> ''
+ON CONFLICT DO NOTHING;
+
+UPDATE books b SET category_id = c.id, category = c.name
+FROM categories c
+WHERE c.slug = lower(regexp_replace(trim(b.category), '\s+', '-', 'g'));
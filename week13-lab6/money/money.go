@@ -0,0 +1,266 @@
+// Package money represents amounts as integer minor units (satang, cents)
+// together with an ISO 4217 currency code, so totals never pick up float
+// rounding errors. Rounding, where needed, is half away from zero.
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidAmount   = errors.New("money: invalid amount")
+	ErrUnknownCurrency = errors.New("money: unknown currency")
+)
+
+// exponents is the number of minor-unit digits of each supported currency.
+var exponents = map[string]int{
+	"THB": 2,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"JPY": 0,
+	"CNY": 2,
+	"HKD": 2,
+	"SGD": 2,
+	"MYR": 2,
+	"AUD": 2,
+	"KRW": 0,
+	"VND": 0,
+	"LAK": 2,
+}
+
+// Known reports whether currency is a supported ISO 4217 code.
+func Known(currency string) bool {
+	_, ok := exponents[currency]
+	return ok
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+// Money is an amount in minor units of Currency.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// New returns amount minor units of currency.
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// maxDecimalLen bounds the input of ParseDecimal. big.Rat.SetString alone
+// accepts exponents such as "1e100000000" and expands them in full.
+const maxDecimalLen = 40
+
+// decimalPattern is a plain decimal with at most a two-digit exponent.
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)([eE][+-]?\d{1,2})?$`)
+
+// ParseDecimal reads a decimal string such as "1500.75" or "2.75e-2".
+// Fractions ("1/3"), long inputs and large exponents are rejected.
+func ParseDecimal(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > maxDecimalLen || !decimalPattern.MatchString(s) {
+		return nil, ErrInvalidAmount
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, ErrInvalidAmount
+	}
+	return r, nil
+}
+
+// Parse reads a decimal string such as "1500.75" in major units. Digits
+// beyond the currency's precision are rounded.
+func Parse(s, currency string) (Money, error) {
+	if !Known(currency) {
+		return Money{}, ErrUnknownCurrency
+	}
+	r, err := ParseDecimal(s)
+	if err != nil {
+		return Money{}, err
+	}
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt64(pow10(exponents[currency])))
+	if scaled.Cmp(maxRat) > 0 || scaled.Cmp(minRat) < 0 {
+		return Money{}, ErrInvalidAmount
+	}
+	return Money{Amount: roundRat(scaled), Currency: currency}, nil
+}
+
+// ขอบเขตที่ปัดแล้วยังอยู่ใน int64
+var (
+	maxRat = new(big.Rat).SetInt64(math.MaxInt64 - 1)
+	minRat = new(big.Rat).SetInt64(math.MinInt64 + 1)
+)
+
+// FromFloat converts a major-unit float, e.g. a DECIMAL column scanned into
+// float64, via its shortest decimal representation so 1500.75 stays exact.
+func FromFloat(f float64, currency string) (Money, error) {
+	return Parse(strconv.FormatFloat(f, 'f', -1, 64), currency)
+}
+
+func fromRat(r *big.Rat, currency string) Money {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt64(pow10(exponents[currency])))
+	return Money{Amount: roundRat(scaled), Currency: currency}
+}
+
+func roundRat(r *big.Rat) int64 {
+	num, den := r.Num(), r.Denom()
+	q, m := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(m), big.NewInt(2)).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(int64(num.Sign())))
+	}
+	return q.Int64()
+}
+
+func divRound(a, b int64) int64 {
+	return roundRat(big.NewRat(a, b))
+}
+
+// Rat returns the amount in major units.
+func (m Money) Rat() *big.Rat {
+	return big.NewRat(m.Amount, pow10(exponents[m.Currency]))
+}
+
+// String formats the amount in major units without grouping, e.g. "1500.75".
+func (m Money) String() string {
+	exp := exponents[m.Currency]
+	sign, abs := "", m.Amount
+	if abs < 0 {
+		sign, abs = "-", -abs
+	}
+	if exp == 0 {
+		return sign + strconv.FormatInt(abs, 10)
+	}
+	p := pow10(exp)
+	return fmt.Sprintf("%s%d.%0*d", sign, abs/p, exp, abs%p)
+}
+
+func (m Money) mustMatch(o Money) {
+	if m.Currency != o.Currency {
+		panic("money: currency mismatch " + m.Currency + " vs " + o.Currency)
+	}
+}
+
+// Add panics when the currencies differ; mixing them is a programming error.
+func (m Money) Add(o Money) Money {
+	m.mustMatch(o)
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}
+}
+
+func (m Money) Sub(o Money) Money {
+	m.mustMatch(o)
+	return Money{Amount: m.Amount - o.Amount, Currency: m.Currency}
+}
+
+func (m Money) Mul(n int64) Money {
+	return Money{Amount: m.Amount * n, Currency: m.Currency}
+}
+
+// MulRatio returns m × num / den, rounded.
+func (m Money) MulRatio(num, den int64) Money {
+	return Money{Amount: divRound(m.Amount*num, den), Currency: m.Currency}
+}
+
+// Percent returns the given share of m in basis points (700 = 7%).
+func (m Money) Percent(basisPoints int64) Money {
+	return m.MulRatio(basisPoints, 10000)
+}
+
+func (m Money) Cmp(o Money) int {
+	m.mustMatch(o)
+	switch {
+	case m.Amount < o.Amount:
+		return -1
+	case m.Amount > o.Amount:
+		return 1
+	}
+	return 0
+}
+
+func (m Money) IsZero() bool { return m.Amount == 0 }
+
+// Min returns the smaller of m and o.
+func (m Money) Min(o Money) Money {
+	if m.Cmp(o) <= 0 {
+		return m
+	}
+	return o
+}
+
+// Convert returns m in currency to, where rate is units of to per one unit
+// of m's currency (both in major units).
+func (m Money) Convert(to string, rate *big.Rat) Money {
+	if to == m.Currency {
+		return m
+	}
+	return fromRat(new(big.Rat).Mul(m.Rat(), rate), to)
+}
+
+// VAT is an amount split into its net and tax parts.
+type VAT struct {
+	Net   Money
+	Tax   Money
+	Gross Money
+}
+
+// IncludedVAT splits a VAT-inclusive amount: net = gross × 100 / (100 + rate).
+func IncludedVAT(gross Money, basisPoints int64) VAT {
+	net := gross.MulRatio(10000, 10000+basisPoints)
+	return VAT{Net: net, Tax: gross.Sub(net), Gross: gross}
+}
+
+// ExcludedVAT adds VAT on top of a net amount.
+func ExcludedVAT(net Money, basisPoints int64) VAT {
+	tax := net.Percent(basisPoints)
+	return VAT{Net: net, Tax: tax, Gross: net.Add(tax)}
+}
+
+type moneyJSON struct {
+	Amount      json.Number `json:"amount"`
+	AmountMinor *int64      `json:"amount_minor,omitempty"`
+	Currency    string      `json:"currency"`
+}
+
+// MarshalJSON writes {"amount":"1500.75","amount_minor":150075,"currency":"THB"}.
+// The decimal amount is a string so clients do not parse it as a float.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount      string `json:"amount"`
+		AmountMinor int64  `json:"amount_minor"`
+		Currency    string `json:"currency"`
+	}{m.String(), m.Amount, m.Currency})
+}
+
+// UnmarshalJSON accepts the MarshalJSON form; amount_minor wins over amount.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var v moneyJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if !Known(v.Currency) {
+		return ErrUnknownCurrency
+	}
+	if v.AmountMinor != nil {
+		*m = Money{Amount: *v.AmountMinor, Currency: v.Currency}
+		return nil
+	}
+	parsed, err := Parse(string(v.Amount), v.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
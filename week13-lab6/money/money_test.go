@@ -0,0 +1,185 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency string
+		want     int64
+		wantErr  error
+	}{
+		{"1500.75", "THB", 150075, nil},
+		{" 10 ", "THB", 1000, nil},
+		{"+3", "THB", 300, nil},
+		{".5", "THB", 50, nil},
+		{"0.005", "THB", 1, nil}, // ปัดครึ่งออกจากศูนย์
+		{"-0.005", "THB", -1, nil},
+		{"0.0049", "THB", 0, nil},
+		{"1234.5", "JPY", 1235, nil},
+		{"2.75e-2", "USD", 3, nil},
+		{"1E2", "USD", 10000, nil},
+		{"92233720368547758.06", "THB", 9223372036854775806, nil},
+		{"92233720368547758.08", "THB", 0, ErrInvalidAmount},
+		{"1e99", "THB", 0, ErrInvalidAmount},
+		{"1e100000000", "THB", 0, ErrInvalidAmount},
+		{"1e-100000000", "THB", 0, ErrInvalidAmount},
+		{strings.Repeat("9", maxDecimalLen+1), "JPY", 0, ErrInvalidAmount},
+		{"1/3", "THB", 0, ErrInvalidAmount},
+		{"12,50", "THB", 0, ErrInvalidAmount},
+		{"abc", "THB", 0, ErrInvalidAmount},
+		{"", "THB", 0, ErrInvalidAmount},
+		{"1.00", "XYZ", 0, ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in, tt.currency)
+		if !errors.Is(err, tt.wantErr) || (err == nil && got != New(tt.want, tt.currency)) {
+			t.Errorf("Parse(%q, %s) = %v, %v; want %d, %v", tt.in, tt.currency, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(150075, "THB"), "1500.75"},
+		{New(5, "THB"), "0.05"},
+		{New(-5, "THB"), "-0.05"},
+		{New(-150075, "USD"), "-1500.75"},
+		{New(1235, "JPY"), "1235"},
+		{New(0, "KRW"), "0"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.m, got, tt.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	a, b := New(1050, "THB"), New(299, "THB")
+	if got := a.Add(b); got != New(1349, "THB") {
+		t.Errorf("Add = %v", got)
+	}
+	if got := b.Sub(a); got != New(-751, "THB") {
+		t.Errorf("Sub = %v", got)
+	}
+	if got := b.Mul(3); got != New(897, "THB") {
+		t.Errorf("Mul = %v", got)
+	}
+	if got := a.Min(b); got != b {
+		t.Errorf("Min = %v", got)
+	}
+	if a.Cmp(b) != 1 || b.Cmp(a) != -1 || a.Cmp(a) != 0 {
+		t.Errorf("Cmp is not ordered")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Add with different currencies did not panic")
+		}
+	}()
+	a.Add(New(1, "USD"))
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		amount int64
+		bp     int64
+		want   int64
+	}{
+		{1000, 700, 70},
+		{15, 700, 1},   // 1.05
+		{50, 700, 4},   // 3.5 ปัดขึ้น
+		{-50, 700, -4}, // -3.5 ปัดออกจากศูนย์
+		{12345, 1000, 1235},
+		{999, 0, 0},
+		{999, 10000, 999},
+	}
+	for _, tt := range tests {
+		if got := New(tt.amount, "THB").Percent(tt.bp); got.Amount != tt.want {
+			t.Errorf("Percent(%d, %d) = %d, want %d", tt.amount, tt.bp, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestVAT(t *testing.T) {
+	tests := []struct {
+		name            string
+		vat             VAT
+		net, tax, gross int64
+	}{
+		{"included", IncludedVAT(New(10700, "THB"), 700), 10000, 700, 10700},
+		{"included rounded", IncludedVAT(New(100, "THB"), 700), 93, 7, 100},
+		{"included zero rate", IncludedVAT(New(100, "THB"), 0), 100, 0, 100},
+		{"excluded", ExcludedVAT(New(10000, "THB"), 700), 10000, 700, 10700},
+		{"excluded rounded", ExcludedVAT(New(99, "THB"), 700), 99, 7, 106},
+		{"included JPY", IncludedVAT(New(1100, "JPY"), 1000), 1000, 100, 1100},
+	}
+	for _, tt := range tests {
+		v := tt.vat
+		if v.Net.Amount != tt.net || v.Tax.Amount != tt.tax || v.Gross.Amount != tt.gross {
+			t.Errorf("%s: got net %d tax %d gross %d; want %d %d %d",
+				tt.name, v.Net.Amount, v.Tax.Amount, v.Gross.Amount, tt.net, tt.tax, tt.gross)
+		}
+		if v.Net.Add(v.Tax) != v.Gross {
+			t.Errorf("%s: net + tax != gross", tt.name)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		m    Money
+		to   string
+		rate string
+		want Money
+	}{
+		{New(100000, "THB"), "USD", "0.0275", New(2750, "USD")},
+		{New(100000, "THB"), "JPY", "4.1234", New(4123, "JPY")},
+		{New(4123, "JPY"), "THB", "0.2425", New(99983, "THB")},
+		{New(150, "THB"), "USD", "0.03", New(5, "USD")}, // 0.045 ปัดเป็น 0.05
+		{New(100, "THB"), "THB", "2", New(100, "THB")},
+	}
+	for _, tt := range tests {
+		rate, _ := new(big.Rat).SetString(tt.rate)
+		if got := tt.m.Convert(tt.to, rate); got != tt.want {
+			t.Errorf("%v %s -> %s at %s = %v, want %v", tt.m, tt.m.Currency, tt.to, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(New(150075, "THB"))
+	if err != nil || string(data) != `{"amount":"1500.75","amount_minor":150075,"currency":"THB"}` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr error
+	}{
+		{`{"amount":"1500.75","amount_minor":150075,"currency":"THB"}`, New(150075, "THB"), nil},
+		{`{"amount":"12.345","currency":"USD"}`, New(1235, "USD"), nil},
+		{`{"amount":12.5,"currency":"JPY"}`, New(13, "JPY"), nil},
+		{`{"amount":"1.00","amount_minor":7,"currency":"THB"}`, New(7, "THB"), nil},
+		{`{"amount":1e100000000,"currency":"THB"}`, Money{}, ErrInvalidAmount},
+		{`{"amount":"1.00","currency":"XYZ"}`, Money{}, ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		var got Money
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %v, %v; want %v, %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
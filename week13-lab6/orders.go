@@ -0,0 +1,691 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"week13-lab6/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Orders & Checkout =====================
+
+const (
+	orderPending   = "pending"
+	orderPaid      = "paid"
+	orderShipped   = "shipped"
+	orderDelivered = "delivered"
+	orderCancelled = "cancelled"
+)
+
+type orderAction struct {
+	Name  string
+	From  []string
+	To    string
+	Stamp string // คอลัมน์เวลาที่ตั้งเป็น NOW() ตอนเปลี่ยนสถานะ
+}
+
+var (
+	orderActionPay     = orderAction{Name: "pay", From: []string{orderPending}, To: orderPaid, Stamp: "paid_at"}
+	orderActionShip    = orderAction{Name: "ship", From: []string{orderPaid}, To: orderShipped, Stamp: "shipped_at"}
+	orderActionDeliver = orderAction{Name: "deliver", From: []string{orderShipped}, To: orderDelivered, Stamp: "delivered_at"}
+	orderActionCancel  = orderAction{Name: "cancel", From: []string{orderPending, orderPaid}, To: orderCancelled, Stamp: "cancelled_at"}
+)
+
+func (a orderAction) allowedFrom(status string) bool {
+	for _, s := range a.From {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+type Order struct {
+	ID              int                `json:"id"`
+	UserID          *int               `json:"user_id"`
+	Status          string             `json:"status"`
+	Currency        string             `json:"currency"`
+	FXRate          string             `json:"fx_rate"` // สกุลของ order ต่อ 1 บาท ณ ตอน checkout
+	Subtotal        money.Money        `json:"subtotal"`
+	DiscountTotal   money.Money        `json:"discount_total"`
+	Total           money.Money        `json:"total"`
+	Tax             TaxSummary         `json:"tax"`
+	ShippingAddress string             `json:"shipping_address"`
+	Note            string             `json:"note"`
+	TrackingNumber  string             `json:"tracking_number,omitempty"`
+	CancelReason    string             `json:"cancel_reason,omitempty"`
+	Items           []OrderItem        `json:"items,omitempty"`
+	Promotions      []AppliedPromotion `json:"promotions,omitempty"` // รวมอยู่ใน discount_total แล้ว
+	CreatedAt       time.Time          `json:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at"`
+	PaidAt          *time.Time         `json:"paid_at,omitempty"`
+	ShippedAt       *time.Time         `json:"shipped_at,omitempty"`
+	DeliveredAt     *time.Time         `json:"delivered_at,omitempty"`
+	CancelledAt     *time.Time         `json:"cancelled_at,omitempty"`
+}
+
+type OrderItem struct {
+	ID        int         `json:"id"`
+	BookID    *int        `json:"book_id"` // null เมื่อหนังสือถูก purge ไปแล้ว
+	Title     string      `json:"title"`
+	ISBN      string      `json:"isbn"`
+	Quantity  int         `json:"quantity"`
+	ListPrice money.Money `json:"list_price"`
+	UnitPrice money.Money `json:"unit_price"`
+	Discount  int         `json:"discount"`
+	LineTotal money.Money `json:"line_total"`
+}
+
+type CheckoutRequest struct {
+	ShippingAddress string `json:"shipping_address" binding:"required,max=1000"`
+	Note            string `json:"note" binding:"max=1000"`
+	Currency        string `json:"currency" binding:"omitempty,len=3"` // ไม่ส่ง = THB
+}
+
+type ShipOrderRequest struct {
+	TrackingNumber string `json:"tracking_number" binding:"max=100"`
+}
+
+type CancelOrderRequest struct {
+	Reason string `json:"reason" binding:"max=1000"`
+}
+
+// orderTransitionError means the order is not in a status the action accepts.
+type orderTransitionError struct {
+	Action  orderAction
+	Current string
+}
+
+func (e *orderTransitionError) Error() string {
+	return fmt.Sprintf("cannot %s an order in status %s", e.Action.Name, e.Current)
+}
+
+const orderColumns = `id, user_id, status, currency, fx_rate::text,
+	subtotal_minor, discount_minor, total_minor, vat_minor, vat_rate_bp, prices_include_vat,
+	shipping_address, note, tracking_number, cancel_reason,
+	created_at, updated_at, paid_at, shipped_at, delivered_at, cancelled_at`
+
+func scanOrder(row rowScanner) (Order, error) {
+	var o Order
+	var subtotal, discount, total, vat int64
+	err := row.Scan(
+		&o.ID, &o.UserID, &o.Status, &o.Currency, &o.FXRate,
+		&subtotal, &discount, &total, &vat, &o.Tax.RateBP, &o.Tax.Inclusive,
+		&o.ShippingAddress, &o.Note, &o.TrackingNumber, &o.CancelReason,
+		&o.CreatedAt, &o.UpdatedAt, &o.PaidAt, &o.ShippedAt, &o.DeliveredAt, &o.CancelledAt,
+	)
+	o.Subtotal = money.New(subtotal, o.Currency)
+	o.DiscountTotal = money.New(discount, o.Currency)
+	o.Total = money.New(total, o.Currency)
+	o.Tax.VAT = money.New(vat, o.Currency)
+	o.Tax.Gross = o.Total
+	o.Tax.Net = o.Total.Sub(o.Tax.VAT)
+	return o, err
+}
+
+// loadOrderItems reads the order's lines; currency is the order's currency.
+func loadOrderItems(q queryer, orderID int, currency string) ([]OrderItem, error) {
+	rows, err := q.Query(
+		`SELECT id, book_id, title, isbn, quantity, list_price_minor, unit_price_minor, discount, line_total_minor
+		 FROM order_items WHERE order_id = $1 ORDER BY id`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []OrderItem{}
+	for rows.Next() {
+		var it OrderItem
+		var list, unit, line int64
+		err := rows.Scan(&it.ID, &it.BookID, &it.Title, &it.ISBN, &it.Quantity, &list, &unit, &it.Discount, &line)
+		if err != nil {
+			return nil, err
+		}
+		it.ListPrice = money.New(list, currency)
+		it.UnitPrice = money.New(unit, currency)
+		it.LineTotal = money.New(line, currency)
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// ownsOrder reports whether the caller placed the order or may read every order.
+func ownsOrder(c *gin.Context, order Order) bool {
+	userID := c.GetInt("user_id")
+	if order.UserID != nil && *order.UserID == userID {
+		return true
+	}
+	return checkUserPermission(c.Request.Context(), userID, "orders:read")
+}
+
+// checkoutLine is a cart row priced inside the checkout transaction.
+type checkoutLine struct {
+	OrderItem
+	bookID    int
+	available bool
+}
+
+// @Summary Check out the cart
+// @Description Converts the caller's cart into a pending order in one transaction: prices are snapshotted, per-book discounts, promotions and the cart coupon applied, stock reserved and the cart emptied
+// @Tags Orders
+// @Accept  json
+// @Produce  json
+// @Param   body  body  CheckoutRequest  true  "Shipping details"
+// @Success 201  {object}  Order
+// @Failure 409  {object}  Problem
+// @Router  /orders [post]
+func createOrder(c *gin.Context) {
+	var req CheckoutRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	// อัตราแลกเปลี่ยน ณ ตอนนี้ถูกบันทึกไว้กับ order
+	pc, err := loadPriceContext(db, req.Currency)
+	if err != nil {
+		respondPriceContextError(c, "currency", err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// ล็อกตะกร้า กันการกด checkout ซ้ำพร้อมกัน
+	var cartID int
+	var couponCode sql.NullString
+	err = tx.QueryRow("SELECT id, coupon_code FROM carts WHERE user_id = $1 FOR UPDATE", userID).Scan(&cartID, &couponCode)
+	if err != nil && err != sql.ErrNoRows {
+		respondInternalError(c, err)
+		return
+	}
+
+	// เรียงตาม book_id ให้ทุก transaction ล็อกแถว stock ในลำดับเดียวกัน (กัน deadlock)
+	rows, err := tx.Query(
+		`SELECT b.id, b.title, b.isbn, ci.quantity, `+bookPriceColumns("$3")+`,
+		        b.deleted_at IS NULL AND b.status = $2
+		 FROM cart_items ci
+		 JOIN books b ON b.id = ci.book_id
+		 WHERE ci.cart_id = $1
+		 ORDER BY b.id`,
+		cartID, statusPublished, pc.Currency,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	var lines []checkoutLine
+	for rows.Next() {
+		var l checkoutLine
+		var price int64
+		var originalPrice, listed *int64
+		err := rows.Scan(&l.bookID, &l.Title, &l.ISBN, &l.Quantity, &price, &originalPrice, &l.Discount, &listed, &l.available)
+		if err != nil {
+			rows.Close()
+			respondInternalError(c, err)
+			return
+		}
+		l.ListPrice, l.UnitPrice = pc.bookPrices(price, originalPrice, l.Discount, listed)
+		l.LineTotal = l.UnitPrice.Mul(int64(l.Quantity))
+		lines = append(lines, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	if len(lines) == 0 {
+		respondProblem(c, http.StatusConflict, codeCartEmpty, "the cart is empty")
+		return
+	}
+	var unavailable []int
+	for _, l := range lines {
+		if !l.available {
+			unavailable = append(unavailable, l.bookID)
+		}
+	}
+	if len(unavailable) > 0 {
+		respondProblemWith(c, Problem{
+			Status:     http.StatusConflict,
+			Code:       codeConflict,
+			Detail:     "some books in the cart are no longer for sale",
+			Extensions: gin.H{"book_ids": unavailable},
+		})
+		return
+	}
+
+	subtotal, goods := money.New(0, pc.Currency), money.New(0, pc.Currency)
+	pricing := make([]pricingLine, len(lines))
+	for i, l := range lines {
+		subtotal = subtotal.Add(l.ListPrice.Mul(int64(l.Quantity)))
+		goods = goods.Add(l.LineTotal)
+		pricing[i] = pricingLine{BookID: l.bookID, Quantity: l.Quantity, LineTotal: l.LineTotal}
+	}
+
+	// คำนวณโปรใหม่ภายใน transaction และล็อกโปรที่จำกัดสิทธิ์ไว้จน commit
+	promotions, rejection, err := evaluatePromotions(tx, pc, pricing, userID, couponCode.String, true)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if rejection != nil {
+		respondProblemWith(c, Problem{
+			Status:     http.StatusConflict,
+			Code:       codeCouponInvalid,
+			Detail:     rejection.Message,
+			Extensions: gin.H{"reason": rejection.Reason, "coupon_code": couponCode.String},
+		})
+		return
+	}
+	goods = goods.Sub(sumPromotions(pc.Currency, promotions))
+	tax := applyVAT(goods, vatRateBP, pricesIncludeVAT)
+
+	order, err := scanOrder(tx.QueryRow(
+		`INSERT INTO orders (user_id, status, currency, fx_rate, subtotal_minor, discount_minor, total_minor,
+		                     vat_minor, vat_rate_bp, prices_include_vat, shipping_address, note)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		 RETURNING `+orderColumns,
+		userID, orderPending, pc.Currency, pc.Rate.FloatString(8),
+		subtotal.Amount, subtotal.Sub(goods).Amount, tax.Gross.Amount,
+		tax.VAT.Amount, tax.RateBP, tax.Inclusive, req.ShippingAddress, req.Note,
+	))
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	for _, l := range lines {
+		if err := reserveStock(tx, l.bookID, l.Quantity); err != nil {
+			if stockErr, ok := err.(*insufficientStockError); ok {
+				respondInsufficientStock(c, stockErr)
+				return
+			}
+			respondInternalError(c, err)
+			return
+		}
+		_, err := tx.Exec(
+			`INSERT INTO order_items (order_id, book_id, title, isbn, quantity,
+			                          list_price_minor, unit_price_minor, discount, line_total_minor)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			order.ID, l.bookID, l.Title, l.ISBN, l.Quantity,
+			l.ListPrice.Amount, l.UnitPrice.Amount, l.Discount, l.LineTotal.Amount,
+		)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+	}
+
+	for _, p := range promotions {
+		_, err := tx.Exec(
+			`INSERT INTO promotion_redemptions (promotion_id, order_id, user_id, name, code, amount_minor)
+			 VALUES ($1, $2, $3, $4, $5, $6)`,
+			p.PromotionID, order.ID, userID, p.Name, nullableCode(p.Code), p.Amount.Amount,
+		)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+	}
+
+	autoPaid := order.Total.Amount == 0
+	if autoPaid {
+		// ส่วนลดครอบคลุมทั้งหมด: ไม่มีอะไรให้จ่ายผ่าน provider
+		if order, _, err = transitionOrder(tx, order.ID, orderActionPay, userID); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM cart_items WHERE cart_id = $1", cartID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if _, err := tx.Exec("UPDATE carts SET coupon_code = NULL WHERE id = $1", cartID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if order.Items, err = loadOrderItems(tx, order.ID, order.Currency); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	order.Promotions = promotions
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	for _, l := range lines {
+		bookCache.invalidate(l.bookID) // in_stock อาจเปลี่ยน
+	}
+
+	// Log audit
+	logAudit(userID, "create", "orders", order.ID, gin.H{
+		"items":      len(lines),
+		"total":      order.Total.String(),
+		"currency":   order.Currency,
+		"promotions": len(promotions),
+	}, c)
+	if autoPaid {
+		logAudit(userID, orderActionPay.Name, "orders", order.ID, gin.H{
+			"from": orderPending,
+			"to":   order.Status,
+			"auto": true,
+		}, c)
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+// @Summary List orders
+// @Description The caller's own orders; with all=true (orders:read) every order
+// @Tags Orders
+// @Produce  json
+// @Param   all     query  bool    false  "All customers (staff only)"
+// @Param   status  query  string  false  "Filter by status"
+// @Param   limit   query  int     false  "Page size (max 100)"
+// @Param   offset  query  int     false  "Offset"
+// @Success 200  {array}  Order
+// @Router  /orders [get]
+func getOrders(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	limit, offset, err := parsePage(c, 20, 100)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	query := "SELECT " + orderColumns + " FROM orders WHERE TRUE"
+	var args []interface{}
+	if c.Query("all") == "true" {
+		if !checkUserPermission(c.Request.Context(), userID, "orders:read") {
+			respondProblemWith(c, Problem{
+				Status:     http.StatusForbidden,
+				Code:       codeForbidden,
+				Detail:     "insufficient permissions",
+				Extensions: gin.H{"required": "orders:read"},
+			})
+			return
+		}
+	} else {
+		args = append(args, userID)
+		query += fmt.Sprintf(" AND user_id = $%d", len(args))
+	}
+	if status := c.Query("status"); status != "" {
+		args = append(args, status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+
+	args = append(args, limit, offset)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		orders = append(orders, o)
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+func getOrder(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid order id")
+		return
+	}
+
+	order, err := scanOrder(db.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = $1", id))
+	if err == nil && !ownsOrder(c, order) {
+		err = sql.ErrNoRows // ไม่บอกว่า order ของคนอื่นมีอยู่จริง
+	}
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "order not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	if order.Items, err = loadOrderItems(db, id, order.Currency); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if order.Promotions, err = loadOrderPromotions(db, id, order.Currency); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// transitionOrder locks the order, moves it through action and applies the
+// stock side effects: cancelling releases the reservation, shipping turns it
+// into a sale. It returns the updated order and its previous status; the
+// caller commits and then calls invalidateOrderBooks, so no other request
+// can refill the book cache with pre-commit stock in between.
+func transitionOrder(tx *sql.Tx, id int, action orderAction, userID int) (Order, string, error) {
+	order, err := scanOrder(tx.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		return Order{}, "", err
+	}
+	from := order.Status
+	if !action.allowedFrom(from) {
+		return order, from, &orderTransitionError{Action: action, Current: from}
+	}
+
+	items, err := loadOrderItems(tx, id, order.Currency)
+	if err != nil {
+		return Order{}, from, err
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return derefBookID(items[i].BookID) < derefBookID(items[j].BookID)
+	})
+
+	reference := fmt.Sprintf("order:%d", id)
+	for _, it := range items {
+		if it.BookID == nil {
+			continue
+		}
+		switch action.To {
+		case orderCancelled:
+			err = releaseStock(tx, *it.BookID, it.Quantity)
+		case orderShipped:
+			err = sellReservedStock(tx, *it.BookID, it.Quantity, reference, userID)
+		}
+		if err != nil {
+			return Order{}, from, err
+		}
+	}
+
+	order, err = scanOrder(tx.QueryRow(
+		"UPDATE orders SET status = $1, "+action.Stamp+" = NOW() WHERE id = $2 RETURNING "+orderColumns,
+		action.To, id,
+	))
+	if err != nil {
+		return Order{}, from, err
+	}
+	order.Items = items
+	return order, from, nil
+}
+
+// invalidateOrderBooks drops the cached books of items (in_stock may have
+// changed). Call it only after the transaction has committed.
+func invalidateOrderBooks(items []OrderItem) {
+	for _, it := range items {
+		if it.BookID != nil {
+			bookCache.invalidate(*it.BookID)
+		}
+	}
+}
+
+func derefBookID(id *int) int {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+// respondOrderError maps transitionOrder errors to problems.
+func respondOrderError(c *gin.Context, err error) {
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "order not found")
+		return
+	}
+	if transErr, ok := err.(*orderTransitionError); ok {
+		respondProblemWith(c, Problem{
+			Status: http.StatusConflict,
+			Code:   codeInvalidTransition,
+			Detail: transErr.Error(),
+			Extensions: gin.H{
+				"action":         transErr.Action.Name,
+				"current_status": transErr.Current,
+				"required":       transErr.Action.From,
+			},
+		})
+		return
+	}
+	respondInternalError(c, err)
+}
+
+// orderTransitionHandler handles the staff-only pay, ship and deliver actions.
+func orderTransitionHandler(action orderAction) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid order id")
+			return
+		}
+
+		var tracking string
+		if action.To == orderShipped {
+			var req ShipOrderRequest
+			if !bindOptionalJSON(c, &req) {
+				return
+			}
+			tracking = req.TrackingNumber
+		}
+		userID := c.GetInt("user_id")
+
+		tx, err := db.Begin()
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		defer tx.Rollback()
+
+		order, from, err := transitionOrder(tx, id, action, userID)
+		if err != nil {
+			respondOrderError(c, err)
+			return
+		}
+		if tracking != "" {
+			if _, err := tx.Exec("UPDATE orders SET tracking_number = $1 WHERE id = $2", tracking, id); err != nil {
+				respondInternalError(c, err)
+				return
+			}
+			order.TrackingNumber = tracking
+		}
+		if err := tx.Commit(); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		invalidateOrderBooks(order.Items)
+
+		// Log audit
+		details := gin.H{"from": from, "to": order.Status}
+		if tracking != "" {
+			details["tracking_number"] = tracking
+		}
+		logAudit(userID, action.Name, "orders", id, details, c)
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// cancelOrder ลูกค้ายกเลิกได้เฉพาะ order ของตัวเองที่ยัง pending
+// staff (orders:update) ยกเลิกได้ทั้ง pending และ paid
+func cancelOrder(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid order id")
+		return
+	}
+
+	var req CancelOrderRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	before, err := scanOrder(tx.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	action := orderActionCancel
+	if !checkUserPermission(c.Request.Context(), userID, "orders:update") {
+		if before.UserID == nil || *before.UserID != userID {
+			respondProblem(c, http.StatusNotFound, codeNotFound, "order not found")
+			return
+		}
+		action.From = []string{orderPending}
+	}
+
+	order, from, err := transitionOrder(tx, id, action, userID)
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+	if req.Reason != "" {
+		if _, err := tx.Exec("UPDATE orders SET cancel_reason = $1 WHERE id = $2", req.Reason, id); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		order.CancelReason = req.Reason
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	invalidateOrderBooks(order.Items)
+
+	// Log audit
+	logAudit(userID, "cancel", "orders", id, gin.H{
+		"from":   from,
+		"to":     order.Status,
+		"reason": req.Reason,
+	}, c)
+
+	c.JSON(http.StatusOK, order)
+}
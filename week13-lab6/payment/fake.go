@@ -0,0 +1,130 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Fake is an in-memory provider for local development. Payments complete
+// only when Simulate is called, which produces a webhook signed exactly as
+// a real provider would.
+type Fake struct {
+	secret []byte
+
+	mu      sync.Mutex
+	intents map[string]*Intent
+}
+
+func NewFake(secret string) *Fake {
+	return &Fake{secret: []byte(secret), intents: make(map[string]*Intent)}
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) CreateIntent(ctx context.Context, req IntentRequest) (Intent, error) {
+	if req.Amount <= 0 {
+		return Intent{}, ErrInvalidAmount
+	}
+	intent := &Intent{
+		ID:           "fake_pi_" + randomHex(12),
+		Status:       StatusRequiresAction,
+		Amount:       req.Amount,
+		Currency:     req.Currency,
+		ClientSecret: "fake_secret_" + randomHex(16),
+	}
+
+	f.mu.Lock()
+	f.intents[intent.ID] = intent
+	f.mu.Unlock()
+	return *intent, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, intentID string, amount int64) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return Intent{}, ErrUnknownIntent
+	}
+	if amount <= 0 || amount > intent.Amount {
+		return Intent{}, ErrInvalidAmount
+	}
+	intent.Status = StatusSucceeded
+	intent.Amount = amount
+	return *intent, nil
+}
+
+func (f *Fake) Refund(ctx context.Context, intentID string, amount int64) (Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return Refund{}, ErrUnknownIntent
+	}
+	if amount <= 0 || amount > intent.Amount {
+		return Refund{}, ErrInvalidAmount
+	}
+	intent.Status = StatusRefunded
+	return Refund{ID: "fake_re_" + randomHex(12), IntentID: intentID, Amount: amount}, nil
+}
+
+// fakeWebhook is the JSON body of a Fake webhook.
+type fakeWebhook struct {
+	ID       string    `json:"id"`
+	Type     EventType `json:"type"`
+	IntentID string    `json:"intent_id"`
+	Amount   int64     `json:"amount"`
+	RefundID string    `json:"refund_id,omitempty"`
+}
+
+func (f *Fake) VerifyWebhook(header http.Header, body []byte) (Event, error) {
+	if err := VerifySignature(f.secret, header.Get(SignatureHeader), body, DefaultTolerance, time.Now()); err != nil {
+		return Event{}, err
+	}
+	var w fakeWebhook
+	if err := json.Unmarshal(body, &w); err != nil {
+		return Event{}, err
+	}
+	return Event{ID: w.ID, Type: w.Type, IntentID: w.IntentID, Amount: w.Amount, RefundID: w.RefundID}, nil
+}
+
+// Simulate returns a signed webhook body and header announcing eventType for
+// the intent, as the gateway would send after the customer pays.
+func (f *Fake) Simulate(intentID string, eventType EventType) ([]byte, http.Header, error) {
+	f.mu.Lock()
+	intent, ok := f.intents[intentID]
+	var amount int64
+	if ok {
+		amount = intent.Amount
+	}
+	f.mu.Unlock()
+	if !ok {
+		return nil, nil, ErrUnknownIntent
+	}
+
+	body, err := json.Marshal(fakeWebhook{
+		ID:       "fake_evt_" + randomHex(12),
+		Type:     eventType,
+		IntentID: intentID,
+		Amount:   amount,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	header.Set(SignatureHeader, Sign(f.secret, body, time.Now()))
+	return body, header, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
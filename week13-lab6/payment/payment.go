@@ -0,0 +1,88 @@
+// Package payment defines the provider abstraction used by checkout and the
+// providers the bookstore ships with.
+//
+// Amounts are always integer minor units (satang for THB) so that no
+// provider sees a rounded float. Providers never touch the database; the
+// caller persists intents and applies webhook events to orders.
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrNotSupported     = errors.New("operation not supported by this provider")
+	ErrUnknownIntent    = errors.New("payment intent not found")
+	ErrInvalidSignature = errors.New("webhook signature is invalid")
+	ErrStaleSignature   = errors.New("webhook timestamp is outside the tolerance window")
+	ErrInvalidAmount    = errors.New("amount must be positive and not exceed the captured amount")
+)
+
+type Status string
+
+const (
+	StatusRequiresAction Status = "requires_action" // รอลูกค้าจ่าย (กรอกบัตร/สแกน QR)
+	StatusAuthorized     Status = "authorized"      // บัตรผ่าน auth แล้ว รอ capture
+	StatusSucceeded      Status = "succeeded"
+	StatusFailed         Status = "failed"
+	StatusRefunded       Status = "refunded"
+)
+
+type EventType string
+
+const (
+	EventSucceeded EventType = "payment.succeeded"
+	EventFailed    EventType = "payment.failed"
+	EventRefunded  EventType = "payment.refunded"
+)
+
+type IntentRequest struct {
+	Reference string // เช่น order:42 ใช้เทียบกับ event ภายหลัง
+	Amount    int64
+	Currency  string
+}
+
+type Intent struct {
+	ID       string
+	Status   Status
+	Amount   int64
+	Currency string
+
+	// ClientSecret is handed to the browser for card confirmation.
+	ClientSecret string
+	// QRPayload is the EMVCo payload to render as a QR code.
+	QRPayload string
+	ExpiresAt *time.Time
+}
+
+type Refund struct {
+	ID       string
+	IntentID string
+	Amount   int64
+}
+
+// Event is a verified webhook notification.
+type Event struct {
+	ID       string // ใช้กันการประมวลผลซ้ำ (provider อาจส่ง event เดิมหลายครั้ง)
+	Type     EventType
+	IntentID string
+	Amount   int64
+	// RefundID identifies the refund a payment.refunded event reports, so
+	// the echo of a refund made through the API is not applied twice.
+	RefundID string
+}
+
+// Provider is implemented by every payment gateway.
+type Provider interface {
+	Name() string
+	CreateIntent(ctx context.Context, req IntentRequest) (Intent, error)
+	// Capture collects an authorized amount. Providers that settle
+	// immediately return ErrNotSupported.
+	Capture(ctx context.Context, intentID string, amount int64) (Intent, error)
+	Refund(ctx context.Context, intentID string, amount int64) (Refund, error)
+	// VerifyWebhook authenticates the request and decodes its event.
+	VerifyWebhook(header http.Header, body []byte) (Event, error)
+}
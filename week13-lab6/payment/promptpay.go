@@ -0,0 +1,84 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"week13-lab6/promptpay"
+)
+
+// PromptPay collects bank transfers through a dynamic PromptPay QR. Transfers
+// settle immediately, so there is nothing to capture, and refunds are made
+// manually from the bank. Confirmations arrive from the bank's (or a slip
+// verification service's) notification, signed with the shared secret.
+type PromptPay struct {
+	target string
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewPromptPay creates a provider paying into target (mobile number,
+// national/tax ID or e-wallet ID). QR codes expire after ttl.
+func NewPromptPay(target, secret string, ttl time.Duration) *PromptPay {
+	return &PromptPay{target: target, secret: []byte(secret), ttl: ttl}
+}
+
+func (p *PromptPay) Name() string { return "promptpay" }
+
+func (p *PromptPay) CreateIntent(ctx context.Context, req IntentRequest) (Intent, error) {
+	if req.Amount <= 0 {
+		return Intent{}, ErrInvalidAmount
+	}
+	if req.Currency != "" && req.Currency != "THB" {
+		return Intent{}, ErrNotSupported
+	}
+	payload, err := promptpay.Payload(p.target, req.Amount)
+	if err != nil {
+		return Intent{}, err
+	}
+
+	expires := time.Now().Add(p.ttl)
+	return Intent{
+		// ธนาคารอ้างถึงรายการด้วย reference ที่เราส่งไปกับ QR
+		ID:        req.Reference,
+		Status:    StatusRequiresAction,
+		Amount:    req.Amount,
+		Currency:  "THB",
+		QRPayload: payload,
+		ExpiresAt: &expires,
+	}, nil
+}
+
+func (p *PromptPay) Capture(ctx context.Context, intentID string, amount int64) (Intent, error) {
+	return Intent{}, ErrNotSupported
+}
+
+func (p *PromptPay) Refund(ctx context.Context, intentID string, amount int64) (Refund, error) {
+	return Refund{}, ErrNotSupported
+}
+
+// promptPayNotification is the body posted by the transfer notifier.
+type promptPayNotification struct {
+	TransactionID string `json:"transaction_id"`
+	Reference     string `json:"reference"`
+	Amount        int64  `json:"amount"` // satang
+	Status        string `json:"status"` // success | failed
+}
+
+func (p *PromptPay) VerifyWebhook(header http.Header, body []byte) (Event, error) {
+	if err := VerifySignature(p.secret, header.Get(SignatureHeader), body, DefaultTolerance, time.Now()); err != nil {
+		return Event{}, err
+	}
+	var n promptPayNotification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return Event{}, err
+	}
+
+	eventType := EventSucceeded
+	if n.Status != "success" {
+		eventType = EventFailed
+	}
+	return Event{ID: n.TransactionID, Type: eventType, IntentID: n.Reference, Amount: n.Amount}, nil
+}
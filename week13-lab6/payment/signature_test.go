@@ -0,0 +1,50 @@
+package payment
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("whsec_current")
+	oldSecret := []byte("whsec_previous")
+	body := []byte(`{"id":"evt_1","amount":12900}`)
+	now := time.Unix(1_760_000_000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	mac := computeMAC(secret, ts, body)
+
+	tests := []struct {
+		name    string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", Sign(secret, body, now), body, now, nil},
+		{"valid within tolerance", Sign(secret, body, now), body, now.Add(DefaultTolerance), nil},
+		{"spaces after comma", "t=" + ts + ", v1=" + mac, body, now, nil},
+		{"tampered body", Sign(secret, body, now), []byte(`{"id":"evt_1","amount":1}`), now, ErrInvalidSignature},
+		{"wrong secret", Sign([]byte("other"), body, now), body, now, ErrInvalidSignature},
+		{"stale timestamp", Sign(secret, body, now), body, now.Add(DefaultTolerance + time.Second), ErrStaleSignature},
+		{"future timestamp", Sign(secret, body, now.Add(DefaultTolerance+time.Second)), body, now, ErrStaleSignature},
+		// ตอนหมุน secret ผู้ส่งแนบลายเซ็นทั้งของ secret เก่าและใหม่
+		{"rotation new first", "t=" + ts + ",v1=" + mac + ",v1=" + computeMAC(oldSecret, ts, body), body, now, nil},
+		{"rotation new last", "t=" + ts + ",v1=" + computeMAC(oldSecret, ts, body) + ",v1=" + mac, body, now, nil},
+		{"rotation none match", "t=" + ts + ",v1=" + computeMAC(oldSecret, ts, body) + ",v1=deadbeef", body, now, ErrInvalidSignature},
+		{"empty header", "", body, now, ErrInvalidSignature},
+		{"missing timestamp", "v1=" + mac, body, now, ErrInvalidSignature},
+		{"missing v1", "t=" + ts, body, now, ErrInvalidSignature},
+		{"non-numeric timestamp", "t=yesterday,v1=" + mac, body, now, ErrInvalidSignature},
+		{"parts without equals", "t" + ts + ",v1" + mac, body, now, ErrInvalidSignature},
+		{"unknown scheme only", "t=" + ts + ",v0=" + mac, body, now, ErrInvalidSignature},
+		{"timestamp not covered by MAC", "t=" + strconv.FormatInt(now.Unix()+1, 10) + ",v1=" + mac, body, now, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		err := VerifySignature(secret, tt.header, tt.body, DefaultTolerance, tt.now)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFakeWebhook(t *testing.T) {
+	f := NewFake("whsec_fake")
+	intent, err := f.CreateIntent(context.Background(), IntentRequest{Reference: "order:42", Amount: 12900, Currency: "THB"})
+	if err != nil {
+		t.Fatalf("CreateIntent: %v", err)
+	}
+
+	body, header, err := f.Simulate(intent.ID, EventSucceeded)
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	event, err := f.VerifyWebhook(header, body)
+	if err != nil {
+		t.Fatalf("VerifyWebhook: %v", err)
+	}
+	if event.ID == "" || event.Type != EventSucceeded || event.IntentID != intent.ID || event.Amount != 12900 {
+		t.Errorf("event = %+v", event)
+	}
+
+	if _, err := NewFake("whsec_other").VerifyWebhook(header, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other secret: err = %v, want %v", err, ErrInvalidSignature)
+	}
+	if _, _, err := f.Simulate("fake_pi_missing", EventSucceeded); !errors.Is(err, ErrUnknownIntent) {
+		t.Errorf("unknown intent: err = %v, want %v", err, ErrUnknownIntent)
+	}
+}
+
+func TestPromptPayWebhook(t *testing.T) {
+	secret := []byte("whsec_promptpay")
+	p := NewPromptPay("0812345678", string(secret), 15*time.Minute)
+	signed := func(body string) http.Header {
+		h := http.Header{}
+		h.Set(SignatureHeader, Sign(secret, []byte(body), time.Now()))
+		return h
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		header  http.Header
+		want    Event
+		wantErr error
+	}{
+		{
+			name: "success",
+			body: `{"transaction_id":"TX1","reference":"order:42","amount":12900,"status":"success"}`,
+			want: Event{ID: "TX1", Type: EventSucceeded, IntentID: "order:42", Amount: 12900},
+		},
+		{
+			name: "failed",
+			body: `{"transaction_id":"TX2","reference":"order:43","amount":5000,"status":"failed"}`,
+			want: Event{ID: "TX2", Type: EventFailed, IntentID: "order:43", Amount: 5000},
+		},
+		{
+			name: "unknown status is not a success",
+			body: `{"transaction_id":"TX3","reference":"order:44","amount":5000,"status":"pending"}`,
+			want: Event{ID: "TX3", Type: EventFailed, IntentID: "order:44", Amount: 5000},
+		},
+		{
+			name:    "unsigned",
+			body:    `{"transaction_id":"TX4","reference":"order:45","amount":5000,"status":"success"}`,
+			header:  http.Header{},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "signed for another body",
+			body:    `{"transaction_id":"TX5","reference":"order:46","amount":1,"status":"success"}`,
+			header:  signed(`{"transaction_id":"TX5","reference":"order:46","amount":5000,"status":"success"}`),
+			wantErr: ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		header := tt.header
+		if header == nil {
+			header = signed(tt.body)
+		}
+		event, err := p.VerifyWebhook(header, []byte(tt.body))
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && event != tt.want {
+			t.Errorf("%s: event = %+v, want %+v", tt.name, event, tt.want)
+		}
+	}
+
+	header := signed("not json")
+	if _, err := p.VerifyWebhook(header, []byte("not json")); err == nil {
+		t.Error("malformed body: expected an error")
+	}
+}
@@ -0,0 +1,649 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"week13-lab6/money"
+	"week13-lab6/payment"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Payments =====================
+
+// paymentProviders holds the providers enabled by configuration, by name.
+var paymentProviders = map[string]payment.Provider{}
+
+// fakePayments is set when the fake provider is enabled (local development).
+var fakePayments *payment.Fake
+
+const maxWebhookBody = 1 << 20
+
+func initPayments() {
+	if secret := cfg.Payments.FakeSecret; secret != "" {
+		fakePayments = payment.NewFake(secret)
+		paymentProviders[fakePayments.Name()] = fakePayments
+	}
+
+	if target := cfg.Payments.PromptPayID; target != "" {
+		// secret ว่าง = ใครก็คำนวณ MAC ได้ ห้ามเปิด provider แบบนั้น
+		if cfg.Payments.PromptPayWebhookSecret == "" {
+			log.Fatal("PROMPTPAY_WEBHOOK_SECRET is required when PROMPTPAY_ID is set")
+		}
+		pp := payment.NewPromptPay(target, cfg.Payments.PromptPayWebhookSecret, cfg.Payments.PromptPayQRTTL)
+		paymentProviders[pp.Name()] = pp
+	}
+
+	for name := range paymentProviders {
+		slog.Info("payment provider enabled", "provider", name)
+	}
+}
+
+type Payment struct {
+	ID               int         `json:"id"`
+	OrderID          int         `json:"order_id"`
+	Provider         string      `json:"provider"`
+	ProviderIntentID string      `json:"provider_intent_id"`
+	Status           string      `json:"status"`
+	Amount           money.Money `json:"amount"`
+	Refunded         money.Money `json:"refunded"`
+	ClientSecret     string      `json:"client_secret,omitempty"`
+	QRPayload        string      `json:"qr_payload,omitempty"`
+	ExpiresAt        *time.Time  `json:"expires_at,omitempty"`
+	SucceededAt      *time.Time  `json:"succeeded_at,omitempty"`
+	CreatedAt        time.Time   `json:"created_at"`
+	UpdatedAt        time.Time   `json:"updated_at"`
+}
+
+type CreatePaymentRequest struct {
+	Provider string `json:"provider" binding:"required,max=30"`
+}
+
+type RefundPaymentRequest struct {
+	// ไม่ส่ง = คืนเงินส่วนที่เหลือทั้งหมด
+	AmountMinor int64 `json:"amount_minor" binding:"gte=0"`
+}
+
+type SimulatePaymentRequest struct {
+	Event string `json:"event" binding:"required,oneof=succeeded failed"`
+}
+
+const paymentColumns = `id, order_id, provider, provider_intent_id, status, amount_minor, currency,
+	refunded_minor, client_secret, qr_payload, expires_at, succeeded_at, created_at, updated_at`
+
+func scanPayment(row rowScanner) (Payment, error) {
+	var p Payment
+	var amount, refunded int64
+	var currency string
+	err := row.Scan(
+		&p.ID, &p.OrderID, &p.Provider, &p.ProviderIntentID, &p.Status, &amount, &currency,
+		&refunded, &p.ClientSecret, &p.QRPayload, &p.ExpiresAt, &p.SucceededAt, &p.CreatedAt, &p.UpdatedAt,
+	)
+	p.Amount, p.Refunded = money.New(amount, currency), money.New(refunded, currency)
+	return p, err
+}
+
+func respondProviderError(c *gin.Context, err error) {
+	if err == payment.ErrNotSupported {
+		respondProblem(c, http.StatusConflict, codeConflict, "this payment provider does not support the operation")
+		return
+	}
+	slog.ErrorContext(c.Request.Context(), "payment provider error", "error", err)
+	respondProblem(c, http.StatusBadGateway, codePaymentProvider, "the payment provider rejected the request")
+}
+
+// @Summary Start paying for an order
+// @Description Creates a payment intent with the chosen provider. An unexpired pending intent for the same provider is returned instead of creating another.
+// @Tags Payments
+// @Accept  json
+// @Produce  json
+// @Param   id    path  int                   true  "Order ID"
+// @Param   body  body  CreatePaymentRequest  true  "Provider"
+// @Success 201  {object}  Payment
+// @Failure 409  {object}  Problem
+// @Router  /orders/{id}/payments [post]
+func createPayment(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid order id")
+		return
+	}
+
+	var req CreatePaymentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	provider, ok := paymentProviders[req.Provider]
+	if !ok {
+		respondValidation(c, []FieldError{{Field: "provider", Code: fieldInvalidFormat, Message: "is not an enabled payment provider"}})
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	order, err := scanOrder(db.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = $1", orderID))
+	if err == nil && (order.UserID == nil || *order.UserID != userID) {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "order not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if order.Status != orderPending {
+		respondOrderError(c, &orderTransitionError{Action: orderActionPay, Current: order.Status})
+		return
+	}
+	if order.Total.Amount <= 0 {
+		// createOrder ตั้ง order ยอดศูนย์เป็น paid ตั้งแต่ checkout; payments ต้องมียอด > 0
+		respondProblem(c, http.StatusConflict, codeConflict, "the order total is zero; there is nothing to pay")
+		return
+	}
+
+	existing, err := scanPayment(db.QueryRow(
+		`SELECT `+paymentColumns+` FROM payments
+		 WHERE order_id = $1 AND provider = $2 AND status = 'requires_action'
+		   AND (expires_at IS NULL OR expires_at > NOW())
+		 ORDER BY id DESC LIMIT 1`,
+		orderID, provider.Name(),
+	))
+	if err == nil {
+		c.JSON(http.StatusOK, existing)
+		return
+	} else if err != sql.ErrNoRows {
+		respondInternalError(c, err)
+		return
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	intent, err := provider.CreateIntent(c.Request.Context(), payment.IntentRequest{
+		Reference: fmt.Sprintf("order-%d-%s", orderID, hex.EncodeToString(suffix)),
+		Amount:    order.Total.Amount,
+		Currency:  order.Total.Currency,
+	})
+	if err != nil {
+		respondProviderError(c, err)
+		return
+	}
+
+	p, err := scanPayment(db.QueryRow(
+		`INSERT INTO payments (order_id, provider, provider_intent_id, status, amount_minor, currency,
+		                       client_secret, qr_payload, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 RETURNING `+paymentColumns,
+		orderID, provider.Name(), intent.ID, string(intent.Status), intent.Amount, intent.Currency,
+		intent.ClientSecret, intent.QRPayload, intent.ExpiresAt,
+	))
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// Log audit
+	logAudit(userID, "payment_create", "orders", orderID, gin.H{
+		"payment_id": p.ID,
+		"provider":   p.Provider,
+		"amount":     p.Amount.String(),
+		"currency":   p.Amount.Currency,
+	}, c)
+
+	c.JSON(http.StatusCreated, p)
+}
+
+func getOrderPayments(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid order id")
+		return
+	}
+
+	order, err := scanOrder(db.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = $1", orderID))
+	if err == nil && !ownsOrder(c, order) {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "order not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	rows, err := db.Query("SELECT "+paymentColumns+" FROM payments WHERE order_id = $1 ORDER BY id", orderID)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	payments := []Payment{}
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		payments = append(payments, p)
+	}
+
+	c.JSON(http.StatusOK, payments)
+}
+
+// markPaymentSucceeded records a successful payment and moves a pending
+// order to paid. A payment for an order that is no longer pending (e.g.
+// cancelled meanwhile) is kept and logged for manual refund.
+func markPaymentSucceeded(ctx context.Context, tx *sql.Tx, p Payment, userID int) error {
+	if p.Status == string(payment.StatusSucceeded) {
+		return nil
+	}
+	_, err := tx.Exec(
+		"UPDATE payments SET status = $1, succeeded_at = NOW() WHERE id = $2",
+		string(payment.StatusSucceeded), p.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = transitionOrder(tx, p.OrderID, orderActionPay, userID)
+	if transErr, ok := err.(*orderTransitionError); ok {
+		slog.ErrorContext(ctx, "payment succeeded but order cannot be paid; refund it manually",
+			"payment_id", p.ID, "order_id", p.OrderID, "order_status", transErr.Current)
+		return nil
+	}
+	return err
+}
+
+// refundRejectedError is returned by applyRefund for a refund that cannot
+// apply to the payment in its current state.
+type refundRejectedError struct {
+	Reason string
+}
+
+func (e *refundRejectedError) Error() string {
+	return "refund rejected: " + e.Reason
+}
+
+// applyRefund records the provider's refund refundID and adds amount to the
+// refunded total. p must be locked FOR UPDATE. applied is false when the
+// refund was recorded before (the webhook echo of an API refund, or the
+// reverse). A full refund cancels a paid order, which releases its stock
+// reservation; the items of a cancelled order are returned for
+// invalidateOrderBooks after commit.
+func applyRefund(tx *sql.Tx, p Payment, refundID string, amount int64, userID int) (released []OrderItem, applied bool, err error) {
+	if refundID == "" {
+		return nil, false, &refundRejectedError{Reason: "missing refund id"}
+	}
+	var seen bool
+	err = tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM payment_refunds WHERE provider = $1 AND refund_id = $2)",
+		p.Provider, refundID,
+	).Scan(&seen)
+	if err != nil || seen {
+		return nil, false, err
+	}
+
+	remaining := p.Amount.Amount - p.Refunded.Amount
+	switch {
+	case p.Status != string(payment.StatusSucceeded):
+		return nil, false, &refundRejectedError{Reason: "payment is " + p.Status}
+	case amount <= 0:
+		return nil, false, &refundRejectedError{Reason: "amount must be positive"}
+	case amount > remaining:
+		return nil, false, &refundRejectedError{Reason: fmt.Sprintf("amount %d exceeds the %d not yet refunded", amount, remaining)}
+	}
+
+	var createdBy *int
+	if userID > 0 {
+		createdBy = &userID
+	}
+	_, err = tx.Exec(
+		`INSERT INTO payment_refunds (provider, refund_id, payment_id, amount_minor, created_by)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		p.Provider, refundID, p.ID, amount, createdBy,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var refunded int64
+	err = tx.QueryRow(
+		`UPDATE payments
+		 SET refunded_minor = refunded_minor + $1,
+		     status = CASE WHEN refunded_minor + $1 = amount_minor THEN 'refunded' ELSE status END
+		 WHERE id = $2
+		 RETURNING refunded_minor`,
+		amount, p.ID,
+	).Scan(&refunded)
+	if err != nil || refunded < p.Amount.Amount {
+		return nil, err == nil, err
+	}
+
+	order, _, err := transitionOrder(tx, p.OrderID, orderActionCancel, userID)
+	if _, ok := err.(*orderTransitionError); ok {
+		return nil, true, nil // ส่งของไปแล้ว: คืนเงินได้แต่ไม่ยกเลิก order
+	} else if err != nil {
+		return nil, false, err
+	}
+	return order.Items, true, nil
+}
+
+// processPaymentEvent applies a verified webhook event exactly once.
+// duplicate is true when the event was already processed.
+func processPaymentEvent(ctx context.Context, providerName string, ev payment.Event, body []byte) (duplicate bool, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`INSERT INTO payment_events (provider, event_id, event_type, provider_intent_id, payload)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (provider, event_id) DO NOTHING`,
+		providerName, ev.ID, string(ev.Type), ev.IntentID, string(body),
+	)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return true, nil
+	}
+
+	p, err := scanPayment(tx.QueryRow(
+		"SELECT "+paymentColumns+" FROM payments WHERE provider = $1 AND provider_intent_id = $2 FOR UPDATE",
+		providerName, ev.IntentID,
+	))
+	if err == sql.ErrNoRows {
+		// เก็บ event ไว้ แต่ไม่มี payment ให้ผูก
+		slog.WarnContext(ctx, "payment event refers to unknown intent",
+			"provider", providerName, "event_id", ev.ID, "intent_id", ev.IntentID)
+		return false, tx.Commit()
+	} else if err != nil {
+		return false, err
+	}
+
+	action := ""
+	var released []OrderItem
+	switch ev.Type {
+	case payment.EventSucceeded:
+		if ev.Amount != p.Amount.Amount {
+			slog.WarnContext(ctx, "payment event amount does not match; not marking paid",
+				"payment_id", p.ID, "event_amount", ev.Amount, "amount", p.Amount.Amount)
+			break
+		}
+		action = "payment_succeeded"
+		err = markPaymentSucceeded(ctx, tx, p, 0)
+	case payment.EventFailed:
+		if p.Status == string(payment.StatusRequiresAction) || p.Status == string(payment.StatusAuthorized) {
+			action = "payment_failed"
+			_, err = tx.Exec("UPDATE payments SET status = $1 WHERE id = $2", string(payment.StatusFailed), p.ID)
+		}
+	case payment.EventRefunded:
+		var applied bool
+		released, applied, err = applyRefund(tx, p, ev.RefundID, ev.Amount, 0)
+		if rejected, ok := err.(*refundRejectedError); ok {
+			// เก็บ event ไว้ ส่ง error กลับไปก็จะถูกส่งซ้ำแบบเดิมอยู่ดี
+			slog.WarnContext(ctx, "refund event not applied",
+				"payment_id", p.ID, "event_id", ev.ID, "reason", rejected.Reason)
+			err = nil
+		} else if applied {
+			action = "payment_refunded"
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	invalidateOrderBooks(released)
+
+	if action != "" {
+		details := gin.H{
+			"payment_id": p.ID,
+			"provider":   providerName,
+			"event_id":   ev.ID,
+			"amount":     ev.Amount,
+		}
+		if ev.RefundID != "" {
+			details["refund_id"] = ev.RefundID
+		}
+		logAudit(0, action, "orders", p.OrderID, details, nil)
+	}
+	return false, nil
+}
+
+// paymentWebhook receives provider notifications. It is public; the
+// provider's signature is the authentication.
+func paymentWebhook(c *gin.Context) {
+	providerName := c.Param("provider")
+	provider, ok := paymentProviders[providerName]
+	if !ok {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "unknown payment provider")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "failed to read body")
+		return
+	}
+
+	handlePaymentWebhook(c, providerName, provider, c.Request.Header, body)
+}
+
+func handlePaymentWebhook(c *gin.Context, providerName string, provider payment.Provider, header http.Header, body []byte) {
+	ev, err := provider.VerifyWebhook(header, body)
+	if err == payment.ErrInvalidSignature || err == payment.ErrStaleSignature {
+		respondProblem(c, http.StatusUnauthorized, codeInvalidSignature, err.Error())
+		return
+	} else if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid webhook payload")
+		return
+	}
+
+	// 5xx ทำให้ provider ส่งซ้ำภายหลัง ซึ่งปลอดภัยเพราะประมวลผลแบบ idempotent
+	duplicate, err := processPaymentEvent(c.Request.Context(), providerName, ev, body)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true, "duplicate": duplicate})
+}
+
+func lockPaymentByID(c *gin.Context, tx *sql.Tx, id int) (Payment, payment.Provider, bool) {
+	p, err := scanPayment(tx.QueryRow("SELECT "+paymentColumns+" FROM payments WHERE id = $1 FOR UPDATE", id))
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "payment not found")
+		return p, nil, false
+	} else if err != nil {
+		respondInternalError(c, err)
+		return p, nil, false
+	}
+	provider, ok := paymentProviders[p.Provider]
+	if !ok {
+		respondProblem(c, http.StatusConflict, codeConflict, "payment provider "+p.Provider+" is no longer enabled")
+		return p, nil, false
+	}
+	return p, provider, true
+}
+
+// capturePayment collects an authorized card payment (staff only).
+func capturePayment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid payment id")
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	p, provider, ok := lockPaymentByID(c, tx, id)
+	if !ok {
+		return
+	}
+	if p.Status != string(payment.StatusAuthorized) && p.Status != string(payment.StatusRequiresAction) {
+		respondProblem(c, http.StatusConflict, codeConflict, "payment is "+p.Status)
+		return
+	}
+
+	if _, err := provider.Capture(c.Request.Context(), p.ProviderIntentID, p.Amount.Amount); err != nil {
+		respondProviderError(c, err)
+		return
+	}
+	if err := markPaymentSucceeded(c.Request.Context(), tx, p, userID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	p, err = scanPayment(tx.QueryRow("SELECT "+paymentColumns+" FROM payments WHERE id = $1", id))
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// Log audit
+	logAudit(userID, "payment_capture", "orders", p.OrderID, gin.H{"payment_id": p.ID}, c)
+
+	c.JSON(http.StatusOK, p)
+}
+
+// refundPayment refunds part or all of a succeeded payment (staff only).
+func refundPayment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid payment id")
+		return
+	}
+
+	var req RefundPaymentRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	p, provider, ok := lockPaymentByID(c, tx, id)
+	if !ok {
+		return
+	}
+	if p.Status != string(payment.StatusSucceeded) {
+		respondProblem(c, http.StatusConflict, codeConflict, "only succeeded payments can be refunded")
+		return
+	}
+	remaining := p.Amount.Amount - p.Refunded.Amount
+	amount := req.AmountMinor
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount > remaining {
+		respondValidation(c, []FieldError{{
+			Field:   "amount_minor",
+			Code:    fieldOutOfRange,
+			Message: fmt.Sprintf("must be at most %d", remaining),
+		}})
+		return
+	}
+
+	refund, err := provider.Refund(c.Request.Context(), p.ProviderIntentID, amount)
+	if err != nil {
+		respondProviderError(c, err)
+		return
+	}
+	// webhook payment.refunded ของ refund นี้ที่ตามมาจะถูกข้ามด้วย refund.ID
+	released, _, err := applyRefund(tx, p, refund.ID, amount, userID)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	p, err = scanPayment(tx.QueryRow("SELECT "+paymentColumns+" FROM payments WHERE id = $1", id))
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	invalidateOrderBooks(released)
+
+	// Log audit
+	logAudit(userID, "payment_refund", "orders", p.OrderID, gin.H{
+		"payment_id": p.ID,
+		"refund_id":  refund.ID,
+		"amount":     amount,
+	}, c)
+
+	c.JSON(http.StatusOK, p)
+}
+
+// simulatePayment ใช้ตอนพัฒนาเท่านั้น: ให้ fake provider ยิง webhook ที่ลงลายเซ็นแล้ว
+// ผ่านเส้นทางเดียวกับ webhook จริง
+func simulatePayment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid payment id")
+		return
+	}
+	if fakePayments == nil {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "the fake payment provider is not enabled")
+		return
+	}
+
+	var req SimulatePaymentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	var intentID string
+	err = db.QueryRow(
+		"SELECT provider_intent_id FROM payments WHERE id = $1 AND provider = $2", id, fakePayments.Name(),
+	).Scan(&intentID)
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "payment not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	eventType := payment.EventSucceeded
+	if req.Event == "failed" {
+		eventType = payment.EventFailed
+	}
+	body, header, err := fakePayments.Simulate(intentID, eventType)
+	if err != nil {
+		respondProviderError(c, err)
+		return
+	}
+
+	handlePaymentWebhook(c, fakePayments.Name(), fakePayments, header, body)
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"week13-lab6/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Pricing, Currencies & VAT =====================
+
+// baseCurrency คือสกุลของราคาใน books (DECIMAL(10,2) บาท)
+const baseCurrency = "THB"
+
+var (
+	vatRateBP        int64 = 700 // 7%
+	pricesIncludeVAT       = true
+)
+
+func initPricing() {
+	vatRateBP = int64(math.Round(cfg.Pricing.VATRate * 100))
+	pricesIncludeVAT = cfg.Pricing.PricesIncludeVAT
+}
+
+// baseMoney converts a DECIMAL(10,2) baht column scanned into float64.
+func baseMoney(amount float64) money.Money {
+	m, _ := money.FromFloat(amount, baseCurrency) // ค่าจาก DECIMAL แปลงได้เสมอ
+	return m
+}
+
+// TaxSummary is the VAT part of an amount. Gross is what the customer pays.
+type TaxSummary struct {
+	RateBP    int64       `json:"rate_bp"`   // 700 = 7%
+	Inclusive bool        `json:"inclusive"` // ราคาสินค้ารวม VAT แล้ว
+	Net       money.Money `json:"net"`
+	VAT       money.Money `json:"vat"`
+	Gross     money.Money `json:"gross"`
+}
+
+// applyVAT computes VAT on goods (after all discounts). With VAT-inclusive
+// prices the VAT is extracted from goods; otherwise it is added on top.
+func applyVAT(goods money.Money, rateBP int64, inclusive bool) TaxSummary {
+	var v money.VAT
+	if inclusive {
+		v = money.IncludedVAT(goods, rateBP)
+	} else {
+		v = money.ExcludedVAT(goods, rateBP)
+	}
+	return TaxSummary{RateBP: rateBP, Inclusive: inclusive, Net: v.Net, VAT: v.Tax, Gross: v.Gross}
+}
+
+// priceContext is the currency prices are shown and charged in.
+type priceContext struct {
+	Currency string
+	Rate     *big.Rat // จำนวนหน่วยของ Currency ต่อ 1 บาท
+}
+
+var basePriceContext = priceContext{Currency: baseCurrency, Rate: big.NewRat(1, 1)}
+
+// unsupportedCurrencyError means the currency is unknown or has no rate.
+type unsupportedCurrencyError struct {
+	currency string
+}
+
+func (e *unsupportedCurrencyError) Error() string {
+	return "currency " + e.currency + " is not supported"
+}
+
+func loadPriceContext(q queryer, currency string) (priceContext, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" || currency == baseCurrency {
+		return basePriceContext, nil
+	}
+	if !money.Known(currency) {
+		return priceContext{}, &unsupportedCurrencyError{currency}
+	}
+
+	var rate string
+	err := q.QueryRow("SELECT rate::text FROM fx_rates WHERE currency = $1", currency).Scan(&rate)
+	if err == sql.ErrNoRows {
+		return priceContext{}, &unsupportedCurrencyError{currency}
+	} else if err != nil {
+		return priceContext{}, err
+	}
+	r, err := money.ParseDecimal(rate)
+	if err != nil {
+		return priceContext{}, &unsupportedCurrencyError{currency}
+	}
+	return priceContext{Currency: currency, Rate: r}, nil
+}
+
+// respondPriceContextError reports an unsupported currency as a validation
+// problem on field and anything else as an internal error.
+func respondPriceContextError(c *gin.Context, field string, err error) {
+	if curErr, ok := err.(*unsupportedCurrencyError); ok {
+		respondValidation(c, []FieldError{{Field: field, Code: fieldInvalidFormat, Message: curErr.Error()}})
+		return
+	}
+	respondInternalError(c, err)
+}
+
+// priceContextFromQuery reads ?currency= (default THB). It writes a problem
+// and returns false when the currency cannot be used.
+func priceContextFromQuery(c *gin.Context) (priceContext, bool) {
+	pc, err := loadPriceContext(db, c.Query("currency"))
+	if err != nil {
+		respondPriceContextError(c, "currency", err)
+		return pc, false
+	}
+	return pc, true
+}
+
+func (pc priceContext) fromBase(m money.Money) money.Money {
+	return m.Convert(pc.Currency, pc.Rate)
+}
+
+// bookPrices returns the list price and the price the customer pays for one
+// copy in the context currency. price and originalPrice are baht in minor
+// units. When original_price is set, price is already the discounted price
+// (as in the week11-assignment data); otherwise discount is applied to
+// price. listed is the book's price-list entry for the currency, if any; it
+// replaces the converted list price and the same discount ratio applies.
+func (pc priceContext) bookPrices(price int64, originalPrice *int64, discount int, listed *int64) (list, unit money.Money) {
+	baseList := money.New(price, baseCurrency)
+	baseUnit := baseList
+	if originalPrice != nil && *originalPrice > price {
+		baseList = money.New(*originalPrice, baseCurrency)
+	} else if discount > 0 {
+		baseUnit = baseList.Percent(int64(100-discount) * 100)
+	}
+
+	if listed == nil || pc.Currency == baseCurrency {
+		return pc.fromBase(baseList), pc.fromBase(baseUnit)
+	}
+	list = money.New(*listed, pc.Currency)
+	if baseList.IsZero() {
+		return list, list
+	}
+	return list, list.MulRatio(baseUnit.Amount, baseList.Amount)
+}
+
+// bookPriceColumns selects the inputs of bookPrices for books aliased b;
+// currency is the query placeholder holding the currency code. Base prices
+// have two decimals, so × 100 is exact.
+func bookPriceColumns(currency string) string {
+	return `(b.price * 100)::BIGINT, (b.original_price * 100)::BIGINT, b.discount,
+		(SELECT bp.amount_minor FROM book_prices bp WHERE bp.book_id = b.id AND bp.currency = ` + currency + `)`
+}
+
+// BookPricing is the price of one copy in a currency, with its VAT.
+type BookPricing struct {
+	Currency string      `json:"currency"`
+	List     money.Money `json:"list"`
+	Price    money.Money `json:"price"`
+	Tax      TaxSummary  `json:"tax"`
+}
+
+func newBookPricing(currency string, list, unit money.Money) *BookPricing {
+	return &BookPricing{
+		Currency: currency,
+		List:     list,
+		Price:    unit,
+		Tax:      applyVAT(unit, vatRateBP, pricesIncludeVAT),
+	}
+}
+
+// basePricing is the pricing shown with every book, in baht.
+func basePricing(book Book) *BookPricing {
+	var original *int64
+	if book.OriginalPrice != nil {
+		v := baseMoney(*book.OriginalPrice).Amount
+		original = &v
+	}
+	list, unit := basePriceContext.bookPrices(baseMoney(book.Price).Amount, original, book.Discount, nil)
+	return newBookPricing(baseCurrency, list, unit)
+}
+
+// @Summary Get a book's price in a currency
+// @Description Uses the book's price list for the currency when set, otherwise converts from baht at the current exchange rate
+// @Tags Pricing
+// @Produce  json
+// @Param   id        path   int     true   "Book ID"
+// @Param   currency  query  string  false  "ISO 4217 code (default THB)"
+// @Success 200  {object}  BookPricing
+// @Failure 422  {object}  Problem
+// @Router  /books/{id}/price [get]
+func getBookPrice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+	pc, ok := priceContextFromQuery(c)
+	if !ok {
+		return
+	}
+
+	var price int64
+	var originalPrice, listed *int64
+	var discount int
+	err = db.QueryRow(
+		"SELECT "+bookPriceColumns("$2")+" FROM books b WHERE b.id = $1 AND b.deleted_at IS NULL",
+		id, pc.Currency,
+	).Scan(&price, &originalPrice, &discount, &listed)
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	list, unit := pc.bookPrices(price, originalPrice, discount, listed)
+	c.JSON(http.StatusOK, newBookPricing(pc.Currency, list, unit))
+}
+
+// ===================== Exchange Rates =====================
+
+type FXRate struct {
+	Currency  string    `json:"currency"`
+	Rate      string    `json:"rate"` // ต่อ 1 บาท เป็น string เพื่อไม่ให้เสียความละเอียด
+	UpdatedBy *int      `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type FXRateRequest struct {
+	Rate string `json:"rate" binding:"required,numeric,max=30"`
+}
+
+type BookPriceEntry struct {
+	Currency  string      `json:"currency"`
+	Price     money.Money `json:"price"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+type BookPriceRequest struct {
+	Amount string `json:"amount" binding:"required,numeric,max=20"`
+}
+
+// currencyParam validates the :currency path parameter of the pricing
+// admin endpoints: a known, non-base ISO 4217 code.
+func currencyParam(c *gin.Context) (string, bool) {
+	currency := strings.ToUpper(c.Param("currency"))
+	if !money.Known(currency) || currency == baseCurrency {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "currency must be a supported ISO 4217 code other than "+baseCurrency)
+		return "", false
+	}
+	return currency, true
+}
+
+// @Summary List exchange rates
+// @Tags Pricing
+// @Produce  json
+// @Success 200  {array}  FXRate
+// @Router  /fx-rates [get]
+func getFXRates(c *gin.Context) {
+	lastModified := collectionModified(c.Request.Context(), "fx_rates")
+	rows, err := db.Query("SELECT currency, rate::text, updated_by, updated_at FROM fx_rates ORDER BY currency")
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	rates := []FXRate{}
+	for rows.Next() {
+		var r FXRate
+		if err := rows.Scan(&r.Currency, &r.Rate, &r.UpdatedBy, &r.UpdatedAt); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		rates = append(rates, r)
+	}
+
+	respondCached(c, rates, lastModified)
+}
+
+// @Summary Set an exchange rate
+// @Description rate is units of the currency per 1 THB, e.g. {"rate":"0.0275"} for USD
+// @Tags Pricing
+// @Accept  json
+// @Produce  json
+// @Param   currency  path  string         true  "ISO 4217 code"
+// @Param   body      body  FXRateRequest  true  "Rate"
+// @Success 200  {object}  FXRate
+// @Router  /fx-rates/{currency} [put]
+func putFXRate(c *gin.Context) {
+	currency, ok := currencyParam(c)
+	if !ok {
+		return
+	}
+	var req FXRateRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if r, err := money.ParseDecimal(req.Rate); err != nil || r.Sign() <= 0 {
+		respondValidation(c, []FieldError{{Field: "rate", Code: fieldOutOfRange, Message: "must be greater than 0"}})
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	var r FXRate
+	err := db.QueryRow(
+		`INSERT INTO fx_rates (currency, rate, updated_by) VALUES ($1, $2, $3)
+		 ON CONFLICT (currency) DO UPDATE SET rate = EXCLUDED.rate, updated_by = EXCLUDED.updated_by
+		 RETURNING currency, rate::text, updated_by, updated_at`,
+		currency, req.Rate, userID,
+	).Scan(&r.Currency, &r.Rate, &r.UpdatedBy, &r.UpdatedAt)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// Log audit
+	logAudit(userID, "update", "fx_rates", 0, gin.H{"currency": currency, "rate": r.Rate}, c)
+
+	c.JSON(http.StatusOK, r)
+}
+
+func deleteFXRate(c *gin.Context) {
+	currency, ok := currencyParam(c)
+	if !ok {
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM fx_rates WHERE currency = $1", currency)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "exchange rate not found")
+		return
+	}
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "delete", "fx_rates", 0, gin.H{"currency": currency}, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "exchange rate deleted successfully"})
+}
+
+// ===================== Price Lists =====================
+
+// @Summary List a book's per-currency prices
+// @Tags Pricing
+// @Produce  json
+// @Param   id  path  int  true  "Book ID"
+// @Success 200  {array}  BookPriceEntry
+// @Router  /books/{id}/prices [get]
+func getBookPriceList(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+	if !catalogEntryExists(c, "books", id, "book not found") {
+		return
+	}
+
+	rows, err := db.Query("SELECT currency, amount_minor, updated_at FROM book_prices WHERE book_id = $1 ORDER BY currency", id)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	entries := []BookPriceEntry{}
+	for rows.Next() {
+		var e BookPriceEntry
+		var amount int64
+		if err := rows.Scan(&e.Currency, &amount, &e.UpdatedAt); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		e.Price = money.New(amount, e.Currency)
+		entries = append(entries, e)
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// @Summary Set a book's price in a currency
+// @Description The amount is the list price in major units, e.g. {"amount":"12.99"}; the book's discount applies on top
+// @Tags Pricing
+// @Accept  json
+// @Produce  json
+// @Param   id        path  int               true  "Book ID"
+// @Param   currency  path  string            true  "ISO 4217 code"
+// @Param   body      body  BookPriceRequest  true  "Price"
+// @Success 200  {object}  BookPriceEntry
+// @Router  /books/{id}/prices/{currency} [put]
+func putBookPrice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+	currency, ok := currencyParam(c)
+	if !ok {
+		return
+	}
+	var req BookPriceRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	price, err := money.Parse(req.Amount, currency)
+	if err != nil || price.Amount < 0 {
+		respondValidation(c, []FieldError{{Field: "amount", Code: fieldOutOfRange, Message: "must be a non-negative amount"}})
+		return
+	}
+
+	e := BookPriceEntry{Currency: currency, Price: price}
+	err = db.QueryRow(
+		`INSERT INTO book_prices (book_id, currency, amount_minor) VALUES ($1, $2, $3)
+		 ON CONFLICT (book_id, currency) DO UPDATE SET amount_minor = EXCLUDED.amount_minor
+		 RETURNING updated_at`,
+		id, currency, price.Amount,
+	).Scan(&e.UpdatedAt)
+	if isForeignKeyViolation(err) {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	bookChangesTotal.WithLabelValues("price_changed").Inc()
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "update_price", "books", id, gin.H{"currency": currency, "amount": price.String()}, c)
+
+	c.JSON(http.StatusOK, e)
+}
+
+func deleteBookPrice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+	currency, ok := currencyParam(c)
+	if !ok {
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM book_prices WHERE book_id = $1 AND currency = $2", id, currency)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "price not found")
+		return
+	}
+
+	bookChangesTotal.WithLabelValues("price_changed").Inc()
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "delete_price", "books", id, gin.H{"currency": currency}, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "price deleted successfully"})
+}
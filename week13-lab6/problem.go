@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Problem Details (RFC 7807) =====================
+
+// Stable error codes. Clients should branch on these rather than on the
+// human-readable title or detail, which may change.
+const (
+	codeBadRequest         = "bad_request"
+	codeValidation         = "validation_failed"
+	codeMalformedJSON      = "malformed_json"
+	codeUnauthorized       = "unauthorized"
+	codeInvalidCredentials = "invalid_credentials"
+	codeAccountDisabled    = "account_disabled"
+	codeInvalidToken       = "invalid_token"
+	codeForbidden          = "insufficient_permissions"
+	codeNotFound           = "not_found"
+	codeConflict           = "conflict"
+	codeInvalidTransition  = "invalid_status_transition"
+	codeInsufficientStock  = "insufficient_stock"
+	codeCartEmpty          = "cart_empty"
+	codeCouponInvalid      = "coupon_invalid"
+	codeInvalidSignature   = "invalid_signature"
+	codePaymentProvider    = "payment_provider_error"
+	codeUnsupportedMedia   = "unsupported_media_type"
+	codePayloadTooLarge    = "payload_too_large"
+	codeInternal           = "internal_error"
+	codeUnavailable        = "service_unavailable"
+)
+
+const problemTypePrefix = "urn:bookstore:problem:"
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+
+	// Extensions are extra members such as "required" on permission errors.
+	Extensions gin.H `json:"-"`
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type plain Problem
+	base, err := json.Marshal(plain(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return base, err
+	}
+
+	merged := make(map[string]interface{}, len(p.Extensions)+7)
+	for k, v := range p.Extensions {
+		merged[k] = v
+	}
+	// member มาตรฐานทับ extension ที่ชื่อซ้ำเสมอ
+	var standard map[string]interface{}
+	if err := json.Unmarshal(base, &standard); err != nil {
+		return nil, err
+	}
+	for k, v := range standard {
+		merged[k] = v
+	}
+	return json.Marshal(merged)
+}
+
+// respondProblem writes an application/problem+json response and aborts the chain.
+func respondProblem(c *gin.Context, status int, code, detail string) {
+	respondProblemWith(c, Problem{Status: status, Code: code, Detail: detail})
+}
+
+func respondProblemWith(c *gin.Context, p Problem) {
+	if p.Type == "" {
+		p.Type = problemTypePrefix + p.Code
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	c.Header("Content-Type", "application/problem+json")
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+func respondValidation(c *gin.Context, errs []FieldError) {
+	respondProblemWith(c, Problem{
+		Status: http.StatusBadRequest,
+		Code:   codeValidation,
+		Detail: "one or more fields are invalid",
+		Errors: errs,
+	})
+}
+
+// respondInternalError logs err and returns a generic 500 so database and
+// driver messages never reach the client.
+func respondInternalError(c *gin.Context, err error) {
+	slog.ErrorContext(c.Request.Context(), "internal error",
+		"error", err,
+		"method", c.Request.Method,
+		"path", redactPath(c),
+		"route", c.FullPath(),
+	)
+	respondProblem(c, http.StatusInternalServerError, codeInternal, "")
+}
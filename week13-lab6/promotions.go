@@ -0,0 +1,805 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"week13-lab6/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ===================== Promotions & Coupons =====================
+
+const (
+	promotionPercentage = "percentage"
+	promotionFixed      = "fixed"
+)
+
+// Reasons a coupon does not apply (CouponRejection.Reason).
+const (
+	couponNotFound      = "not_found"
+	couponInactive      = "inactive"
+	couponNotStarted    = "not_started"
+	couponExpired       = "expired"
+	couponUsageLimit    = "usage_limit_reached"
+	couponUserLimit     = "user_limit_reached"
+	couponLoginRequired = "login_required"
+	couponMinSubtotal   = "min_subtotal_not_met"
+	couponMinQuantity   = "min_quantity_not_met"
+	couponNoEligible    = "no_eligible_items"
+)
+
+type Promotion struct {
+	ID             int          `json:"id"`
+	Name           string       `json:"name"`
+	Code           *string      `json:"code"` // null = โปรโมชันอัตโนมัติ
+	Kind           string       `json:"kind"`
+	ValueBP        *int64       `json:"value_bp"`     // percentage: 1000 = 10%
+	ValueAmount    *money.Money `json:"value_amount"` // fixed: ส่วนลดเป็นบาท
+	MinSubtotal    money.Money  `json:"min_subtotal"` // บาท
+	MinQuantity    int          `json:"min_quantity"`
+	MaxUses        *int         `json:"max_uses"`
+	MaxUsesPerUser *int         `json:"max_uses_per_user"`
+	CategoryIDs    []int64      `json:"category_ids"`
+	AuthorIDs      []int64      `json:"author_ids"`
+	Priority       int          `json:"priority"`
+	Active         bool         `json:"active"`
+	StartsAt       time.Time    `json:"starts_at"`
+	EndsAt         *time.Time   `json:"ends_at"`
+	Uses           int          `json:"uses"` // ไม่นับ order ที่ยกเลิก
+	CreatedBy      *int         `json:"created_by"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+type PromotionRequest struct {
+	Name             string     `json:"name" binding:"required,max=255"`
+	Code             string     `json:"code" binding:"omitempty,min=3,max=50,alphanum"` // ว่าง = อัตโนมัติ
+	Kind             string     `json:"kind" binding:"required,oneof=percentage fixed"`
+	ValueBP          int64      `json:"value_bp" binding:"gte=0,max=10000"` // percentage: 1000 = 10%
+	ValueMinor       int64      `json:"value_minor" binding:"gte=0"`        // fixed: สตางค์
+	MinSubtotalMinor int64      `json:"min_subtotal_minor" binding:"gte=0"` // สตางค์
+	MinQuantity      int        `json:"min_quantity" binding:"gte=0,max=1000"`
+	MaxUses          *int       `json:"max_uses" binding:"omitempty,gt=0"`
+	MaxUsesPerUser   *int       `json:"max_uses_per_user" binding:"omitempty,gt=0"`
+	CategoryIDs      []int64    `json:"category_ids" binding:"omitempty,max=50,unique,dive,gt=0"`
+	AuthorIDs        []int64    `json:"author_ids" binding:"omitempty,max=50,unique,dive,gt=0"`
+	Priority         int        `json:"priority"`
+	Active           *bool      `json:"active"` // ไม่ส่ง = true
+	StartsAt         *time.Time `json:"starts_at"`
+	EndsAt           *time.Time `json:"ends_at"`
+}
+
+type ApplyCouponRequest struct {
+	Code string `json:"code" binding:"required,max=50"`
+}
+
+// AppliedPromotion is one line of the discount breakdown.
+type AppliedPromotion struct {
+	PromotionID int          `json:"promotion_id"`
+	Name        string       `json:"name"`
+	Code        string       `json:"code,omitempty"`
+	Kind        string       `json:"kind"`
+	ValueBP     *int64       `json:"value_bp,omitempty"`     // ค่าในกฎ: percentage
+	ValueAmount *money.Money `json:"value_amount,omitempty"` // ค่าในกฎ: fixed เป็นบาท
+	Amount      money.Money  `json:"amount"`
+	BookIDs     []int        `json:"book_ids,omitempty"` // รายการที่นับเป็นฐานของส่วนลด
+}
+
+// CouponRejection explains why the cart's coupon gives no discount.
+type CouponRejection struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (r *CouponRejection) Error() string {
+	return r.Message
+}
+
+const promotionColumns = `id, name, code, kind, value_bp, value_minor, min_subtotal_minor, min_quantity, max_uses, max_uses_per_user,
+	category_ids, author_ids, priority, active, starts_at, ends_at,
+	(SELECT COUNT(*) FROM promotion_redemptions r JOIN orders o ON o.id = r.order_id
+	 WHERE r.promotion_id = promotions.id AND o.status <> 'cancelled'),
+	created_by, created_at, updated_at`
+
+func scanPromotion(row rowScanner) (Promotion, error) {
+	var p Promotion
+	var valueMinor sql.NullInt64
+	var minSubtotal int64
+	var categoryIDs, authorIDs pq.Int64Array
+	err := row.Scan(
+		&p.ID, &p.Name, &p.Code, &p.Kind, &p.ValueBP, &valueMinor, &minSubtotal, &p.MinQuantity, &p.MaxUses, &p.MaxUsesPerUser,
+		&categoryIDs, &authorIDs, &p.Priority, &p.Active, &p.StartsAt, &p.EndsAt,
+		&p.Uses,
+		&p.CreatedBy, &p.CreatedAt, &p.UpdatedAt,
+	)
+	p.ValueAmount = promotionAmount(valueMinor)
+	p.MinSubtotal = money.New(minSubtotal, baseCurrency)
+	p.CategoryIDs, p.AuthorIDs = []int64(categoryIDs), []int64(authorIDs)
+	if p.CategoryIDs == nil {
+		p.CategoryIDs = []int64{}
+	}
+	if p.AuthorIDs == nil {
+		p.AuthorIDs = []int64{}
+	}
+	return p, err
+}
+
+// promotionAmount converts a nullable value_minor column into baht.
+func promotionAmount(minor sql.NullInt64) *money.Money {
+	if !minor.Valid {
+		return nil
+	}
+	m := money.New(minor.Int64, baseCurrency)
+	return &m
+}
+
+// ===================== Rules Engine =====================
+
+// pricingLine is a cart line after per-book discounts, with the attributes
+// promotion restrictions match against.
+type pricingLine struct {
+	BookID    int
+	Quantity  int
+	LineTotal money.Money
+	// หมวดของหนังสือรวมหมวดแม่ทุกชั้น ให้โปรของหมวดแม่ครอบคลุมหมวดย่อย
+	categoryIDs []int64
+	authorIDs   []int64
+}
+
+// loadPricingAttributes fills the category ancestry and authors of each line.
+func loadPricingAttributes(q queryer, lines []pricingLine) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(lines))
+	for i, l := range lines {
+		ids[i] = int64(l.BookID)
+	}
+
+	rows, err := q.Query(
+		`WITH RECURSIVE ancestry AS (
+		     SELECT b.id AS book_id, b.category_id
+		     FROM books b WHERE b.id = ANY($1) AND b.category_id IS NOT NULL
+		     UNION
+		     SELECT a.book_id, c.parent_id
+		     FROM ancestry a JOIN categories c ON c.id = a.category_id
+		     WHERE c.parent_id IS NOT NULL
+		 )
+		 SELECT b.id,
+		        COALESCE((SELECT array_agg(category_id) FROM ancestry WHERE ancestry.book_id = b.id), '{}'),
+		        COALESCE((SELECT array_agg(author_id) FROM book_authors WHERE book_authors.book_id = b.id), '{}')
+		 FROM books b WHERE b.id = ANY($1)`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byBook := make(map[int]int, len(lines))
+	for i, l := range lines {
+		byBook[l.BookID] = i
+	}
+	for rows.Next() {
+		var bookID int
+		var categoryIDs, authorIDs pq.Int64Array
+		if err := rows.Scan(&bookID, &categoryIDs, &authorIDs); err != nil {
+			return err
+		}
+		if i, ok := byBook[bookID]; ok {
+			lines[i].categoryIDs, lines[i].authorIDs = categoryIDs, authorIDs
+		}
+	}
+	return rows.Err()
+}
+
+func containsAny(have, want []int64) bool {
+	for _, w := range want {
+		for _, h := range have {
+			if h == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// eligibleLines returns the lines the promotion's category/author
+// restrictions allow. Both restrictions must match when both are set.
+func (p Promotion) eligibleLines(currency string, lines []pricingLine) (quantity int, subtotal money.Money, bookIDs []int) {
+	subtotal, bookIDs = money.New(0, currency), []int{}
+	for _, l := range lines {
+		if len(p.CategoryIDs) > 0 && !containsAny(l.categoryIDs, p.CategoryIDs) {
+			continue
+		}
+		if len(p.AuthorIDs) > 0 && !containsAny(l.authorIDs, p.AuthorIDs) {
+			continue
+		}
+		quantity += l.Quantity
+		subtotal = subtotal.Add(l.LineTotal)
+		bookIDs = append(bookIDs, l.BookID)
+	}
+	return quantity, subtotal, bookIDs
+}
+
+// checkPromotionStatus checks everything about a promotion that does not
+// depend on the cart contents: active flag, validity window and usage limits.
+func checkPromotionStatus(q queryer, p Promotion, userID int, now time.Time) (*CouponRejection, error) {
+	switch {
+	case !p.Active:
+		return &CouponRejection{couponInactive, "this coupon is no longer active"}, nil
+	case now.Before(p.StartsAt):
+		return &CouponRejection{couponNotStarted, "this coupon is not valid yet"}, nil
+	case p.EndsAt != nil && !now.Before(*p.EndsAt):
+		return &CouponRejection{couponExpired, "this coupon has expired"}, nil
+	case p.MaxUses != nil && p.Uses >= *p.MaxUses:
+		return &CouponRejection{couponUsageLimit, "this coupon has been fully redeemed"}, nil
+	}
+
+	if p.MaxUsesPerUser != nil {
+		if userID == 0 {
+			return &CouponRejection{couponLoginRequired, "log in to use this coupon"}, nil
+		}
+		var used int
+		err := q.QueryRow(
+			`SELECT COUNT(*) FROM promotion_redemptions r JOIN orders o ON o.id = r.order_id
+			 WHERE r.promotion_id = $1 AND r.user_id = $2 AND o.status <> 'cancelled'`,
+			p.ID, userID,
+		).Scan(&used)
+		if err != nil {
+			return nil, err
+		}
+		if used >= *p.MaxUsesPerUser {
+			return &CouponRejection{couponUserLimit, "you have already used this coupon"}, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkPromotionConditions checks the cart-dependent conditions. Amounts in
+// the rule are baht and are converted to the cart currency.
+func checkPromotionConditions(pc priceContext, p Promotion, lines []pricingLine, cartTotal money.Money) (*CouponRejection, money.Money, []int) {
+	if minSubtotal := pc.fromBase(p.MinSubtotal); cartTotal.Cmp(minSubtotal) < 0 {
+		message := fmt.Sprintf("spend at least %s %s to use this coupon", minSubtotal, minSubtotal.Currency)
+		return &CouponRejection{couponMinSubtotal, message}, money.Money{}, nil
+	}
+	quantity, base, bookIDs := p.eligibleLines(pc.Currency, lines)
+	if quantity == 0 {
+		return &CouponRejection{couponNoEligible, "no items in the cart qualify for this coupon"}, money.Money{}, nil
+	}
+	if quantity < p.MinQuantity {
+		message := fmt.Sprintf("add at least %d qualifying items to use this coupon", p.MinQuantity)
+		return &CouponRejection{couponMinQuantity, message}, money.Money{}, nil
+	}
+	return nil, base, bookIDs
+}
+
+// evaluatePromotions runs the rules engine over the priced lines. Automatic
+// promotions apply first, highest priority first, then the coupon named by
+// code. Each discount is computed on its eligible lines and capped so the
+// total never goes below zero. With lock=true the promotion rows are locked
+// so concurrent checkouts cannot exceed a usage limit.
+func evaluatePromotions(q queryer, pc priceContext, lines []pricingLine, userID int, code string, lock bool) ([]AppliedPromotion, *CouponRejection, error) {
+	applied := []AppliedPromotion{}
+	if len(lines) == 0 {
+		return applied, nil, nil
+	}
+	if err := loadPricingAttributes(q, lines); err != nil {
+		return nil, nil, err
+	}
+
+	cartTotal := money.New(0, pc.Currency)
+	for _, l := range lines {
+		cartTotal = cartTotal.Add(l.LineTotal)
+	}
+
+	var rules []Promotion
+	rows, err := q.Query(
+		`SELECT ` + promotionColumns + ` FROM promotions
+		 WHERE code IS NULL AND active AND starts_at <= NOW() AND (ends_at IS NULL OR ends_at > NOW())
+		 ORDER BY priority DESC, id`,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		rules = append(rules, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	remaining := cartTotal
+	apply := func(p Promotion, base money.Money, bookIDs []int) {
+		var amount money.Money
+		switch {
+		case p.ValueBP != nil:
+			amount = base.Percent(*p.ValueBP)
+		case p.ValueAmount != nil:
+			amount = pc.fromBase(*p.ValueAmount).Min(base)
+		default:
+			return
+		}
+		amount = amount.Min(remaining)
+		if amount.Amount <= 0 {
+			return
+		}
+		remaining = remaining.Sub(amount)
+		a := AppliedPromotion{
+			PromotionID: p.ID,
+			Name:        p.Name,
+			Kind:        p.Kind,
+			ValueBP:     p.ValueBP,
+			ValueAmount: p.ValueAmount,
+			Amount:      amount,
+			BookIDs:     bookIDs,
+		}
+		if p.Code != nil {
+			a.Code = *p.Code
+		}
+		applied = append(applied, a)
+	}
+
+	now := time.Now()
+	for _, p := range rules {
+		if lock && (p.MaxUses != nil || p.MaxUsesPerUser != nil) {
+			// ล็อกเฉพาะโปรที่จำกัดสิทธิ์ ไม่ให้ทุก checkout ต้องรอกัน
+			if p, err = lockPromotion(q, p.ID); err != nil {
+				return nil, nil, err
+			}
+		}
+		// โปรอัตโนมัติที่ไม่เข้าเงื่อนไขข้ามไปเงียบๆ
+		rejection, err := checkPromotionStatus(q, p, userID, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		if rejection != nil {
+			continue
+		}
+		if rejection, base, bookIDs := checkPromotionConditions(pc, p, lines, cartTotal); rejection == nil {
+			apply(p, base, bookIDs)
+		}
+	}
+
+	if code == "" {
+		return applied, nil, nil
+	}
+	coupon, err := scanPromotion(q.QueryRow(
+		"SELECT "+promotionColumns+" FROM promotions WHERE upper(code) = upper($1)", code,
+	))
+	if err == sql.ErrNoRows {
+		return applied, &CouponRejection{couponNotFound, "this coupon code does not exist"}, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if lock && (coupon.MaxUses != nil || coupon.MaxUsesPerUser != nil) {
+		if coupon, err = lockPromotion(q, coupon.ID); err != nil {
+			return nil, nil, err
+		}
+	}
+	rejection, err := checkPromotionStatus(q, coupon, userID, now)
+	if err != nil || rejection != nil {
+		return applied, rejection, err
+	}
+	rejection, base, bookIDs := checkPromotionConditions(pc, coupon, lines, cartTotal)
+	if rejection != nil {
+		return applied, rejection, nil
+	}
+	apply(coupon, base, bookIDs)
+	return applied, nil, nil
+}
+
+// lockPromotion locks the promotion row and then re-reads it. The read must
+// be a separate statement: a statement that waits for the lock keeps the
+// snapshot it started with, so a redemption count taken in the locking
+// statement misses the checkout that held the lock.
+func lockPromotion(q queryer, id int) (Promotion, error) {
+	if _, err := q.Exec("SELECT id FROM promotions WHERE id = $1 FOR UPDATE", id); err != nil {
+		return Promotion{}, err
+	}
+	return scanPromotion(q.QueryRow("SELECT "+promotionColumns+" FROM promotions WHERE id = $1", id))
+}
+
+func sumPromotions(currency string, applied []AppliedPromotion) money.Money {
+	total := money.New(0, currency)
+	for _, a := range applied {
+		total = total.Add(a.Amount)
+	}
+	return total
+}
+
+// loadOrderPromotions reads the discounts given to an order, in its currency.
+func loadOrderPromotions(q queryer, orderID int, currency string) ([]AppliedPromotion, error) {
+	rows, err := q.Query(
+		`SELECT r.promotion_id, r.name, COALESCE(r.code, ''), p.kind, p.value_bp, p.value_minor, r.amount_minor
+		 FROM promotion_redemptions r JOIN promotions p ON p.id = r.promotion_id
+		 WHERE r.order_id = $1 ORDER BY r.id`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := []AppliedPromotion{}
+	for rows.Next() {
+		var a AppliedPromotion
+		var valueMinor sql.NullInt64
+		var amount int64
+		if err := rows.Scan(&a.PromotionID, &a.Name, &a.Code, &a.Kind, &a.ValueBP, &valueMinor, &amount); err != nil {
+			return nil, err
+		}
+		a.ValueAmount = promotionAmount(valueMinor)
+		a.Amount = money.New(amount, currency)
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// ===================== Cart Coupon Handlers =====================
+
+// @Summary Apply a coupon to the cart
+// @Description Replaces any coupon already in the cart. Unknown, expired or used-up codes are rejected; spend and item conditions are re-checked whenever the cart is priced.
+// @Tags Cart
+// @Accept  json
+// @Produce  json
+// @Param   body  body  ApplyCouponRequest  true  "Coupon code"
+// @Success 200  {object}  Cart
+// @Failure 422  {object}  Problem
+// @Router  /cart/coupon [put]
+func applyCartCoupon(c *gin.Context) {
+	var req ApplyCouponRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	code := strings.ToUpper(strings.TrimSpace(req.Code))
+
+	coupon, err := scanPromotion(db.QueryRow(
+		"SELECT "+promotionColumns+" FROM promotions WHERE upper(code) = $1", code,
+	))
+	var rejection *CouponRejection
+	if err == sql.ErrNoRows {
+		rejection = &CouponRejection{couponNotFound, "this coupon code does not exist"}
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	} else if rejection, err = checkPromotionStatus(db, coupon, c.GetInt("user_id"), time.Now()); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if rejection != nil {
+		respondValidation(c, []FieldError{{Field: "code", Code: rejection.Reason, Message: rejection.Message}})
+		return
+	}
+
+	cartID, err := resolveCart(c, true)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if _, err := db.Exec("UPDATE carts SET coupon_code = $1, updated_at = NOW() WHERE id = $2", *coupon.Code, cartID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	respondCart(c, cartID, http.StatusOK)
+}
+
+func removeCartCoupon(c *gin.Context) {
+	cartID, err := resolveCart(c, false)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if cartID != 0 {
+		if _, err := db.Exec("UPDATE carts SET coupon_code = NULL, updated_at = NOW() WHERE id = $1", cartID); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+	}
+
+	respondCart(c, cartID, http.StatusOK)
+}
+
+// ===================== Promotion Admin Handlers =====================
+
+// @Summary List promotions and coupons
+// @Tags Promotions
+// @Produce  json
+// @Param   type    query  string  false  "automatic or coupon"
+// @Param   active  query  bool    false  "Only active (true) or inactive (false)"
+// @Param   q       query  string  false  "Name or code contains"
+// @Success 200  {array}  Promotion
+// @Router  /promotions [get]
+func getPromotions(c *gin.Context) {
+	query := "SELECT " + promotionColumns + " FROM promotions WHERE TRUE"
+	var args []interface{}
+	switch c.Query("type") {
+	case "automatic":
+		query += " AND code IS NULL"
+	case "coupon":
+		query += " AND code IS NOT NULL"
+	case "":
+	default:
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "type must be automatic or coupon")
+		return
+	}
+	if active := c.Query("active"); active != "" {
+		v, err := strconv.ParseBool(active)
+		if err != nil {
+			respondProblem(c, http.StatusBadRequest, codeBadRequest, "active must be true or false")
+			return
+		}
+		args = append(args, v)
+		query += fmt.Sprintf(" AND active = $%d", len(args))
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		args = append(args, q)
+		query += fmt.Sprintf(" AND (name ILIKE '%%' || $%d || '%%' OR code ILIKE '%%' || $%d || '%%')", len(args), len(args))
+	}
+
+	rows, err := db.Query(query+" ORDER BY created_at DESC, id DESC", args...)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	promotions := []Promotion{}
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		promotions = append(promotions, p)
+	}
+
+	c.JSON(http.StatusOK, promotions)
+}
+
+func getPromotion(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid promotion id")
+		return
+	}
+
+	p, err := scanPromotion(db.QueryRow("SELECT "+promotionColumns+" FROM promotions WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "promotion not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
+
+// validatePromotionRequest applies the checks binding tags cannot express
+// and normalises the request. It returns false after writing a problem.
+func validatePromotionRequest(c *gin.Context, req *PromotionRequest) bool {
+	var errs []FieldError
+	// ส่งเฉพาะค่าที่ตรงกับ kind: value_bp สำหรับ percentage, value_minor สำหรับ fixed
+	switch req.Kind {
+	case promotionPercentage:
+		if req.ValueBP == 0 {
+			errs = append(errs, FieldError{Field: "value_bp", Code: fieldRequired, Message: "is required for a percentage"})
+		}
+		if req.ValueMinor != 0 {
+			errs = append(errs, FieldError{Field: "value_minor", Code: fieldOutOfRange, Message: "must be omitted for a percentage"})
+		}
+	case promotionFixed:
+		if req.ValueMinor == 0 {
+			errs = append(errs, FieldError{Field: "value_minor", Code: fieldRequired, Message: "is required for a fixed discount"})
+		}
+		if req.ValueBP != 0 {
+			errs = append(errs, FieldError{Field: "value_bp", Code: fieldOutOfRange, Message: "must be omitted for a fixed discount"})
+		}
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		errs = append(errs, FieldError{Field: "ends_at", Code: fieldOutOfRange, Message: "must be after starts_at"})
+	}
+	if len(errs) > 0 {
+		respondValidation(c, errs)
+		return false
+	}
+
+	for _, check := range []struct {
+		table, field string
+		ids          []int64
+	}{
+		{"categories", "category_ids", req.CategoryIDs},
+		{"authors", "author_ids", req.AuthorIDs},
+	} {
+		if len(check.ids) == 0 {
+			continue
+		}
+		var found pq.Int64Array
+		err := db.QueryRow("SELECT COALESCE(array_agg(id), '{}') FROM "+check.table+" WHERE id = ANY($1)", pq.Array(check.ids)).Scan(&found)
+		if err != nil {
+			respondInternalError(c, err)
+			return false
+		}
+		for i, id := range check.ids {
+			if !containsAny(found, []int64{id}) {
+				respondValidation(c, []FieldError{notFoundRelation(fmt.Sprintf("%s[%d]", check.field, i), int(id)).field})
+				return false
+			}
+		}
+	}
+
+	if req.CategoryIDs == nil {
+		req.CategoryIDs = []int64{}
+	}
+	if req.AuthorIDs == nil {
+		req.AuthorIDs = []int64{}
+	}
+	req.Code = strings.ToUpper(req.Code)
+	if req.StartsAt == nil {
+		now := time.Now()
+		req.StartsAt = &now
+	}
+	if req.Active == nil {
+		active := true
+		req.Active = &active
+	}
+	return true
+}
+
+func respondDuplicateCode(c *gin.Context) {
+	respondProblemWith(c, Problem{
+		Status: http.StatusConflict,
+		Code:   codeConflict,
+		Detail: "a coupon with this code already exists",
+		Errors: []FieldError{{Field: "code", Code: fieldDuplicate, Message: "already exists"}},
+	})
+}
+
+func nullableCode(code string) interface{} {
+	if code == "" {
+		return nil
+	}
+	return code
+}
+
+// nullableValue maps an unused value_bp / value_minor (0) to NULL.
+func nullableValue(v int64) interface{} {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
+
+// @Summary Create a promotion or coupon
+// @Description Leave code empty for an automatic promotion, e.g. {"name":"Buy 2 get 10% off","kind":"percentage","value_bp":1000,"min_quantity":2}
+// @Tags Promotions
+// @Accept  json
+// @Produce  json
+// @Param   body  body  PromotionRequest  true  "Promotion"
+// @Success 201  {object}  Promotion
+// @Failure 409  {object}  Problem
+// @Router  /promotions [post]
+func createPromotion(c *gin.Context) {
+	var req PromotionRequest
+	if !bindJSON(c, &req) || !validatePromotionRequest(c, &req) {
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	p, err := scanPromotion(db.QueryRow(
+		`INSERT INTO promotions (name, code, kind, value_bp, value_minor, min_subtotal_minor, min_quantity, max_uses, max_uses_per_user,
+		                         category_ids, author_ids, priority, active, starts_at, ends_at, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		 RETURNING `+promotionColumns,
+		req.Name, nullableCode(req.Code), req.Kind, nullableValue(req.ValueBP), nullableValue(req.ValueMinor), req.MinSubtotalMinor,
+		req.MinQuantity, req.MaxUses, req.MaxUsesPerUser,
+		pq.Array(req.CategoryIDs), pq.Array(req.AuthorIDs), req.Priority, *req.Active, *req.StartsAt, req.EndsAt, userID,
+	))
+	if isUniqueViolation(err) {
+		respondDuplicateCode(c)
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// Log audit
+	logAudit(userID, "create", "promotions", p.ID, gin.H{
+		"name":         p.Name,
+		"code":         p.Code,
+		"kind":         p.Kind,
+		"value_bp":     p.ValueBP,
+		"value_amount": p.ValueAmount,
+	}, c)
+
+	c.JSON(http.StatusCreated, p)
+}
+
+// updatePromotion replaces the rule. Orders already placed keep the
+// discount they were given.
+func updatePromotion(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid promotion id")
+		return
+	}
+
+	var req PromotionRequest
+	if !bindJSON(c, &req) || !validatePromotionRequest(c, &req) {
+		return
+	}
+
+	p, err := scanPromotion(db.QueryRow(
+		`UPDATE promotions
+		 SET name = $1, code = $2, kind = $3, value_bp = $4, value_minor = $5, min_subtotal_minor = $6, min_quantity = $7,
+		     max_uses = $8, max_uses_per_user = $9, category_ids = $10, author_ids = $11,
+		     priority = $12, active = $13, starts_at = $14, ends_at = $15
+		 WHERE id = $16
+		 RETURNING `+promotionColumns,
+		req.Name, nullableCode(req.Code), req.Kind, nullableValue(req.ValueBP), nullableValue(req.ValueMinor), req.MinSubtotalMinor, req.MinQuantity,
+		req.MaxUses, req.MaxUsesPerUser, pq.Array(req.CategoryIDs), pq.Array(req.AuthorIDs),
+		req.Priority, *req.Active, *req.StartsAt, req.EndsAt, id,
+	))
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "promotion not found")
+		return
+	} else if isUniqueViolation(err) {
+		respondDuplicateCode(c)
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "update", "promotions", id, gin.H{
+		"name":   p.Name,
+		"code":   p.Code,
+		"active": p.Active,
+	}, c)
+
+	c.JSON(http.StatusOK, p)
+}
+
+func deletePromotion(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid promotion id")
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM promotions WHERE id = $1", id)
+	if isForeignKeyViolation(err) {
+		respondProblem(c, http.StatusConflict, codeConflict, "promotion has been redeemed; deactivate it instead")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "promotion not found")
+		return
+	}
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "delete", "promotions", id, nil, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "promotion deleted successfully"})
+}
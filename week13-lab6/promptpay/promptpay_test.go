@@ -0,0 +1,47 @@
+package promptpay
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCRC16(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint16
+	}{
+		{"", 0xFFFF},
+		{"123456789", 0x29B1}, // check value ของ CRC-16/CCITT-FALSE
+		{"00020101021129370016A000000677010111011300660000000005802TH53037646304", 0x8956},
+	}
+	for _, tt := range tests {
+		if got := crc16(tt.in); got != tt.want {
+			t.Errorf("crc16(%q) = %04X, want %04X", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPayload(t *testing.T) {
+	tests := []struct {
+		target  string
+		amount  int64
+		want    string
+		wantErr error
+	}{
+		{"081-234-5678", 0, "00020101021129370016A000000677010111011300668123456785802TH530376463045D82", nil},
+		{"0812345678", 12345, "00020101021229370016A000000677010111011300668123456785802TH53037645406123.456304906E", nil},
+		{"+66812345678", 12345, "00020101021229370016A000000677010111011300668123456785802TH53037645406123.456304906E", nil},
+		{"1234567890123", 50, "00020101021229370016A000000677010111021312345678901235802TH530376454040.506304349E", nil},
+		{"123456789012345", 100000, "00020101021229390016A00000067701011103151234567890123455802TH530376454071000.0063041A4C", nil},
+		{"0812345678", -1, "", ErrInvalidAmount},
+		{"081234567", 100, "", ErrInvalidTarget},
+		{"08123x5678", 100, "", ErrInvalidTarget},
+		{"1812345678", 100, "", ErrInvalidTarget},
+	}
+	for _, tt := range tests {
+		got, err := Payload(tt.target, tt.amount)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("Payload(%q, %d) = %q, %v; want %q, %v", tt.target, tt.amount, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Publisher Handlers =====================
+
+type Publisher struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name" binding:"required,max=255"`
+	Website   string    `json:"website" binding:"omitempty,http_url,max=500"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const publisherColumns = "id, name, website, created_at, updated_at"
+
+func scanPublisher(row rowScanner) (Publisher, error) {
+	var p Publisher
+	err := row.Scan(&p.ID, &p.Name, &p.Website, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// @Summary List publishers
+// @Tags Publishers
+// @Produce  json
+// @Param   q  query  string  false  "Name contains"
+// @Success 200  {array}  Publisher
+// @Router  /publishers [get]
+func getPublishers(c *gin.Context) {
+	query := "SELECT " + publisherColumns + " FROM publishers"
+	var args []interface{}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		query += " WHERE name ILIKE '%' || $1 || '%'"
+		args = append(args, q)
+	}
+
+	lastModified := collectionModified(c.Request.Context(), "publishers")
+	rows, err := db.Query(query+" ORDER BY name", args...)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	publishers := []Publisher{}
+	for rows.Next() {
+		p, err := scanPublisher(rows)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		publishers = append(publishers, p)
+	}
+
+	respondCached(c, publishers, lastModified)
+}
+
+func getPublisher(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid publisher id")
+		return
+	}
+
+	p, err := scanPublisher(db.QueryRow("SELECT "+publisherColumns+" FROM publishers WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "publisher not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	respondCached(c, p, p.UpdatedAt)
+}
+
+func createPublisher(c *gin.Context) {
+	var p Publisher
+	if !bindJSON(c, &p) {
+		return
+	}
+	p.Name = strings.TrimSpace(p.Name)
+
+	created, err := scanPublisher(db.QueryRow(
+		"INSERT INTO publishers (name, website) VALUES ($1, $2) RETURNING "+publisherColumns,
+		p.Name, p.Website,
+	))
+	if isUniqueViolation(err) {
+		respondDuplicateName(c, "publisher")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "create", "publishers", created.ID, gin.H{"name": created.Name}, c)
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func updatePublisher(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid publisher id")
+		return
+	}
+
+	var p Publisher
+	if !bindJSON(c, &p) {
+		return
+	}
+	p.Name = strings.TrimSpace(p.Name)
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	updated, err := scanPublisher(tx.QueryRow(
+		"UPDATE publishers SET name = $1, website = $2 WHERE id = $3 RETURNING "+publisherColumns,
+		p.Name, p.Website, id,
+	))
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "publisher not found")
+		return
+	} else if isUniqueViolation(err) {
+		respondDuplicateName(c, "publisher")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE books SET publisher = $1 WHERE publisher_id = $2", updated.Name, id); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	bookCache.reset()
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "update", "publishers", id, gin.H{"name": updated.Name}, c)
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// deletePublisher ลบสำนักพิมพ์ หนังสือที่อ้างถึงจะกลายเป็นไม่มีสำนักพิมพ์
+func deletePublisher(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid publisher id")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE books SET publisher = '' WHERE publisher_id = $1", id); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	result, err := tx.Exec("DELETE FROM publishers WHERE id = $1", id)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "publisher not found")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	bookCache.reset()
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "delete", "publishers", id, nil, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "publisher deleted successfully"})
+}
+
+// @Summary List books by publisher
+// @Tags Publishers
+// @Produce  json
+// @Param   id  path  int  true  "Publisher ID"
+// @Success 200  {array}  Book
+// @Failure 404  {object}  Problem
+// @Router  /publishers/{id}/books [get]
+func getBooksByPublisher(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid publisher id")
+		return
+	}
+	if !catalogEntryExists(c, "publishers", id, "publisher not found") {
+		return
+	}
+
+	filter, err := parseBookFilter(c)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	filter.add(condBookPublisher, id)
+	listBooks(c, filter)
+}
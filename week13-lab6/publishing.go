@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Publishing Workflow =====================
+
+const (
+	statusDraft     = "draft"
+	statusInReview  = "in_review"
+	statusPublished = "published"
+	statusArchived  = "archived"
+)
+
+type workflowAction struct {
+	Name string
+	From string
+	To   string
+}
+
+var (
+	actionSubmit    = workflowAction{Name: "submit", From: statusDraft, To: statusInReview}
+	actionReject    = workflowAction{Name: "reject", From: statusInReview, To: statusDraft}
+	actionArchive   = workflowAction{Name: "archive", From: statusPublished, To: statusArchived}
+	actionUnarchive = workflowAction{Name: "unarchive", From: statusArchived, To: statusDraft}
+)
+
+type PublishRequest struct {
+	// ถ้าเป็นเวลาในอนาคตจะตั้งเวลาเผยแพร่แทนการเผยแพร่ทันที
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+// canSeeUnpublished reports whether the caller is staff. Staff see every
+// status while regular readers only see published books.
+func canSeeUnpublished(c *gin.Context) bool {
+	if v, ok := c.Get("can_see_unpublished"); ok {
+		return v.(bool)
+	}
+
+	allowed := false
+	if userID, exists := c.Get("user_id"); exists {
+		allowed = checkUserPermission(c.Request.Context(), userID.(int), "books:update")
+	}
+	c.Set("can_see_unpublished", allowed)
+	return allowed
+}
+
+func transitionBook(action workflowAction) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+			return
+		}
+
+		book, err := scanBook(db.QueryRow(
+			`UPDATE books
+			 SET status = $1, scheduled_at = NULL
+			 WHERE id = $2 AND status = $3 AND deleted_at IS NULL
+			 RETURNING `+bookColumns,
+			action.To, id, action.From,
+		))
+		if err == sql.ErrNoRows {
+			respondTransitionConflict(c, id, action)
+			return
+		} else if err != nil {
+			slog.ErrorContext(c.Request.Context(), "error applying book transition", "action", action.Name, "book_id", id, "error", err)
+			respondProblem(c, http.StatusInternalServerError, codeInternal, "")
+			return
+		}
+
+		bookCache.invalidate(id)
+		bookChangesTotal.WithLabelValues("status_changed").Inc()
+
+		// Log audit
+		userID := c.GetInt("user_id")
+		logAudit(userID, action.Name, "books", id, gin.H{
+			"from": action.From,
+			"to":   action.To,
+		}, c)
+
+		c.JSON(http.StatusOK, book)
+	}
+}
+
+func publishBook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+
+	// body ไม่บังคับ: ไม่ส่งมา = เผยแพร่ทันที
+	var req PublishRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	var book Book
+	action := workflowAction{Name: "publish", From: statusInReview, To: statusPublished}
+
+	if req.PublishAt != nil && req.PublishAt.After(time.Now()) {
+		// ตั้งเวลา: ยังอยู่ใน in_review จนกว่า runScheduledPublisher จะมาเผยแพร่
+		action = workflowAction{Name: "schedule", From: statusInReview, To: statusInReview}
+		book, err = scanBook(db.QueryRow(
+			`UPDATE books
+			 SET scheduled_at = $1
+			 WHERE id = $2 AND status = $3 AND deleted_at IS NULL
+			 RETURNING `+bookColumns,
+			*req.PublishAt, id, statusInReview,
+		))
+	} else {
+		book, err = scanBook(db.QueryRow(
+			`UPDATE books
+			 SET status = $1, published_at = NOW(), scheduled_at = NULL
+			 WHERE id = $2 AND status = $3 AND deleted_at IS NULL
+			 RETURNING `+bookColumns,
+			statusPublished, id, statusInReview,
+		))
+	}
+
+	if err == sql.ErrNoRows {
+		respondTransitionConflict(c, id, action)
+		return
+	} else if err != nil {
+		slog.ErrorContext(c.Request.Context(), "error publishing book", "book_id", id, "error", err)
+		respondProblem(c, http.StatusInternalServerError, codeInternal, "")
+		return
+	}
+
+	bookCache.invalidate(id)
+	bookChangesTotal.WithLabelValues("status_changed").Inc()
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	details := gin.H{"from": action.From, "to": action.To}
+	if book.ScheduledAt != nil {
+		details["scheduled_at"] = book.ScheduledAt
+	}
+	logAudit(userID, action.Name, "books", id, details, c)
+
+	c.JSON(http.StatusOK, book)
+}
+
+// respondTransitionConflict แยกกรณีไม่พบหนังสือ กับสถานะปัจจุบันไม่ตรงกับ workflow
+func respondTransitionConflict(c *gin.Context, id int, action workflowAction) {
+	var current string
+	err := db.QueryRow("SELECT status FROM books WHERE id = $1 AND deleted_at IS NULL", id).Scan(&current)
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	} else if err != nil {
+		slog.ErrorContext(c.Request.Context(), "error reading book status", "error", err)
+		respondProblem(c, http.StatusInternalServerError, codeInternal, "")
+		return
+	}
+
+	respondProblemWith(c, Problem{
+		Status: http.StatusConflict,
+		Code:   codeInvalidTransition,
+		Detail: fmt.Sprintf("cannot %s a book in status %s", action.Name, current),
+		Extensions: gin.H{
+			"action":         action.Name,
+			"current_status": current,
+			"required":       action.From,
+		},
+	})
+}
+
+// runScheduledPublisher publishes in-review books whose scheduled_at has
+// passed. It runs until ctx is cancelled at shutdown.
+func runScheduledPublisher(ctx context.Context) {
+	runEvery(ctx, time.Minute, publishDueBooks)
+}
+
+func publishDueBooks() {
+	rows, err := db.Query(
+		`UPDATE books
+		 SET status = $1, published_at = scheduled_at, scheduled_at = NULL
+		 WHERE status = $2 AND scheduled_at <= NOW() AND deleted_at IS NULL
+		 RETURNING id`,
+		statusPublished, statusInReview,
+	)
+	if err != nil {
+		slog.Error("error publishing scheduled books", "error", err)
+		return
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	for _, id := range ids {
+		bookCache.invalidate(id)
+		bookChangesTotal.WithLabelValues("status_changed").Inc()
+		logAudit(0, "publish", "books", id, gin.H{
+			"from":      statusInReview,
+			"to":        statusPublished,
+			"scheduled": true,
+		}, nil)
+	}
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ===================== Recommendations =====================
+
+const (
+	recKindBought  = "bought"  // customers who bought this also bought
+	recKindViewed  = "viewed"  // customers who viewed this also viewed
+	recKindContent = "content" // same authors, category or publisher
+
+	maxSimilarPerBook      = 20
+	maxUserRecommendations = 50
+
+	// advisory lock key กันไม่ให้ rebuild ซ้อนกัน (หลาย instance หรือสั่งมือระหว่าง job รัน)
+	recommendationsLockKey = 4300
+)
+
+// purchasedStatuses are the order statuses that count as a purchase.
+var purchasedStatuses = []string{orderPaid, orderShipped, orderDelivered}
+
+var errRecommendationsBusy = errors.New("recommendations are already being rebuilt")
+
+type RecommendationReason struct {
+	Kind   string `json:"kind"`
+	BookID int    `json:"book_id"`
+	Title  string `json:"title"`
+}
+
+type RecommendedBook struct {
+	Book
+	Score  float64               `json:"score"`
+	Reason *RecommendationReason `json:"reason,omitempty"` // เฉพาะ recommendation ส่วนตัว
+}
+
+type BookRecommendations struct {
+	BookID     int               `json:"book_id"`
+	AlsoBought []RecommendedBook `json:"also_bought"`
+	AlsoViewed []RecommendedBook `json:"also_viewed"`
+	Similar    []RecommendedBook `json:"similar"`
+	ComputedAt *time.Time        `json:"computed_at,omitempty"`
+}
+
+type UserRecommendations struct {
+	// false = ยังไม่มีข้อมูลของ user พอ ใช้หนังสือขายดีแทน
+	Personalised bool              `json:"personalised"`
+	Items        []RecommendedBook `json:"items"`
+	ComputedAt   *time.Time        `json:"computed_at,omitempty"`
+}
+
+type RecommendationStats struct {
+	AlsoBought      int64  `json:"also_bought"`
+	AlsoViewed      int64  `json:"also_viewed"`
+	Similar         int64  `json:"similar"`
+	Personalised    int64  `json:"personalised"`
+	Duration        string `json:"duration"`
+	MinCoOccurrence int    `json:"min_co_occurrence"`
+}
+
+// minCoOccurrence is how many customers must share two books before they
+// are linked. Above 1 so "also bought" never reveals a single customer's orders.
+func minCoOccurrence() int {
+	return cfg.Jobs.RecommendationsMinSupport
+}
+
+// coOccurrenceSQL links books that the same users appear with in source
+// (user_id, book_id), scored by cosine similarity count(A∩B)/√(|A|·|B|).
+// Parameters: $1 kind, $2 minimum co-occurrence, $3 per-book limit.
+func coOccurrenceSQL(source string) string {
+	return `
+	WITH src AS (` + source + `),
+	totals AS (
+		SELECT book_id, COUNT(*) AS n FROM src GROUP BY book_id
+	),
+	pairs AS (
+		SELECT a.book_id, b.book_id AS similar_book_id, COUNT(*) AS together
+		FROM src a
+		JOIN src b ON b.user_id = a.user_id AND b.book_id <> a.book_id
+		GROUP BY a.book_id, b.book_id
+		HAVING COUNT(*) >= $2
+	),
+	ranked AS (
+		SELECT p.book_id, p.similar_book_id,
+		       p.together / sqrt(ta.n::float8 * tb.n) AS score,
+		       ROW_NUMBER() OVER (
+		           PARTITION BY p.book_id
+		           ORDER BY p.together / sqrt(ta.n::float8 * tb.n) DESC, p.similar_book_id
+		       ) AS rank
+		FROM pairs p
+		JOIN totals ta ON ta.book_id = p.book_id
+		JOIN totals tb ON tb.book_id = p.similar_book_id
+	)
+	INSERT INTO book_similarities (book_id, kind, similar_book_id, score)
+	SELECT book_id, $1, similar_book_id, score FROM ranked WHERE rank <= $3`
+}
+
+// แหล่งข้อมูลนับเฉพาะหนังสือที่ยังขายอยู่ ($4 = published)
+const (
+	boughtSource = `
+		SELECT DISTINCT o.user_id, oi.book_id
+		FROM orders o
+		JOIN order_items oi ON oi.order_id = o.id
+		JOIN books b ON b.id = oi.book_id
+		WHERE o.status = ANY($5) AND b.deleted_at IS NULL AND b.status = $4`
+
+	viewedSource = `
+		SELECT v.user_id, v.book_id
+		FROM book_views v
+		JOIN books b ON b.id = v.book_id
+		WHERE b.deleted_at IS NULL AND b.status = $4`
+)
+
+// contentSimilaritySQL scores pairs of published books by shared metadata:
+// 3 per shared author, 2 for the same category, 1 for the same publisher,
+// scaled so that all three together score 1.
+// Parameters: $1 kind, $2 per-book limit, $3 published status.
+const contentSimilaritySQL = `
+	WITH pub AS (
+		SELECT id, category_id, publisher_id FROM books WHERE deleted_at IS NULL AND status = $3
+	),
+	cand AS (
+		SELECT a.book_id, b.book_id AS similar_book_id, 3.0 AS w
+		FROM book_authors a
+		JOIN book_authors b ON b.author_id = a.author_id AND b.book_id <> a.book_id
+		UNION ALL
+		SELECT a.id, b.id, 2.0 FROM pub a JOIN pub b ON b.category_id = a.category_id AND b.id <> a.id
+		UNION ALL
+		SELECT a.id, b.id, 1.0 FROM pub a JOIN pub b ON b.publisher_id = a.publisher_id AND b.id <> a.id
+	),
+	ranked AS (
+		SELECT c.book_id, c.similar_book_id, LEAST(SUM(c.w) / 6.0, 1.0) AS score,
+		       ROW_NUMBER() OVER (PARTITION BY c.book_id ORDER BY SUM(c.w) DESC, c.similar_book_id) AS rank
+		FROM cand c
+		JOIN pub p ON p.id = c.similar_book_id
+		GROUP BY c.book_id, c.similar_book_id
+	)
+	INSERT INTO book_similarities (book_id, kind, similar_book_id, score)
+	SELECT book_id, $1, similar_book_id, score FROM ranked WHERE rank <= $2`
+
+// userRecommendationsSQL combines a user's own books (seeds) with the
+// item-to-item table. Seed weights: purchase 3, positive review 2, wishlist 2,
+// view 1. Kind weights: bought 1, viewed 0.5, content 0.3. Books the user
+// ordered, reviewed or wishlisted are not recommended back.
+// Parameters: $1 per-user limit, $2 published review status,
+// $3 purchased order statuses, $4 cancelled order status.
+const userRecommendationsSQL = `
+	WITH seeds AS (
+		SELECT o.user_id, oi.book_id, 3.0 AS w
+		FROM orders o JOIN order_items oi ON oi.order_id = o.id
+		WHERE o.status = ANY($3)
+		UNION ALL
+		SELECT user_id, book_id, 2.0 FROM reviews WHERE status = $2 AND rating >= 4
+		UNION ALL
+		SELECT w.user_id, wi.book_id, 2.0 FROM wishlists w JOIN wishlist_items wi ON wi.wishlist_id = w.id
+		UNION ALL
+		SELECT user_id, book_id, 1.0 FROM book_views
+	),
+	seed AS (
+		SELECT user_id, book_id, SUM(w) AS w FROM seeds GROUP BY user_id, book_id
+	),
+	known AS (
+		SELECT o.user_id, oi.book_id
+		FROM orders o JOIN order_items oi ON oi.order_id = o.id
+		WHERE o.status <> $4
+		UNION
+		SELECT user_id, book_id FROM reviews
+		UNION
+		SELECT w.user_id, wi.book_id FROM wishlists w JOIN wishlist_items wi ON wi.wishlist_id = w.id
+	),
+	contrib AS (
+		SELECT s.user_id, bs.similar_book_id AS book_id, s.book_id AS seed_book_id, bs.kind,
+		       s.w * bs.score * CASE bs.kind WHEN 'bought' THEN 1.0 WHEN 'viewed' THEN 0.5 ELSE 0.3 END AS score
+		FROM seed s
+		JOIN book_similarities bs ON bs.book_id = s.book_id
+		WHERE NOT EXISTS (
+			SELECT 1 FROM known k WHERE k.user_id = s.user_id AND k.book_id = bs.similar_book_id
+		)
+	),
+	ranked AS (
+		SELECT user_id, book_id, SUM(score) AS score,
+		       (array_agg(seed_book_id ORDER BY score DESC))[1] AS reason_book_id,
+		       (array_agg(kind ORDER BY score DESC))[1] AS reason_kind,
+		       ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY SUM(score) DESC, book_id) AS rank
+		FROM contrib
+		GROUP BY user_id, book_id
+	)
+	INSERT INTO user_recommendations (user_id, book_id, score, reason_book_id, reason_kind)
+	SELECT user_id, book_id, score, reason_book_id, reason_kind FROM ranked WHERE rank <= $1`
+
+// computeRecommendations rebuilds both tables in one transaction, so
+// readers keep seeing the previous results until it commits.
+func computeRecommendations() (RecommendationStats, error) {
+	start := time.Now()
+	stats := RecommendationStats{MinCoOccurrence: minCoOccurrence()}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return stats, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRow("SELECT pg_try_advisory_xact_lock($1)", recommendationsLockKey).Scan(&locked); err != nil {
+		return stats, err
+	}
+	if !locked {
+		return stats, errRecommendationsBusy
+	}
+
+	if _, err := tx.Exec("DELETE FROM book_similarities"); err != nil {
+		return stats, err
+	}
+
+	steps := []struct {
+		count *int64
+		query string
+		args  []interface{}
+	}{
+		{&stats.AlsoBought, coOccurrenceSQL(boughtSource),
+			[]interface{}{recKindBought, stats.MinCoOccurrence, maxSimilarPerBook, statusPublished, pq.Array(purchasedStatuses)}},
+		{&stats.AlsoViewed, coOccurrenceSQL(viewedSource),
+			[]interface{}{recKindViewed, stats.MinCoOccurrence, maxSimilarPerBook, statusPublished}},
+		{&stats.Similar, contentSimilaritySQL,
+			[]interface{}{recKindContent, maxSimilarPerBook, statusPublished}},
+	}
+	for _, step := range steps {
+		result, err := tx.Exec(step.query, step.args...)
+		if err != nil {
+			return stats, err
+		}
+		*step.count, _ = result.RowsAffected()
+	}
+
+	if _, err := tx.Exec("DELETE FROM user_recommendations"); err != nil {
+		return stats, err
+	}
+	result, err := tx.Exec(userRecommendationsSQL,
+		maxUserRecommendations, reviewPublished, pq.Array(purchasedStatuses), orderCancelled)
+	if err != nil {
+		return stats, err
+	}
+	stats.Personalised, _ = result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return stats, err
+	}
+	stats.Duration = time.Since(start).Round(time.Millisecond).String()
+	return stats, nil
+}
+
+// runRecommender rebuilds recommendations every RECOMMENDATIONS_INTERVAL
+// (default 6h). It runs until ctx is cancelled at shutdown.
+func runRecommender(ctx context.Context) {
+	runEvery(ctx, cfg.Jobs.RecommendationsInterval, func() {
+		stats, err := computeRecommendations()
+		if err == errRecommendationsBusy {
+			slog.InfoContext(ctx, "skipping recommendations rebuild", "reason", err)
+		} else if err != nil {
+			slog.ErrorContext(ctx, "error computing recommendations", "error", err)
+		} else {
+			slog.InfoContext(ctx, "recommendations rebuilt",
+				"duration", stats.Duration, "also_bought", stats.AlsoBought, "also_viewed", stats.AlsoViewed,
+				"similar", stats.Similar, "personalised", stats.Personalised)
+		}
+	})
+}
+
+// recordBookView counts a logged-in user's view of a published book.
+func recordBookView(userID, bookID int) {
+	_, err := db.Exec(
+		`INSERT INTO book_views (user_id, book_id) VALUES ($1, $2)
+		 ON CONFLICT (user_id, book_id)
+		 DO UPDATE SET views = book_views.views + 1, last_viewed_at = NOW()`,
+		userID, bookID,
+	)
+	if err != nil {
+		slog.Warn("error recording book view", "book_id", bookID, "error", err)
+	}
+}
+
+// withExtraColumns lets scanBook read rows that have more columns after
+// bookColumns; the extra values are scanned into extra.
+type withExtraColumns struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (w withExtraColumns) Scan(dest ...interface{}) error {
+	return w.row.Scan(append(dest, w.extra...)...)
+}
+
+// loadRecommendedBooks runs a query selecting bookColumns followed by
+// rec_score, reason_book_id, reason_title and reason_kind.
+func loadRecommendedBooks(query string, args ...interface{}) ([]RecommendedBook, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []RecommendedBook{}
+	for rows.Next() {
+		var rb RecommendedBook
+		var reasonID sql.NullInt64
+		var reasonTitle, reasonKind sql.NullString
+		rb.Book, err = scanBook(withExtraColumns{rows, []interface{}{&rb.Score, &reasonID, &reasonTitle, &reasonKind}})
+		if err != nil {
+			return nil, err
+		}
+		if reasonID.Valid && reasonKind.Valid {
+			rb.Reason = &RecommendationReason{
+				Kind:   reasonKind.String,
+				BookID: int(reasonID.Int64),
+				Title:  reasonTitle.String,
+			}
+		}
+		books = append(books, rb)
+	}
+	return books, rows.Err()
+}
+
+// @Summary Recommendations for a book
+// @Description Customers also bought, customers also viewed and similar books (same authors, category or publisher), precomputed periodically
+// @Tags Recommendations
+// @Produce  json
+// @Param   id     path   int  true   "Book ID"
+// @Param   limit  query  int  false  "Books per group (default 10, max 20)"
+// @Success 200  {object}  BookRecommendations
+// @Failure 404  {object}  Problem
+// @Router  /books/{id}/recommendations [get]
+func getBookRecommendations(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+	limit, _, err := parsePage(c, 10, maxSimilarPerBook)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	book, err := loadBook(c.Request.Context(), id)
+	if err == nil && book.Status != statusPublished && !canSeeUnpublished(c) {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	recs := BookRecommendations{BookID: id}
+	groups := []struct {
+		kind string
+		dest *[]RecommendedBook
+	}{
+		{recKindBought, &recs.AlsoBought},
+		{recKindViewed, &recs.AlsoViewed},
+		{recKindContent, &recs.Similar},
+	}
+	for _, g := range groups {
+		*g.dest, err = loadRecommendedBooks(
+			`SELECT `+bookColumns+`, r.rec_score, NULL::INTEGER, NULL::TEXT, NULL::TEXT
+			 FROM books
+			 JOIN (
+				SELECT similar_book_id AS rec_id, score AS rec_score
+				FROM book_similarities WHERE book_id = $1 AND kind = $2
+			 ) r ON r.rec_id = books.id
+			 WHERE books.deleted_at IS NULL AND books.status = $3
+			 ORDER BY r.rec_score DESC, books.id
+			 LIMIT $4`,
+			id, g.kind, statusPublished, limit,
+		)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+	}
+
+	var computedAt sql.NullTime
+	if err := db.QueryRow("SELECT MAX(computed_at) FROM book_similarities WHERE book_id = $1", id).Scan(&computedAt); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if computedAt.Valid {
+		recs.ComputedAt = &computedAt.Time
+	}
+
+	respondCached(c, recs, computedAt.Time)
+}
+
+// @Summary Personalised recommendations
+// @Description Based on the caller's purchases, reviews, wishlists and views; falls back to recent best sellers
+// @Tags Recommendations
+// @Produce  json
+// @Param   limit  query  int  false  "Number of books (default 20, max 50)"
+// @Success 200  {object}  UserRecommendations
+// @Router  /recommendations [get]
+func getMyRecommendations(c *gin.Context) {
+	limit, _, err := parsePage(c, 20, maxUserRecommendations)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	items, err := loadRecommendedBooks(
+		`SELECT `+bookColumns+`, r.rec_score, r.reason_book_id, r.reason_title, r.reason_kind
+		 FROM books
+		 JOIN (
+			SELECT ur.book_id AS rec_id, ur.score AS rec_score, ur.reason_book_id, ur.reason_kind,
+			       (SELECT rb.title FROM books rb WHERE rb.id = ur.reason_book_id) AS reason_title
+			FROM user_recommendations ur WHERE ur.user_id = $1
+		 ) r ON r.rec_id = books.id
+		 WHERE books.deleted_at IS NULL AND books.status = $2
+		 ORDER BY r.rec_score DESC, books.id
+		 LIMIT $3`,
+		userID, statusPublished, limit,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	recs := UserRecommendations{Personalised: len(items) > 0, Items: items}
+	var computedAt sql.NullTime
+	if recs.Personalised {
+		err = db.QueryRow("SELECT MAX(computed_at) FROM user_recommendations WHERE user_id = $1", userID).Scan(&computedAt)
+	} else {
+		// cold start: ขายดีใน 90 วันล่าสุด (score = จำนวนเล่มที่ขายได้)
+		recs.Items, err = loadRecommendedBooks(
+			`SELECT `+bookColumns+`, r.rec_score, NULL::INTEGER, NULL::TEXT, NULL::TEXT
+			 FROM books
+			 JOIN (
+				SELECT oi.book_id AS rec_id, SUM(oi.quantity)::float8 AS rec_score
+				FROM order_items oi JOIN orders o ON o.id = oi.order_id
+				WHERE o.status = ANY($1) AND o.created_at > NOW() - INTERVAL '90 days'
+				GROUP BY oi.book_id
+			 ) r ON r.rec_id = books.id
+			 WHERE books.deleted_at IS NULL AND books.status = $2
+			 ORDER BY r.rec_score DESC, books.id
+			 LIMIT $3`,
+			pq.Array(purchasedStatuses), statusPublished, limit,
+		)
+	}
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if computedAt.Valid {
+		recs.ComputedAt = &computedAt.Time
+	}
+
+	respondCached(c, recs, computedAt.Time)
+}
+
+// refreshRecommendations rebuilds recommendations now instead of waiting
+// for the next scheduled run.
+func refreshRecommendations(c *gin.Context) {
+	stats, err := computeRecommendations()
+	if err == errRecommendationsBusy {
+		respondProblem(c, http.StatusConflict, codeConflict, err.Error())
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	logAudit(userID, "refresh", "recommendations", nil, gin.H{
+		"also_bought":  stats.AlsoBought,
+		"also_viewed":  stats.AlsoViewed,
+		"similar":      stats.Similar,
+		"personalised": stats.Personalised,
+		"duration":     stats.Duration,
+	}, c)
+
+	c.JSON(http.StatusOK, stats)
+}
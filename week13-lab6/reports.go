@@ -0,0 +1,684 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"week13-lab6/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ===================== Reports =====================
+
+// Materialized views refreshed by runReportRefresher (migration20.sql).
+const (
+	viewDailySales        = "report_daily_sales"
+	viewDailyBookSales    = "report_daily_book_sales"
+	viewDailyUserActivity = "report_daily_user_activity"
+
+	reportDateLayout  = "2006-01-02"
+	defaultReportDays = 30
+	maxReportDays     = 5 * 366
+)
+
+var reportViews = []string{viewDailySales, viewDailyBookSales, viewDailyUserActivity}
+
+var reportIntervals = map[string]bool{"day": true, "week": true, "month": true}
+
+// reportZone matches the Asia/Bangkok days the views are grouped by.
+var reportZone = time.FixedZone("ICT", 7*60*60)
+
+// Report is the JSON envelope of every report. With ?format=csv the rows
+// are written as CSV instead, one header row first.
+type Report struct {
+	Report      string      `json:"report"`
+	From        string      `json:"from,omitempty"`
+	To          string      `json:"to,omitempty"`
+	Interval    string      `json:"interval,omitempty"`
+	Currency    string      `json:"currency,omitempty"`
+	RefreshedAt *time.Time  `json:"refreshed_at,omitempty"` // nil = ข้อมูล ณ ขณะนี้
+	Rows        interface{} `json:"rows"`
+
+	header  []string
+	records [][]string
+}
+
+func (r *Report) add(record ...string) {
+	r.records = append(r.records, record)
+}
+
+type RevenueRow struct {
+	Period   string      `json:"period"`
+	Currency string      `json:"currency"`
+	Orders   int64       `json:"orders"`
+	Units    int64       `json:"units"`
+	Subtotal money.Money `json:"subtotal"`
+	Discount money.Money `json:"discount"`
+	VAT      money.Money `json:"vat"`
+	Net      money.Money `json:"net"` // total ไม่รวม VAT
+	Total    money.Money `json:"total"`
+}
+
+type TopSellerRow struct {
+	Rank    int         `json:"rank"`
+	BookID  int         `json:"book_id"` // 0 = หนังสือที่ถูกลบถาวร
+	Title   string      `json:"title"`
+	Author  string      `json:"author"`
+	Orders  int64       `json:"orders"`
+	Units   int64       `json:"units"`
+	Revenue money.Money `json:"revenue"`
+}
+
+type SalesGroupRow struct {
+	ID      int         `json:"id"` // 0 = ไม่มีหมวด/ผู้แต่ง
+	Name    string      `json:"name"`
+	Books   int64       `json:"books"`
+	Units   int64       `json:"units"`
+	Revenue money.Money `json:"revenue"`
+}
+
+type InventoryValuationRow struct {
+	CategoryID int         `json:"category_id"`
+	Category   string      `json:"category"`
+	Titles     int64       `json:"titles"`
+	OnHand     int64       `json:"on_hand"`
+	Reserved   int64       `json:"reserved"`
+	Value      money.Money `json:"value"`
+}
+
+type LoginStatsRow struct {
+	Period       string `json:"period"`
+	Logins       int64  `json:"logins"`
+	FailedLogins int64  `json:"failed_logins"`
+	UniqueUsers  int64  `json:"unique_users"`
+	Logouts      int64  `json:"logouts"`
+}
+
+type ActivityRow struct {
+	Action      string `json:"action"`
+	Resource    string `json:"resource"`
+	Events      int64  `json:"events"`
+	UniqueUsers int64  `json:"unique_users"`
+}
+
+type reportRange struct {
+	from, to time.Time
+}
+
+// parseReportRange reads from/to (YYYY-MM-DD, both inclusive). Defaults
+// to the last 30 days ending today.
+func parseReportRange(c *gin.Context) (reportRange, error) {
+	var r reportRange
+	var err error
+
+	now := time.Now().In(reportZone)
+	r.to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if v := c.Query("to"); v != "" {
+		if r.to, err = time.Parse(reportDateLayout, v); err != nil {
+			return r, fmt.Errorf("to must be a date in YYYY-MM-DD format")
+		}
+	}
+	r.from = r.to.AddDate(0, 0, -(defaultReportDays - 1))
+	if v := c.Query("from"); v != "" {
+		if r.from, err = time.Parse(reportDateLayout, v); err != nil {
+			return r, fmt.Errorf("from must be a date in YYYY-MM-DD format")
+		}
+	}
+
+	if r.from.After(r.to) {
+		return r, fmt.Errorf("from must not be after to")
+	}
+	if r.to.Sub(r.from) > maxReportDays*24*time.Hour {
+		return r, fmt.Errorf("date range must be at most %d days", maxReportDays)
+	}
+	return r, nil
+}
+
+func parseReportInterval(c *gin.Context) (string, error) {
+	interval := c.DefaultQuery("interval", "day")
+	if !reportIntervals[interval] {
+		return "", fmt.Errorf("interval must be one of day, week, month")
+	}
+	return interval, nil
+}
+
+// reportCurrency reads ?currency= (default THB). Sales are stored in the
+// currency of each order, so per-book and per-group reports are per currency.
+func reportCurrency(c *gin.Context) (string, error) {
+	currency := strings.ToUpper(c.DefaultQuery("currency", baseCurrency))
+	if !money.Known(currency) {
+		return "", fmt.Errorf("unsupported currency %s", currency)
+	}
+	return currency, nil
+}
+
+// reportRefreshedAt returns the oldest refresh time of the views a report reads.
+func reportRefreshedAt(views ...string) (*time.Time, error) {
+	var t sql.NullTime
+	err := db.QueryRow("SELECT MIN(refreshed_at) FROM report_refreshes WHERE view_name = ANY($1)", pq.Array(views)).Scan(&t)
+	if err != nil || !t.Valid {
+		return nil, err
+	}
+	return &t.Time, nil
+}
+
+// respondReport writes JSON, or CSV when ?format=csv.
+func respondReport(c *gin.Context, r *Report) {
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.JSON(http.StatusOK, r)
+	case "csv":
+		filename := r.Report
+		if r.From != "" {
+			filename += "_" + r.From + "_" + r.To
+		}
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, filename))
+		c.Status(http.StatusOK)
+
+		// ชื่อหนังสือ/ผู้แต่งมาจากผู้ใช้ ต้องกันไม่ให้ spreadsheet รันเป็นสูตร
+		w := csv.NewWriter(c.Writer)
+		w.Write(r.header)
+		for _, record := range r.records {
+			w.Write(csvSafeRecord(record))
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			slog.ErrorContext(c.Request.Context(), "error writing report csv", "report", r.Report, "error", err)
+		}
+	default:
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "format must be json or csv")
+	}
+}
+
+// reportParams parses the parameters shared by most reports and responds
+// 400 on failure.
+func reportParams(c *gin.Context, name string) (*Report, reportRange, bool) {
+	rng, err := parseReportRange(c)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return nil, rng, false
+	}
+	return &Report{
+		Report: name,
+		From:   rng.from.Format(reportDateLayout),
+		To:     rng.to.Format(reportDateLayout),
+	}, rng, true
+}
+
+func itoa(n int64) string { return strconv.FormatInt(n, 10) }
+
+// @Summary Revenue by day, week or month
+// @Tags Reports
+// @Produce  json,text/csv
+// @Param   from      query  string  false  "Start date YYYY-MM-DD (default 30 days ago)"
+// @Param   to        query  string  false  "End date YYYY-MM-DD, inclusive (default today)"
+// @Param   interval  query  string  false  "day (default), week or month"
+// @Param   currency  query  string  false  "Only orders in this currency (default all)"
+// @Param   format    query  string  false  "json (default) or csv"
+// @Success 200  {object}  Report
+// @Router  /reports/revenue [get]
+func getRevenueReport(c *gin.Context) {
+	report, rng, ok := reportParams(c, "revenue")
+	if !ok {
+		return
+	}
+	interval, err := parseReportInterval(c)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	report.Interval = interval
+
+	query := `SELECT date_trunc($3, day::timestamp)::date, currency,
+			SUM(orders), SUM(units), SUM(subtotal_minor), SUM(discount_minor), SUM(vat_minor), SUM(total_minor)
+		FROM ` + viewDailySales + `
+		WHERE day BETWEEN $1 AND $2`
+	args := []interface{}{rng.from, rng.to, interval}
+	if c.Query("currency") != "" {
+		if report.Currency, err = reportCurrency(c); err != nil {
+			respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		query += " AND currency = $4"
+		args = append(args, report.Currency)
+	}
+	query += " GROUP BY 1, 2 ORDER BY 1, 2"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	report.header = []string{"period", "currency", "orders", "units", "subtotal", "discount", "vat", "net", "total"}
+	result := []RevenueRow{}
+	for rows.Next() {
+		var r RevenueRow
+		var period time.Time
+		var subtotal, discount, vat, total int64
+		if err := rows.Scan(&period, &r.Currency, &r.Orders, &r.Units, &subtotal, &discount, &vat, &total); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		r.Period = period.Format(reportDateLayout)
+		r.Subtotal = money.New(subtotal, r.Currency)
+		r.Discount = money.New(discount, r.Currency)
+		r.VAT = money.New(vat, r.Currency)
+		r.Total = money.New(total, r.Currency)
+		r.Net = r.Total.Sub(r.VAT)
+		result = append(result, r)
+		report.add(r.Period, r.Currency, itoa(r.Orders), itoa(r.Units),
+			r.Subtotal.String(), r.Discount.String(), r.VAT.String(), r.Net.String(), r.Total.String())
+	}
+	if err := rows.Err(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	report.Rows = result
+
+	if report.RefreshedAt, err = reportRefreshedAt(viewDailySales); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	respondReport(c, report)
+}
+
+// @Summary Top-selling books
+// @Tags Reports
+// @Produce  json,text/csv
+// @Param   from      query  string  false  "Start date YYYY-MM-DD"
+// @Param   to        query  string  false  "End date YYYY-MM-DD, inclusive"
+// @Param   currency  query  string  false  "Currency of the orders counted (default THB)"
+// @Param   by        query  string  false  "units (default) or revenue"
+// @Param   limit     query  int     false  "Number of books (default 20, max 100)"
+// @Param   format    query  string  false  "json (default) or csv"
+// @Success 200  {object}  Report
+// @Router  /reports/top-sellers [get]
+func getTopSellersReport(c *gin.Context) {
+	report, rng, ok := reportParams(c, "top_sellers")
+	if !ok {
+		return
+	}
+	var err error
+	if report.Currency, err = reportCurrency(c); err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	limit, _, err := parsePage(c, 20, 100)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	order := "units DESC, revenue DESC"
+	switch c.DefaultQuery("by", "units") {
+	case "units":
+	case "revenue":
+		order = "revenue DESC, units DESC"
+	default:
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "by must be units or revenue")
+		return
+	}
+
+	rows, err := db.Query(
+		`SELECT s.book_id, COALESCE(b.title, MAX(s.title)), COALESCE(b.author, ''),
+		        SUM(s.orders), SUM(s.units) AS units, SUM(s.revenue_minor) AS revenue
+		 FROM `+viewDailyBookSales+` s
+		 LEFT JOIN books b ON b.id = s.book_id
+		 WHERE s.day BETWEEN $1 AND $2 AND s.currency = $3
+		 GROUP BY s.book_id, b.title, b.author
+		 ORDER BY `+order+`, s.book_id
+		 LIMIT $4`,
+		rng.from, rng.to, report.Currency, limit,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	report.header = []string{"rank", "book_id", "title", "author", "orders", "units", "revenue", "currency"}
+	result := []TopSellerRow{}
+	for rows.Next() {
+		r := TopSellerRow{Rank: len(result) + 1}
+		var revenue int64
+		if err := rows.Scan(&r.BookID, &r.Title, &r.Author, &r.Orders, &r.Units, &revenue); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		r.Revenue = money.New(revenue, report.Currency)
+		result = append(result, r)
+		report.add(strconv.Itoa(r.Rank), strconv.Itoa(r.BookID), r.Title, r.Author,
+			itoa(r.Orders), itoa(r.Units), r.Revenue.String(), report.Currency)
+	}
+	if err := rows.Err(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	report.Rows = result
+
+	if report.RefreshedAt, err = reportRefreshedAt(viewDailyBookSales); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	respondReport(c, report)
+}
+
+// salesGroupReport aggregates book sales by the group that join/id/name
+// select. Books without a group are reported under id 0.
+func salesGroupReport(c *gin.Context, name, join, id, groupName string) {
+	report, rng, ok := reportParams(c, name)
+	if !ok {
+		return
+	}
+	var err error
+	if report.Currency, err = reportCurrency(c); err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	rows, err := db.Query(
+		`SELECT COALESCE(`+id+`, 0) AS group_id, COALESCE(`+groupName+`, '') AS group_name,
+		        COUNT(DISTINCT s.book_id), SUM(s.units), SUM(s.revenue_minor) AS revenue
+		 FROM `+viewDailyBookSales+` s
+		 `+join+`
+		 WHERE s.day BETWEEN $1 AND $2 AND s.currency = $3
+		 GROUP BY 1, 2
+		 ORDER BY revenue DESC, group_id`,
+		rng.from, rng.to, report.Currency,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	report.header = []string{"id", "name", "books", "units", "revenue", "currency"}
+	result := []SalesGroupRow{}
+	for rows.Next() {
+		var r SalesGroupRow
+		var revenue int64
+		if err := rows.Scan(&r.ID, &r.Name, &r.Books, &r.Units, &revenue); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		r.Revenue = money.New(revenue, report.Currency)
+		result = append(result, r)
+		report.add(strconv.Itoa(r.ID), r.Name, itoa(r.Books), itoa(r.Units), r.Revenue.String(), report.Currency)
+	}
+	if err := rows.Err(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	report.Rows = result
+
+	if report.RefreshedAt, err = reportRefreshedAt(viewDailyBookSales); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	respondReport(c, report)
+}
+
+// @Summary Sales by category
+// @Tags Reports
+// @Produce  json,text/csv
+// @Param   from      query  string  false  "Start date YYYY-MM-DD"
+// @Param   to        query  string  false  "End date YYYY-MM-DD, inclusive"
+// @Param   currency  query  string  false  "Currency of the orders counted (default THB)"
+// @Param   format    query  string  false  "json (default) or csv"
+// @Success 200  {object}  Report
+// @Router  /reports/sales-by-category [get]
+func getSalesByCategoryReport(c *gin.Context) {
+	salesGroupReport(c, "sales_by_category",
+		`LEFT JOIN books b ON b.id = s.book_id
+		 LEFT JOIN categories cat ON cat.id = b.category_id`,
+		"cat.id", "cat.name")
+}
+
+// @Summary Sales by author
+// @Description A co-written book counts in full for each of its authors
+// @Tags Reports
+// @Produce  json,text/csv
+// @Param   from      query  string  false  "Start date YYYY-MM-DD"
+// @Param   to        query  string  false  "End date YYYY-MM-DD, inclusive"
+// @Param   currency  query  string  false  "Currency of the orders counted (default THB)"
+// @Param   format    query  string  false  "json (default) or csv"
+// @Success 200  {object}  Report
+// @Router  /reports/sales-by-author [get]
+func getSalesByAuthorReport(c *gin.Context) {
+	salesGroupReport(c, "sales_by_author",
+		`LEFT JOIN book_authors ba ON ba.book_id = s.book_id
+		 LEFT JOIN authors a ON a.id = ba.author_id`,
+		"a.id", "a.name")
+}
+
+// @Summary Inventory valuation
+// @Description Current stock on hand valued at the current base list price, by category
+// @Tags Reports
+// @Produce  json,text/csv
+// @Param   format  query  string  false  "json (default) or csv"
+// @Success 200  {object}  Report
+// @Router  /reports/inventory-valuation [get]
+func getInventoryValuationReport(c *gin.Context) {
+	rows, err := db.Query(
+		`SELECT COALESCE(cat.id, 0) AS category_id, COALESCE(cat.name, ''),
+		        COUNT(*), SUM(s.on_hand), SUM(s.reserved),
+		        SUM(s.on_hand * ROUND(b.price * 100)::BIGINT) AS value
+		 FROM stock s
+		 JOIN books b ON b.id = s.book_id
+		 LEFT JOIN categories cat ON cat.id = b.category_id
+		 WHERE b.deleted_at IS NULL
+		 GROUP BY 1, 2
+		 ORDER BY value DESC, category_id`,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	report := &Report{Report: "inventory_valuation", Currency: baseCurrency}
+	report.header = []string{"category_id", "category", "titles", "on_hand", "reserved", "value", "currency"}
+	result := []InventoryValuationRow{}
+	for rows.Next() {
+		var r InventoryValuationRow
+		var value int64
+		if err := rows.Scan(&r.CategoryID, &r.Category, &r.Titles, &r.OnHand, &r.Reserved, &value); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		r.Value = money.New(value, baseCurrency)
+		result = append(result, r)
+		report.add(strconv.Itoa(r.CategoryID), r.Category, itoa(r.Titles), itoa(r.OnHand), itoa(r.Reserved),
+			r.Value.String(), baseCurrency)
+	}
+	if err := rows.Err(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	report.Rows = result
+
+	respondReport(c, report)
+}
+
+// @Summary Login statistics
+// @Tags Reports
+// @Produce  json,text/csv
+// @Param   from      query  string  false  "Start date YYYY-MM-DD"
+// @Param   to        query  string  false  "End date YYYY-MM-DD, inclusive"
+// @Param   interval  query  string  false  "day (default), week or month"
+// @Param   format    query  string  false  "json (default) or csv"
+// @Success 200  {object}  Report
+// @Router  /reports/logins [get]
+func getLoginReport(c *gin.Context) {
+	report, rng, ok := reportParams(c, "logins")
+	if !ok {
+		return
+	}
+	interval, err := parseReportInterval(c)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	report.Interval = interval
+
+	rows, err := db.Query(
+		`SELECT date_trunc($3, day::timestamp)::date,
+		        COALESCE(SUM(events) FILTER (WHERE action = 'login'), 0),
+		        COALESCE(SUM(events) FILTER (WHERE action = 'login_failed'), 0),
+		        COUNT(DISTINCT user_id) FILTER (WHERE action = 'login'),
+		        COALESCE(SUM(events) FILTER (WHERE action = 'logout'), 0)
+		 FROM `+viewDailyUserActivity+`
+		 WHERE day BETWEEN $1 AND $2 AND resource = 'auth'
+		 GROUP BY 1
+		 ORDER BY 1`,
+		rng.from, rng.to, interval,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	report.header = []string{"period", "logins", "failed_logins", "unique_users", "logouts"}
+	result := []LoginStatsRow{}
+	for rows.Next() {
+		var r LoginStatsRow
+		var period time.Time
+		if err := rows.Scan(&period, &r.Logins, &r.FailedLogins, &r.UniqueUsers, &r.Logouts); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		r.Period = period.Format(reportDateLayout)
+		result = append(result, r)
+		report.add(r.Period, itoa(r.Logins), itoa(r.FailedLogins), itoa(r.UniqueUsers), itoa(r.Logouts))
+	}
+	if err := rows.Err(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	report.Rows = result
+
+	if report.RefreshedAt, err = reportRefreshedAt(viewDailyUserActivity); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	respondReport(c, report)
+}
+
+// @Summary Activity by action and resource
+// @Tags Reports
+// @Produce  json,text/csv
+// @Param   from      query  string  false  "Start date YYYY-MM-DD"
+// @Param   to        query  string  false  "End date YYYY-MM-DD, inclusive"
+// @Param   resource  query  string  false  "Only this resource, e.g. books"
+// @Param   format    query  string  false  "json (default) or csv"
+// @Success 200  {object}  Report
+// @Router  /reports/activity [get]
+func getActivityReport(c *gin.Context) {
+	report, rng, ok := reportParams(c, "activity")
+	if !ok {
+		return
+	}
+
+	query := `SELECT action, resource, SUM(events) AS events, COUNT(DISTINCT user_id) FILTER (WHERE user_id > 0)
+		FROM ` + viewDailyUserActivity + `
+		WHERE day BETWEEN $1 AND $2`
+	args := []interface{}{rng.from, rng.to}
+	if resource := c.Query("resource"); resource != "" {
+		query += " AND resource = $3"
+		args = append(args, resource)
+	}
+	query += " GROUP BY action, resource ORDER BY events DESC, action, resource"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	report.header = []string{"action", "resource", "events", "unique_users"}
+	result := []ActivityRow{}
+	for rows.Next() {
+		var r ActivityRow
+		if err := rows.Scan(&r.Action, &r.Resource, &r.Events, &r.UniqueUsers); err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		result = append(result, r)
+		report.add(r.Action, r.Resource, itoa(r.Events), itoa(r.UniqueUsers))
+	}
+	if err := rows.Err(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	report.Rows = result
+
+	if report.RefreshedAt, err = reportRefreshedAt(viewDailyUserActivity); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	respondReport(c, report)
+}
+
+// ===================== Report Refresh =====================
+
+// refreshReportViews refreshes every view without blocking readers
+// (CONCURRENTLY) and records when each finished.
+func refreshReportViews() error {
+	for _, view := range reportViews {
+		start := time.Now()
+		if _, err := db.Exec("REFRESH MATERIALIZED VIEW CONCURRENTLY " + view); err != nil {
+			return fmt.Errorf("refresh %s: %w", view, err)
+		}
+		_, err := db.Exec(
+			`INSERT INTO report_refreshes (view_name, refreshed_at, duration_ms) VALUES ($1, NOW(), $2)
+			 ON CONFLICT (view_name) DO UPDATE SET refreshed_at = EXCLUDED.refreshed_at, duration_ms = EXCLUDED.duration_ms`,
+			view, time.Since(start).Milliseconds(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runReportRefresher refreshes the report views every
+// REPORTS_REFRESH_INTERVAL (default 1h). It runs until ctx is cancelled at shutdown.
+func runReportRefresher(ctx context.Context) {
+	runEvery(ctx, cfg.Jobs.ReportsRefreshInterval, func() {
+		if err := refreshReportViews(); err != nil {
+			slog.ErrorContext(ctx, "error refreshing reports", "error", err)
+		}
+	})
+}
+
+// refreshReports refreshes the views now instead of waiting for the next run.
+func refreshReports(c *gin.Context) {
+	if err := refreshReportViews(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	refreshedAt, err := reportRefreshedAt(reportViews...)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	logAudit(userID, "refresh", "reports", nil, nil, c)
+
+	c.JSON(http.StatusOK, gin.H{"refreshed_at": refreshedAt})
+}
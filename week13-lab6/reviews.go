@@ -0,0 +1,598 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Reviews & Ratings =====================
+
+const (
+	reviewPublished = "published"
+	reviewHidden    = "hidden"
+)
+
+type Review struct {
+	ID             int       `json:"id"`
+	BookID         int       `json:"book_id"`
+	UserID         int       `json:"user_id"`
+	Username       string    `json:"username"`
+	Rating         int       `json:"rating"`
+	Title          string    `json:"title"`
+	Body           string    `json:"body"`
+	Status         string    `json:"status"`
+	HelpfulCount   int       `json:"helpful_count"`
+	UnhelpfulCount int       `json:"unhelpful_count"`
+	ModerationNote string    `json:"moderation_note,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type ReviewRequest struct {
+	Rating int    `json:"rating" binding:"required,min=1,max=5"`
+	Title  string `json:"title" binding:"max=200"`
+	Body   string `json:"body" binding:"max=5000"`
+}
+
+type ModerateReviewRequest struct {
+	Status string `json:"status" binding:"required,oneof=published hidden"`
+	Note   string `json:"note" binding:"max=1000"`
+}
+
+type ReviewVoteRequest struct {
+	Helpful *bool `json:"helpful" binding:"required"`
+}
+
+const reviewColumns = `r.id, r.book_id, r.user_id, u.username, r.rating, r.title, r.body,
+	r.status, r.helpful_count, r.unhelpful_count, r.moderation_note, r.created_at, r.updated_at`
+
+const reviewFrom = " FROM reviews r JOIN users u ON u.id = r.user_id"
+
+func scanReview(row rowScanner) (Review, error) {
+	var r Review
+	err := row.Scan(
+		&r.ID, &r.BookID, &r.UserID, &r.Username, &r.Rating, &r.Title, &r.Body,
+		&r.Status, &r.HelpfulCount, &r.UnhelpfulCount, &r.ModerationNote, &r.CreatedAt, &r.UpdatedAt,
+	)
+	return r, err
+}
+
+// reviewSorts maps ?sort= to ORDER BY clauses.
+var reviewSorts = map[string]string{
+	"recent":      "r.created_at DESC, r.id DESC",
+	"helpful":     "(r.helpful_count - r.unhelpful_count) DESC, r.created_at DESC",
+	"rating_high": "r.rating DESC, r.created_at DESC",
+	"rating_low":  "r.rating ASC, r.created_at DESC",
+}
+
+// @Summary List reviews of a book
+// @Tags Reviews
+// @Produce  json
+// @Param   id      path   int     true   "Book ID"
+// @Param   sort    query  string  false  "recent (default), helpful, rating_high, rating_low"
+// @Param   limit   query  int     false  "Page size (max 100)"
+// @Param   offset  query  int     false  "Offset"
+// @Param   status  query  string  false  "published or hidden (moderators only)"
+// @Success 200  {array}  Review
+// @Failure 404  {object}  Problem
+// @Router  /books/{id}/reviews [get]
+func getBookReviews(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+
+	book, err := loadBook(c.Request.Context(), bookID)
+	if err == nil && book.Status != statusPublished && !canSeeUnpublished(c) {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	order, ok := reviewSorts[c.DefaultQuery("sort", "recent")]
+	if !ok {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "sort must be one of recent, helpful, rating_high, rating_low")
+		return
+	}
+	limit, offset, err := parsePage(c, 20, 100)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	// review ที่ถูกซ่อนดูได้เฉพาะ moderator
+	status := reviewPublished
+	if s := c.Query("status"); s != "" && checkUserPermission(c.Request.Context(), c.GetInt("user_id"), "reviews:moderate") {
+		status = s
+	}
+
+	lastModified := collectionModified(c.Request.Context(), "reviews")
+	rows, err := db.Query(
+		"SELECT "+reviewColumns+reviewFrom+
+			" WHERE r.book_id = $1 AND r.status = $2 ORDER BY "+order+" LIMIT $3 OFFSET $4",
+		bookID, status, limit, offset,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	reviews := []Review{}
+	for rows.Next() {
+		r, err := scanReview(rows)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		if status == reviewPublished {
+			r.ModerationNote = ""
+		}
+		reviews = append(reviews, r)
+	}
+
+	respondCached(c, reviews, lastModified)
+}
+
+func createReview(c *gin.Context) {
+	bookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+
+	var req ReviewRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// review ได้เฉพาะหนังสือที่เผยแพร่แล้ว
+	status, err := lockBookForRating(tx, bookID)
+	if err == nil && status != statusPublished {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	var reviewID int
+	err = tx.QueryRow(
+		`INSERT INTO reviews (book_id, user_id, rating, title, body)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING id`,
+		bookID, userID, req.Rating, req.Title, req.Body,
+	).Scan(&reviewID)
+	if isUniqueViolation(err) {
+		respondProblem(c, http.StatusConflict, codeConflict, "you have already reviewed this book")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	if err := refreshBookRating(tx, bookID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	review, err := scanReview(tx.QueryRow("SELECT "+reviewColumns+reviewFrom+" WHERE r.id = $1", reviewID))
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	bookCache.invalidate(bookID)
+
+	// Log audit
+	logAudit(userID, "create", "reviews", reviewID, gin.H{
+		"book_id": bookID,
+		"rating":  req.Rating,
+	}, c)
+
+	c.JSON(http.StatusCreated, review)
+}
+
+func updateReview(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid review id")
+		return
+	}
+
+	var req ReviewRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	review, ok := lockReview(c, tx, id)
+	if !ok {
+		return
+	}
+	if review.UserID != userID {
+		respondProblem(c, http.StatusForbidden, codeForbidden, "you can only edit your own review")
+		return
+	}
+	if _, err := lockBookForRating(tx, review.BookID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	_, err = tx.Exec(
+		"UPDATE reviews SET rating = $1, title = $2, body = $3, updated_at = NOW() WHERE id = $4",
+		req.Rating, req.Title, req.Body, id,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := refreshBookRating(tx, review.BookID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	review, err = scanReview(tx.QueryRow("SELECT "+reviewColumns+reviewFrom+" WHERE r.id = $1", id))
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	bookCache.invalidate(review.BookID)
+
+	// Log audit
+	logAudit(userID, "update", "reviews", id, gin.H{
+		"book_id": review.BookID,
+		"rating":  req.Rating,
+	}, c)
+
+	c.JSON(http.StatusOK, review)
+}
+
+// deleteReview ลบ review ของตัวเอง หรือของใครก็ได้ถ้ามี reviews:moderate
+func deleteReview(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid review id")
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	review, ok := lockReview(c, tx, id)
+	if !ok {
+		return
+	}
+	if review.UserID != userID && !checkUserPermission(c.Request.Context(), userID, "reviews:moderate") {
+		respondProblem(c, http.StatusForbidden, codeForbidden, "you can only delete your own review")
+		return
+	}
+	if _, err := lockBookForRating(tx, review.BookID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM reviews WHERE id = $1", id); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := refreshBookRating(tx, review.BookID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	bookCache.invalidate(review.BookID)
+
+	// Log audit
+	logAudit(userID, "delete", "reviews", id, gin.H{
+		"book_id":  review.BookID,
+		"owner_id": review.UserID,
+	}, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "review deleted successfully"})
+}
+
+// moderateReview ซ่อนหรือแสดง review; review ที่ซ่อนไม่นับใน rating
+func moderateReview(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid review id")
+		return
+	}
+
+	var req ModerateReviewRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	review, ok := lockReview(c, tx, id)
+	if !ok {
+		return
+	}
+	if _, err := lockBookForRating(tx, review.BookID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	_, err = tx.Exec(
+		`UPDATE reviews
+		 SET status = $1, moderation_note = $2, moderated_by = $3, moderated_at = NOW()
+		 WHERE id = $4`,
+		req.Status, req.Note, userID, id,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := refreshBookRating(tx, review.BookID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	updated, err := scanReview(tx.QueryRow("SELECT "+reviewColumns+reviewFrom+" WHERE r.id = $1", id))
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	bookCache.invalidate(review.BookID)
+
+	// Log audit
+	logAudit(userID, "moderate", "reviews", id, gin.H{
+		"from": review.Status,
+		"to":   req.Status,
+		"note": req.Note,
+	}, c)
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// voteReview records or changes the caller's helpfulness vote.
+func voteReview(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid review id")
+		return
+	}
+
+	var req ReviewVoteRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	review, ok := lockReview(c, tx, id)
+	if !ok {
+		return
+	}
+	if review.Status != reviewPublished {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "review not found")
+		return
+	}
+	if review.UserID == userID {
+		respondProblem(c, http.StatusForbidden, codeForbidden, "you cannot vote on your own review")
+		return
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO review_votes (review_id, user_id, helpful) VALUES ($1, $2, $3)
+		 ON CONFLICT (review_id, user_id) DO UPDATE SET helpful = EXCLUDED.helpful`,
+		id, userID, *req.Helpful,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	review, ok = finishVote(c, tx, id)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, review)
+}
+
+func deleteReviewVote(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid review id")
+		return
+	}
+	userID := c.GetInt("user_id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, ok := lockReview(c, tx, id); !ok {
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM review_votes WHERE review_id = $1 AND user_id = $2", id, userID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	review, ok := finishVote(c, tx, id)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, review)
+}
+
+// finishVote recounts the votes, commits and returns the updated review.
+func finishVote(c *gin.Context, tx *sql.Tx, id int) (Review, bool) {
+	_, err := tx.Exec(
+		`UPDATE reviews SET
+			helpful_count = (SELECT COUNT(*) FROM review_votes WHERE review_id = $1 AND helpful),
+			unhelpful_count = (SELECT COUNT(*) FROM review_votes WHERE review_id = $1 AND NOT helpful)
+		 WHERE id = $1`,
+		id,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return Review{}, false
+	}
+	review, err := scanReview(tx.QueryRow("SELECT "+reviewColumns+reviewFrom+" WHERE r.id = $1", id))
+	if err != nil {
+		respondInternalError(c, err)
+		return Review{}, false
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return Review{}, false
+	}
+	review.ModerationNote = ""
+	return review, true
+}
+
+// lockReview loads the review with FOR UPDATE so concurrent votes and edits
+// are applied one at a time. It writes a 404 and returns false when missing.
+func lockReview(c *gin.Context, tx *sql.Tx, id int) (Review, bool) {
+	review, err := scanReview(tx.QueryRow(
+		"SELECT "+reviewColumns+reviewFrom+" WHERE r.id = $1 FOR UPDATE OF r", id,
+	))
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "review not found")
+		return Review{}, false
+	} else if err != nil {
+		respondInternalError(c, err)
+		return Review{}, false
+	}
+	return review, true
+}
+
+// lockBookForRating ล็อกแถวของหนังสือ ให้การคำนวณ rating ของ transaction
+// ที่เขียน review เล่มเดียวกันเกิดทีละอัน
+func lockBookForRating(tx *sql.Tx, bookID int) (string, error) {
+	var status string
+	err := tx.QueryRow(
+		"SELECT status FROM books WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", bookID,
+	).Scan(&status)
+	return status, err
+}
+
+// refreshBookRating recomputes books.rating and books.reviews_count from
+// published reviews. Callers must hold the lock from lockBookForRating.
+func refreshBookRating(tx *sql.Tx, bookID int) error {
+	_, err := tx.Exec(
+		`UPDATE books SET
+			rating = COALESCE((SELECT ROUND(AVG(rating), 2) FROM reviews WHERE book_id = $1 AND status = 'published'), 0),
+			reviews_count = (SELECT COUNT(*) FROM reviews WHERE book_id = $1 AND status = 'published')
+		 WHERE id = $1`,
+		bookID,
+	)
+	return err
+}
+
+// @Summary Featured books
+// @Description Published books ranked by Bayesian average rating, so a single 5-star review does not outrank many 4.5-star ones
+// @Tags Books
+// @Produce  json
+// @Param   limit  query  int  false  "Number of books (max 50)"
+// @Success 200  {array}  Book
+// @Router  /books/featured [get]
+func getFeaturedBooks(c *gin.Context) {
+	limit, _, err := parsePage(c, 10, 50)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	// score = (v*R + m*C) / (v + m)
+	// v = จำนวน review, R = rating ของเล่ม, C = ค่าเฉลี่ยทั้งร้าน, m = FEATURED_MIN_REVIEWS
+	minReviews := cfg.Catalog.FeaturedMinReviews
+
+	// อันดับขึ้นกับทั้งหนังสือและค่าเฉลี่ย review ทั้งร้าน
+	lastModified := booksModified(c.Request.Context())
+	if reviewsModified := collectionModified(c.Request.Context(), "reviews"); reviewsModified.After(lastModified) {
+		lastModified = reviewsModified
+	}
+	rows, err := db.Query(
+		`WITH store AS (
+			SELECT COALESCE(AVG(rating), 0) AS mean FROM reviews WHERE status = 'published'
+		)
+		SELECT `+bookColumns+`
+		FROM books, store
+		WHERE deleted_at IS NULL AND status = $1 AND reviews_count > 0
+		ORDER BY (reviews_count * rating + $2 * store.mean) / (reviews_count + $2) DESC, reviews_count DESC
+		LIMIT $3`,
+		statusPublished, minReviews, limit,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	books := []Book{}
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		books = append(books, book)
+	}
+
+	respondCached(c, books, lastModified)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"week13-lab6/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== HTTP Server =====================
+
+// listen opens the TCP or unix socket listener for HTTP_ADDR. A stale
+// socket file left by a previous process is removed first.
+func listen(sc config.Server) (net.Listener, error) {
+	path, ok := strings.CutPrefix(sc.Addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", sc.Addr)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, os.FileMode(sc.SocketFileMode())); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// healthcheckClient returns a client and URL that reach path on this
+// server's own listener, for "./main healthcheck" in a container probe.
+func healthcheckClient(sc config.Server, path string, timeout time.Duration) (*http.Client, string) {
+	transport := &http.Transport{}
+	scheme := "http"
+	if sc.TLS() {
+		scheme = "https"
+		// ต่อเข้า process ตัวเองทาง loopback: certificate ออกให้ชื่อโดเมนจริง จึงไม่ตรวจ
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	host := sc.Addr
+	if socket, ok := strings.CutPrefix(sc.Addr, "unix:"); ok {
+		host = "localhost"
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+	} else if h, port, err := net.SplitHostPort(sc.Addr); err == nil {
+		if ip := net.ParseIP(h); h == "" || (ip != nil && ip.IsUnspecified()) {
+			h = "localhost"
+		}
+		host = net.JoinHostPort(h, port)
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, scheme + "://" + host + path
+}
+
+// bulkTransfer replaces the server's read and write deadlines with
+// HTTP_BULK_TIMEOUT for routes that stream large bodies, which would
+// otherwise be cut off by HTTP_READ_TIMEOUT/HTTP_WRITE_TIMEOUT. It must
+// run before middleware that wraps c.Writer.
+func bulkTransfer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var deadline time.Time // zero = ไม่มี deadline
+		if d := cfg.Server.BulkTimeout; d > 0 {
+			deadline = time.Now().Add(d)
+		}
+		rc := http.NewResponseController(c.Writer)
+		if err := rc.SetReadDeadline(deadline); err != nil {
+			slog.WarnContext(c.Request.Context(), "could not extend the read deadline", "error", err)
+		}
+		if err := rc.SetWriteDeadline(deadline); err != nil {
+			slog.WarnContext(c.Request.Context(), "could not extend the write deadline", "error", err)
+		}
+		c.Next()
+	}
+}
+
+// backgroundJobs runs the periodic jobs so shutdown can stop them and wait
+// for a run in progress before the database is closed.
+type backgroundJobs struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newBackgroundJobs() *backgroundJobs {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &backgroundJobs{ctx: ctx, cancel: cancel}
+}
+
+// Go starts run; run returns once its context is cancelled.
+func (j *backgroundJobs) Go(run func(ctx context.Context)) {
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		run(j.ctx)
+	}()
+}
+
+// Stop cancels the jobs and waits until they return or ctx is done.
+func (j *backgroundJobs) Stop(ctx context.Context) error {
+	j.cancel()
+	done := make(chan struct{})
+	go func() {
+		j.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runEvery calls fn now and then every interval until ctx is cancelled.
+func runEvery(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// certReloader serves the certificate in certFile/keyFile and loads it
+// again when either file's modification time changes, so renewed
+// certificates (e.g. from certbot) are picked up without a restart.
+type certReloader struct {
+	certFile, keyFile string
+	interval          time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(certFile, keyFile string, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// latestModTime returns the newer modification time of the two files.
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.checkedAt = time.Now()
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. If reloading fails
+// the previous certificate is kept.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.interval > 0 && time.Since(r.checkedAt) >= r.interval {
+		r.checkedAt = time.Now()
+		if modTime, err := r.latestModTime(); err != nil {
+			slog.Error("error checking tls certificate", "error", err)
+		} else if !modTime.Equal(r.modTime) {
+			if err := r.reload(); err != nil {
+				slog.Error("error reloading tls certificate", "error", err)
+			} else {
+				slog.Info("reloaded tls certificate", "cert_file", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// runServer serves handler until SIGINT/SIGTERM, then fails /readyz for
+// SHUTDOWN_DELAY, stops accepting new connections and waits up to
+// SHUTDOWN_TIMEOUT for in-flight requests.
+func runServer(handler http.Handler) error {
+	sc := cfg.Server
+	srv := &http.Server{
+		Handler:           handler,
+		ReadTimeout:       sc.ReadTimeout,
+		ReadHeaderTimeout: sc.ReadHeaderTimeout,
+		WriteTimeout:      sc.WriteTimeout,
+		IdleTimeout:       sc.IdleTimeout,
+		MaxHeaderBytes:    sc.MaxHeaderBytes,
+		ErrorLog:          stdLogger(slog.LevelWarn),
+	}
+
+	useTLS := sc.TLS()
+	if useTLS {
+		certs, err := newCertReloader(sc.TLSCertFile, sc.TLSKeyFile, sc.TLSReloadInterval)
+		if err != nil {
+			return fmt.Errorf("load TLS certificate: %w", err)
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+	}
+
+	ln, err := listen(sc)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", sc.Addr, "tls", useTLS)
+		if useTLS {
+			serveErr <- srv.ServeTLS(ln, "", "")
+		} else {
+			serveErr <- srv.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	stop() // สัญญาณครั้งที่สองจะปิดโปรแกรมทันที
+
+	shuttingDown.Store(true)
+	if sc.ShutdownDelay > 0 {
+		slog.Info("readiness failing, waiting before draining", "delay", sc.ShutdownDelay)
+		time.Sleep(sc.ShutdownDelay)
+	}
+	slog.Info("shutting down, waiting for in-flight requests", "timeout", sc.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), sc.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	return nil
+}
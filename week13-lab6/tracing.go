@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/XSAM/otelsql"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ===================== Tracing =====================
+
+var tracer = otel.Tracer("week13-lab6")
+
+// initTracing installs the tracer provider chosen by OTEL_TRACES_EXPORTER
+// (none, otlp or stdout) and the W3C trace-context propagator. The returned
+// function flushes buffered spans and must run before the process exits.
+func initTracing() func(context.Context) error {
+	// รับ traceparent จาก nginx เสมอ แม้จะไม่ได้ export span เอง
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	tc := cfg.Tracing
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch tc.Exporter {
+	case "none":
+		return func(context.Context) error { return nil }
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpointURL(strings.TrimRight(tc.Endpoint, "/")+"/v1/traces"))
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	}
+	if err != nil {
+		log.Fatal("failed to create trace exporter: ", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(tc.ServiceName),
+		semconv.DeploymentEnvironmentName(cfg.Env),
+	))
+	if err != nil {
+		log.Fatal("failed to build trace resource: ", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(tc.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	slog.Info("tracing enabled", "exporter", tc.Exporter, "service", tc.ServiceName)
+	return tp.Shutdown
+}
+
+// tracingMiddleware starts the server span for each request, named after
+// the route template, continuing any trace context sent by the proxy.
+func tracingMiddleware() gin.HandlerFunc {
+	return otelgin.Middleware(cfg.Tracing.ServiceName,
+		otelgin.WithFilter(func(r *http.Request) bool {
+			// probe/scrape ถี่มาก ไม่ต้อง trace
+			switch r.URL.Path {
+			case "/livez", "/readyz", "/health", "/metrics":
+				return false
+			}
+			return true
+		}),
+	)
+}
+
+// startSpan starts a child span of the request's span and puts it on the
+// request context, so queries made with c.Request.Context() nest under it.
+// The returned func ends the span and restores the parent; middleware calls
+// it before c.Next() so the span covers only its own work.
+func startSpan(c *gin.Context, name string, attrs ...attribute.KeyValue) func() {
+	parent := c.Request.Context()
+	ctx, span := tracer.Start(parent, name, trace.WithAttributes(attrs...))
+	c.Request = c.Request.WithContext(ctx)
+	return func() {
+		span.End()
+		c.Request = c.Request.WithContext(parent)
+	}
+}
+
+// handlerSpanMiddleware wraps each matched route (its own middleware such
+// as auth and permission checks, and the handler) in a span named after
+// the handler function, so every route gets one, not only those behind
+// requirePermission. It is registered last so it nests under the server
+// span; unmatched paths and untraced requests (probes) are skipped. It
+// also overwrites the server span's url.path, which otelgin records before
+// routing, with the masked path so share tokens don't reach the collector.
+func handlerSpanMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.FullPath() == "" || !trace.SpanContextFromContext(c.Request.Context()).IsValid() {
+			c.Next()
+			return
+		}
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(semconv.URLPath(redactPath(c)))
+		end := startSpan(c, "handler "+handlerSpanName(c.HandlerName()),
+			attribute.String("gin.handler", c.HandlerName()),
+			attribute.String("http.route", c.FullPath()),
+		)
+		defer end()
+		c.Next()
+	}
+}
+
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+
+// handlerSpanName shortens "week13-lab6.orderTransitionHandler.func1" to
+// "orderTransitionHandler": handlers built by a constructor are closures.
+func handlerSpanName(handler string) string {
+	name := closureSuffix.ReplaceAllString(handler, "")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// ===================== SQL Tracing =====================
+
+var (
+	sqlStringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	sqlNumericLiteral = regexp.MustCompile(`([^\w$.])\d+(?:\.\d+)?\b`)
+	sqlWhitespace     = regexp.MustCompile(`\s+`)
+)
+
+const maxTracedStatement = 2048
+
+// sanitizeSQL removes literal values from a statement before it is put on
+// a span. Bind parameters ($1, $2, ...) are kept; their values are never
+// recorded.
+func sanitizeSQL(query string) string {
+	query = sqlStringLiteral.ReplaceAllString(query, "'?'")
+	query = sqlNumericLiteral.ReplaceAllString(query, "${1}?")
+	query = strings.TrimSpace(sqlWhitespace.ReplaceAllString(query, " "))
+	if len(query) > maxTracedStatement {
+		query = query[:maxTracedStatement] + "..."
+	}
+	return query
+}
+
+// openTracedDB opens Postgres through otelsql. Spans are created only for
+// queries made with a context that already carries a span, so background
+// jobs and context-less calls do not produce orphan traces.
+func openTracedDB(dsn string) (*sql.DB, error) {
+	conn, err := otelsql.Open("postgres", dsn,
+		otelsql.WithAttributes(semconv.DBSystemNamePostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableQuery:         true, // ใส่ statement ที่ผ่าน sanitizeSQL แทน
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+				return trace.SpanContextFromContext(ctx).IsValid()
+			},
+		}),
+		otelsql.WithAttributesGetter(func(_ context.Context, _ otelsql.Method, query string, _ []driver.NamedValue) []attribute.KeyValue {
+			if query == "" {
+				return nil
+			}
+			return []attribute.KeyValue{semconv.DBQueryText(sanitizeSQL(query))}
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("open traced database: %w", err)
+	}
+	return conn, nil
+}
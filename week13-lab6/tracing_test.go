@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeSQL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"SELECT * FROM books WHERE id = $1", "SELECT * FROM books WHERE id = $1"},
+		{"SELECT * FROM books WHERE title = 'Go''s Way' AND year > 2000", "SELECT * FROM books WHERE title = '?' AND year > ?"},
+		{"UPDATE stock SET on_hand = on_hand - 3.5 WHERE id=42", "UPDATE stock SET on_hand = on_hand - ? WHERE id=?"},
+		{"SELECT col1, t2.x FROM t2", "SELECT col1, t2.x FROM t2"},
+		{"SELECT rate::numeric(18,8) FROM fx_rates", "SELECT rate::numeric(?,?) FROM fx_rates"},
+		{"SELECT 'a', 'b' LIMIT 10 OFFSET $2", "SELECT '?', '?' LIMIT ? OFFSET $2"},
+		{"SELECT\n\t  id\n  FROM   users\n", "SELECT id FROM users"},
+		{"INSERT INTO t (token) VALUES ('eyJhbGciOi.secret')", "INSERT INTO t (token) VALUES ('?')"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeSQL(tt.in); got != tt.want {
+			t.Errorf("sanitizeSQL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	long := "SELECT " + strings.Repeat("x", 3000)
+	if got := sanitizeSQL(long); len(got) != maxTracedStatement+3 || !strings.HasSuffix(got, "...") {
+		t.Errorf("sanitizeSQL of a %d-byte statement is %d bytes", len(long), len(got))
+	}
+}
+
+func TestHandlerSpanName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"week13-lab6.getAllBooks", "getAllBooks"},
+		{"main.getAllBooks", "getAllBooks"},
+		{"week13-lab6.orderTransitionHandler.func1", "orderTransitionHandler"},
+	}
+	for _, tt := range tests {
+		if got := handlerSpanName(tt.in); got != tt.want {
+			t.Errorf("handlerSpanName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== Trash (Soft Delete) =====================
+
+func getTrashedBooks(c *gin.Context) {
+	rows, err := db.Query("SELECT " + bookColumns + " FROM books WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC")
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "error listing trash", "error", err)
+		respondProblem(c, http.StatusInternalServerError, codeInternal, "")
+		return
+	}
+	defer rows.Close()
+
+	books := []Book{}
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "error scanning trashed book", "error", err)
+			continue
+		}
+		books = append(books, book)
+	}
+
+	c.JSON(http.StatusOK, books)
+}
+
+func restoreBook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+
+	result, err := db.Exec("UPDATE books SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	if isUniqueViolation(err) {
+		// มีหนังสือ ISBN เดียวกันที่ยังใช้งานอยู่
+		respondProblem(c, http.StatusConflict, codeConflict, "another active book has the same isbn")
+		return
+	} else if err != nil {
+		slog.ErrorContext(c.Request.Context(), "error restoring book", "error", err)
+		respondProblem(c, http.StatusInternalServerError, codeInternal, "")
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found in trash")
+		return
+	}
+
+	bookCache.invalidate(id)
+	bookChangesTotal.WithLabelValues("restored").Inc()
+
+	// Log audit
+	userID := c.GetInt("user_id")
+	logAudit(userID, "restore", "books", id, nil, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "book restored successfully"})
+}
+
+// purgeBook ลบถาวร ได้เฉพาะหนังสือที่อยู่ในถังขยะแล้ว
+func purgeBook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+
+	var title string
+	var cover purgedCover
+	err = db.QueryRow(
+		"DELETE FROM books b WHERE id = $1 AND deleted_at IS NOT NULL RETURNING title, "+purgedCoverColumns, id,
+	).Scan(&title, &cover.hash, &cover.contentType)
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found in trash")
+		return
+	} else if err != nil {
+		slog.ErrorContext(c.Request.Context(), "error purging book", "error", err)
+		respondProblem(c, http.StatusInternalServerError, codeInternal, "")
+		return
+	}
+
+	cover.delete(id)
+	bookChangesTotal.WithLabelValues("purged").Inc()
+
+	// Log audit (เก็บ title ไว้ใน details เพราะแถวถูกลบไปแล้ว)
+	userID := c.GetInt("user_id")
+	logAudit(userID, "purge", "books", id, gin.H{
+		"title": title,
+	}, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "book permanently deleted"})
+}
+
+// runTrashPurger hard-deletes books that have been in the trash longer than
+// TRASH_RETENTION (default 30 days). It runs until ctx is cancelled at shutdown.
+func runTrashPurger(ctx context.Context) {
+	retention := cfg.Catalog.TrashRetention
+	runEvery(ctx, time.Hour, func() { purgeExpiredTrash(retention) })
+}
+
+func purgeExpiredTrash(retention time.Duration) {
+	cutoff := time.Now().Add(-retention)
+
+	rows, err := db.Query(
+		"DELETE FROM books b WHERE deleted_at IS NOT NULL AND deleted_at < $1 RETURNING id, "+purgedCoverColumns, cutoff,
+	)
+	if err != nil {
+		slog.Error("error purging trash", "error", err)
+		return
+	}
+	defer rows.Close()
+
+	purged := 0
+	for rows.Next() {
+		var id int
+		var cover purgedCover
+		if err := rows.Scan(&id, &cover.hash, &cover.contentType); err == nil {
+			bookCache.invalidate(id)
+			cover.delete(id)
+			purged++
+		}
+	}
+
+	if purged > 0 {
+		bookChangesTotal.WithLabelValues("purged").Add(float64(purged))
+		slog.Info("purged trash", "books", purged, "retention", retention)
+	}
+}
+
+// purgedCoverColumns reads a book's cover in RETURNING, before the
+// ON DELETE CASCADE removes the book_covers row.
+const purgedCoverColumns = `
+	COALESCE((SELECT hash FROM book_covers WHERE book_id = b.id), ''),
+	COALESCE((SELECT content_type FROM book_covers WHERE book_id = b.id), '')`
+
+type purgedCover struct {
+	hash, contentType string
+}
+
+// delete removes the purged book's cover blobs in the background.
+func (pc purgedCover) delete(bookID int) {
+	if pc.hash != "" {
+		go deleteCoverBlobs(bookID, pc.hash, pc.contentType)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"week13-lab6/isbn"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// ===================== Request Validation =====================
+
+// Field-level error codes returned inside Problem.Errors.
+const (
+	fieldRequired      = "required"
+	fieldTooShort      = "too_short"
+	fieldTooLong       = "too_long"
+	fieldOutOfRange    = "out_of_range"
+	fieldInvalidFormat = "invalid_format"
+	fieldInvalidISBN   = "invalid_isbn"
+	fieldInvalidURL    = "invalid_url"
+	fieldInvalidType   = "invalid_type"
+	fieldDuplicate     = "duplicate"
+	fieldNotFound      = "not_found"
+)
+
+// initValidation registers the custom rules used in binding tags and makes
+// validator report JSON field names instead of Go struct field names.
+func initValidation() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	v.RegisterValidation("isbn_any", func(fl validator.FieldLevel) bool {
+		return isbn.IsValid(fl.Field().String())
+	})
+
+	// ปีที่พิมพ์ต้องไม่เก่ากว่าแท่นพิมพ์ และไม่เกินปีหน้า
+	v.RegisterValidation("book_year", func(fl validator.FieldLevel) bool {
+		year := int(fl.Field().Int())
+		return year >= minBookYear && year <= time.Now().Year()+1
+	})
+}
+
+// bindJSON binds the request body into obj. On failure it writes a
+// validation problem and returns false.
+func bindJSON(c *gin.Context, obj interface{}) bool {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return true
+	}
+	respondBindError(c, err)
+	return false
+}
+
+// bindOptionalJSON is bindJSON for endpoints whose body may be left out.
+// A missing or empty body leaves obj at its zero value. The body is read
+// whenever one is present, not only when ContentLength > 0, so chunked
+// requests (ContentLength -1) are not silently ignored.
+func bindOptionalJSON(c *gin.Context, obj interface{}) bool {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return true
+	}
+	err := c.ShouldBindJSON(obj)
+	if err == nil || errors.Is(err, io.EOF) { // io.EOF = body ว่าง
+		return true
+	}
+	respondBindError(c, err)
+	return false
+}
+
+func respondBindError(c *gin.Context, err error) {
+	var verrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+
+	switch {
+	case errors.As(err, &verrs):
+		respondValidation(c, fieldErrorsFrom(verrs))
+	case errors.As(err, &typeErr):
+		respondValidation(c, []FieldError{{
+			Field:   typeErr.Field,
+			Code:    fieldInvalidType,
+			Message: fmt.Sprintf("must be of type %s", jsonTypeName(typeErr.Type)),
+		}})
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		respondProblem(c, http.StatusBadRequest, codeMalformedJSON, "request body is not valid JSON")
+	default:
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid request body")
+	}
+}
+
+func fieldErrorsFrom(verrs validator.ValidationErrors) []FieldError {
+	out := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		field := fe.Field()
+		if ns := fe.Namespace(); strings.Contains(ns, ".") {
+			// ตัดชื่อ struct ตัวนอกสุดออก เหลือ path แบบ JSON เช่น items[0].quantity
+			field = ns[strings.Index(ns, ".")+1:]
+		}
+		code, msg := describeFieldError(fe)
+		out = append(out, FieldError{Field: field, Code: code, Message: msg})
+	}
+	return out
+}
+
+func describeFieldError(fe validator.FieldError) (string, string) {
+	switch fe.Tag() {
+	case "required":
+		return fieldRequired, "is required"
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fieldTooLong, fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return fieldOutOfRange, fmt.Sprintf("must be at most %s", fe.Param())
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fieldTooShort, fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return fieldOutOfRange, fmt.Sprintf("must be at least %s", fe.Param())
+	case "gte":
+		return fieldOutOfRange, fmt.Sprintf("must be greater than or equal to %s", fe.Param())
+	case "lte":
+		return fieldOutOfRange, fmt.Sprintf("must be less than or equal to %s", fe.Param())
+	case "gt":
+		return fieldOutOfRange, fmt.Sprintf("must be greater than %s", fe.Param())
+	case "unique":
+		return fieldDuplicate, "must not contain duplicates"
+	case "oneof":
+		return fieldInvalidFormat, fmt.Sprintf("must be one of: %s", fe.Param())
+	case "book_year":
+		return fieldOutOfRange, fmt.Sprintf("must be between %d and %d", minBookYear, time.Now().Year()+1)
+	case "isbn_any":
+		return fieldInvalidISBN, "must be a valid ISBN-10 or ISBN-13"
+	case "url", "http_url":
+		return fieldInvalidURL, "must be an http or https URL"
+	case "email":
+		return fieldInvalidFormat, "must be a valid email address"
+	case "len":
+		return fieldInvalidFormat, fmt.Sprintf("must be exactly %s characters", fe.Param())
+	case "numeric":
+		return fieldInvalidFormat, "must be a decimal number"
+	case "alphanum":
+		return fieldInvalidFormat, "must contain only letters and digits"
+	}
+	return fieldInvalidFormat, fmt.Sprintf("failed the %q rule", fe.Tag())
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "object"
+}
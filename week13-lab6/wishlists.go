@@ -0,0 +1,941 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"week13-lab6/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// ===================== Wishlists & Reading Lists =====================
+
+const (
+	visibilityPrivate  = "private"
+	visibilityUnlisted = "unlisted" // เข้าถึงได้ด้วยลิงก์ share เท่านั้น
+	visibilityPublic   = "public"
+
+	maxWishlistItems = 500
+
+	alertDiscounted  = "discounted"
+	alertBackInStock = "back_in_stock"
+)
+
+type Wishlist struct {
+	ID          int       `json:"id"`
+	UserID      int       `json:"user_id"`
+	Owner       string    `json:"owner"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Visibility  string    `json:"visibility"`
+	ShareURL    string    `json:"share_url,omitempty"` // เฉพาะเจ้าของ และ list ที่ไม่ใช่ private
+	ItemCount   int       `json:"item_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	shareToken string
+}
+
+// WishlistDetail is a list with its items priced in Currency.
+type WishlistDetail struct {
+	Wishlist
+	Currency string         `json:"currency"`
+	Items    []WishlistItem `json:"items"`
+}
+
+type WishlistItem struct {
+	BookID     int         `json:"book_id"`
+	Position   int         `json:"position"`
+	Title      string      `json:"title"`
+	Author     string      `json:"author"`
+	ISBN       string      `json:"isbn"`
+	CoverImage string      `json:"cover_image"`
+	Note       string      `json:"note"`
+	Notify     bool        `json:"notify"`
+	ListPrice  money.Money `json:"list_price"`
+	Price      money.Money `json:"price"`
+	Savings    money.Money `json:"savings"` // list_price - price
+	Discount   int         `json:"discount"`
+	InStock    bool        `json:"in_stock"`
+	// false เมื่อหนังสือเลิกขายหลังจากเพิ่มเข้า list
+	Available bool      `json:"available"`
+	AddedAt   time.Time `json:"added_at"`
+}
+
+// WishlistAlert tells the owner that a watched book got cheaper or came
+// back in stock. Prices are in the base currency.
+type WishlistAlert struct {
+	ID            int          `json:"id"`
+	WishlistID    int          `json:"wishlist_id"`
+	BookID        int          `json:"book_id"`
+	Title         string       `json:"title"`
+	Kind          string       `json:"kind"`
+	PreviousPrice *money.Money `json:"previous_price,omitempty"`
+	Price         money.Money  `json:"price"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ReadAt        *time.Time   `json:"read_at,omitempty"`
+}
+
+type WishlistRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description" binding:"max=2000"`
+	Visibility  string `json:"visibility" binding:"omitempty,oneof=private unlisted public"` // ไม่ส่ง = private
+}
+
+type AddWishlistItemRequest struct {
+	BookID int    `json:"book_id" binding:"required,gt=0"`
+	Note   string `json:"note" binding:"max=500"`
+	Notify bool   `json:"notify"`
+}
+
+type UpdateWishlistItemRequest struct {
+	Note   *string `json:"note" binding:"omitempty,max=500"`
+	Notify *bool   `json:"notify"`
+}
+
+type ReorderWishlistRequest struct {
+	BookIDs []int64 `json:"book_ids" binding:"required,min=1,max=500,unique,dive,gt=0"`
+}
+
+const wishlistColumns = `w.id, w.user_id, u.username, w.name, w.description, w.visibility, w.share_token,
+	(SELECT COUNT(*) FROM wishlist_items wi WHERE wi.wishlist_id = w.id), w.created_at, w.updated_at`
+
+// publicWishlistColumns is wishlistColumns for other users' views, which
+// leave out books that are drafts or in the trash.
+const publicWishlistColumns = `w.id, w.user_id, u.username, w.name, w.description, w.visibility, w.share_token,
+	(SELECT COUNT(*) FROM wishlist_items wi JOIN books b ON b.id = wi.book_id
+	 WHERE wi.wishlist_id = w.id AND b.deleted_at IS NULL AND b.status = 'published'), w.created_at, w.updated_at`
+
+const wishlistFrom = " FROM wishlists w JOIN users u ON u.id = w.user_id"
+
+func scanWishlist(row rowScanner) (Wishlist, error) {
+	var w Wishlist
+	err := row.Scan(&w.ID, &w.UserID, &w.Owner, &w.Name, &w.Description, &w.Visibility, &w.shareToken,
+		&w.ItemCount, &w.CreatedAt, &w.UpdatedAt)
+	return w, err
+}
+
+// forViewer hides the share link from everyone but the owner.
+func (w Wishlist) forViewer(userID int) Wishlist {
+	w.ShareURL = ""
+	if w.UserID == userID && w.Visibility != visibilityPrivate {
+		w.ShareURL = publicBaseURL + "/shared/wishlists/" + w.shareToken
+	}
+	return w
+}
+
+// loadOwnedWishlist reads :id and responds 404 unless the caller owns it.
+func loadOwnedWishlist(c *gin.Context) (Wishlist, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid wishlist id")
+		return Wishlist{}, false
+	}
+
+	w, err := scanWishlist(db.QueryRow(
+		"SELECT "+wishlistColumns+wishlistFrom+" WHERE w.id = $1 AND w.user_id = $2", id, c.GetInt("user_id"),
+	))
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "wishlist not found")
+		return Wishlist{}, false
+	} else if err != nil {
+		respondInternalError(c, err)
+		return Wishlist{}, false
+	}
+	return w, true
+}
+
+// loadWishlistItems reads the items in list order, priced in pc. Only the
+// owner sees items whose book is unpublished or in the trash (as
+// unavailable); for anyone else they are left out.
+func loadWishlistItems(wishlistID int, pc priceContext, owner bool) ([]WishlistItem, error) {
+	filter := ""
+	if !owner {
+		filter = " AND b.deleted_at IS NULL AND b.status = $2"
+	}
+	rows, err := db.Query(
+		`SELECT b.id, wi.position, b.title, b.author, b.isbn, b.cover_image, wi.note, wi.notify, wi.added_at,
+		        `+bookPriceColumns("$3")+`,
+		        COALESCE(s.on_hand > s.reserved, false),
+		        b.deleted_at IS NULL AND b.status = $2
+		 FROM wishlist_items wi
+		 JOIN books b ON b.id = wi.book_id
+		 LEFT JOIN stock s ON s.book_id = b.id
+		 WHERE wi.wishlist_id = $1`+filter+`
+		 ORDER BY wi.position, wi.added_at`,
+		wishlistID, statusPublished, pc.Currency,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []WishlistItem{}
+	for rows.Next() {
+		var it WishlistItem
+		var price int64
+		var originalPrice, listed *int64
+		err := rows.Scan(
+			&it.BookID, &it.Position, &it.Title, &it.Author, &it.ISBN, &it.CoverImage, &it.Note, &it.Notify, &it.AddedAt,
+			&price, &originalPrice, &it.Discount, &listed, &it.InStock, &it.Available,
+		)
+		if err != nil {
+			return nil, err
+		}
+		it.ListPrice, it.Price = pc.bookPrices(price, originalPrice, it.Discount, listed)
+		it.Savings = it.ListPrice.Sub(it.Price)
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// respondWishlist writes w with its items, priced in ?currency= (default THB).
+func respondWishlist(c *gin.Context, w Wishlist, status int) {
+	pc, ok := priceContextFromQuery(c)
+	if !ok {
+		return
+	}
+	userID := c.GetInt("user_id")
+	owner := w.UserID == userID
+	items, err := loadWishlistItems(w.ID, pc, owner)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if !owner {
+		w.ItemCount = len(items)
+	}
+	c.JSON(status, WishlistDetail{
+		Wishlist: w.forViewer(userID),
+		Currency: pc.Currency,
+		Items:    items,
+	})
+}
+
+func touchWishlist(q queryer, id int) error {
+	_, err := q.Exec("UPDATE wishlists SET updated_at = NOW() WHERE id = $1", id)
+	return err
+}
+
+func respondDuplicateWishlist(c *gin.Context, name string) {
+	respondProblem(c, http.StatusConflict, codeConflict, fmt.Sprintf("you already have a list named %q", name))
+}
+
+// ===================== Wishlist Handlers =====================
+
+// @Summary List my wishlists
+// @Tags Wishlists
+// @Produce  json
+// @Success 200  {array}  Wishlist
+// @Router  /wishlists [get]
+func getMyWishlists(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	rows, err := db.Query("SELECT "+wishlistColumns+wishlistFrom+" WHERE w.user_id = $1 ORDER BY w.created_at, w.id", userID)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	lists := []Wishlist{}
+	for rows.Next() {
+		w, err := scanWishlist(rows)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		lists = append(lists, w.forViewer(userID))
+	}
+	if err := rows.Err(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, lists)
+}
+
+// @Summary Browse public wishlists
+// @Tags Wishlists
+// @Produce  json
+// @Param   user_id  query  int  false  "Only lists of this user"
+// @Param   limit    query  int  false  "Page size (default 20, max 100)"
+// @Param   offset   query  int  false  "Offset"
+// @Success 200  {array}  Wishlist
+// @Router  /wishlists/public [get]
+func getPublicWishlists(c *gin.Context) {
+	limit, offset, err := parsePage(c, 20, 100)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	query := "SELECT " + publicWishlistColumns + wishlistFrom + " WHERE w.visibility = $1"
+	args := []interface{}{visibilityPublic}
+	if v := c.Query("user_id"); v != "" {
+		ownerID, err := strconv.Atoi(v)
+		if err != nil {
+			respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid user_id")
+			return
+		}
+		query += " AND w.user_id = $2"
+		args = append(args, ownerID)
+	}
+	query += fmt.Sprintf(" ORDER BY w.updated_at DESC, w.id DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+
+	// item_count นับเฉพาะหนังสือที่เผยแพร่อยู่ จึงขึ้นกับ books ด้วย
+	lastModified := collectionModified(c.Request.Context(), "wishlists", "wishlist_items", "books")
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	userID := c.GetInt("user_id")
+	lists := []Wishlist{}
+	for rows.Next() {
+		w, err := scanWishlist(rows)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		lists = append(lists, w.forViewer(userID))
+	}
+	if err := rows.Err(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	respondCached(c, lists, lastModified)
+}
+
+// @Summary Get a wishlist with current prices
+// @Description The owner can read any of their lists; other users only public ones
+// @Tags Wishlists
+// @Produce  json
+// @Param   id        path   int     true   "Wishlist ID"
+// @Param   currency  query  string  false  "Price items in this currency (default THB)"
+// @Success 200  {object}  WishlistDetail
+// @Failure 404  {object}  Problem
+// @Router  /wishlists/{id} [get]
+func getWishlist(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid wishlist id")
+		return
+	}
+
+	w, err := scanWishlist(db.QueryRow("SELECT "+wishlistColumns+wishlistFrom+" WHERE w.id = $1", id))
+	if err == nil && w.UserID != c.GetInt("user_id") && w.Visibility != visibilityPublic {
+		err = sql.ErrNoRows // ไม่บอกว่า list ส่วนตัวของคนอื่นมีอยู่จริง
+	}
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "wishlist not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	respondWishlist(c, w, http.StatusOK)
+}
+
+// getSharedWishlist serves unlisted and public lists by share token,
+// without authentication.
+func getSharedWishlist(c *gin.Context) {
+	w, err := scanWishlist(db.QueryRow(
+		"SELECT "+wishlistColumns+wishlistFrom+" WHERE w.share_token = $1 AND w.visibility <> $2",
+		c.Param("token"), visibilityPrivate,
+	))
+	if err == sql.ErrNoRows {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "wishlist not found")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	respondWishlist(c, w, http.StatusOK)
+}
+
+// @Summary Create a wishlist
+// @Tags Wishlists
+// @Accept  json
+// @Produce  json
+// @Param   body  body  WishlistRequest  true  "List"
+// @Success 201  {object}  WishlistDetail
+// @Failure 409  {object}  Problem
+// @Router  /wishlists [post]
+func createWishlist(c *gin.Context) {
+	var req WishlistRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Visibility == "" {
+		req.Visibility = visibilityPrivate
+	}
+
+	token, err := newRandomToken()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	var id int
+	err = db.QueryRow(
+		`INSERT INTO wishlists (user_id, name, description, visibility, share_token)
+		 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		userID, req.Name, req.Description, req.Visibility, token,
+	).Scan(&id)
+	if isUniqueViolation(err) {
+		respondDuplicateWishlist(c, req.Name)
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	w, err := scanWishlist(db.QueryRow("SELECT "+wishlistColumns+wishlistFrom+" WHERE w.id = $1", id))
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	logAudit(userID, "create", "wishlists", id, gin.H{
+		"name":       req.Name,
+		"visibility": req.Visibility,
+	}, c)
+
+	respondWishlist(c, w, http.StatusCreated)
+}
+
+// @Summary Update a wishlist's name, description or visibility
+// @Tags Wishlists
+// @Accept  json
+// @Produce  json
+// @Param   id    path  int              true  "Wishlist ID"
+// @Param   body  body  WishlistRequest  true  "List"
+// @Success 200  {object}  WishlistDetail
+// @Router  /wishlists/{id} [put]
+func updateWishlist(c *gin.Context) {
+	w, ok := loadOwnedWishlist(c)
+	if !ok {
+		return
+	}
+	var req WishlistRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Visibility == "" {
+		req.Visibility = visibilityPrivate
+	}
+
+	_, err := db.Exec(
+		"UPDATE wishlists SET name = $1, description = $2, visibility = $3 WHERE id = $4",
+		req.Name, req.Description, req.Visibility, w.ID,
+	)
+	if isUniqueViolation(err) {
+		respondDuplicateWishlist(c, req.Name)
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	logAudit(userID, "update", "wishlists", w.ID, gin.H{
+		"name":       req.Name,
+		"visibility": req.Visibility,
+	}, c)
+
+	w, ok = loadOwnedWishlist(c)
+	if !ok {
+		return
+	}
+	respondWishlist(c, w, http.StatusOK)
+}
+
+// rotateWishlistShareLink invalidates the old share link, e.g. after an
+// unlisted link was passed around further than intended.
+func rotateWishlistShareLink(c *gin.Context) {
+	w, ok := loadOwnedWishlist(c)
+	if !ok {
+		return
+	}
+	token, err := newRandomToken()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if _, err := db.Exec("UPDATE wishlists SET share_token = $1 WHERE id = $2", token, w.ID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	w.shareToken = token
+
+	respondWishlist(c, w, http.StatusOK)
+}
+
+// @Summary Delete a wishlist
+// @Tags Wishlists
+// @Param   id  path  int  true  "Wishlist ID"
+// @Success 200  {object}  map[string]string
+// @Router  /wishlists/{id} [delete]
+func deleteWishlist(c *gin.Context) {
+	w, ok := loadOwnedWishlist(c)
+	if !ok {
+		return
+	}
+	if _, err := db.Exec("DELETE FROM wishlists WHERE id = $1", w.ID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	logAudit(userID, "delete", "wishlists", w.ID, gin.H{
+		"name":       w.Name,
+		"item_count": w.ItemCount,
+	}, c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "wishlist deleted successfully"})
+}
+
+// @Summary Add a book to a wishlist
+// @Description notify=true raises an alert when the book gets cheaper or comes back in stock
+// @Tags Wishlists
+// @Accept  json
+// @Produce  json
+// @Param   id    path  int                     true  "Wishlist ID"
+// @Param   body  body  AddWishlistItemRequest  true  "Item"
+// @Success 201  {object}  WishlistDetail
+// @Failure 409  {object}  Problem
+// @Router  /wishlists/{id}/items [post]
+func addWishlistItem(c *gin.Context) {
+	w, ok := loadOwnedWishlist(c)
+	if !ok {
+		return
+	}
+	var req AddWishlistItemRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	var exists bool
+	err := db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM books WHERE id = $1 AND deleted_at IS NULL AND status = $2)",
+		req.BookID, statusPublished,
+	).Scan(&exists)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if !exists {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book not found")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// ล็อก list กันการเพิ่มพร้อมกันจนเกินจำนวนสูงสุดหรือได้ position ซ้ำ
+	var count, next int
+	if _, err := tx.Exec("SELECT 1 FROM wishlists WHERE id = $1 FOR UPDATE", w.ID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	err = tx.QueryRow(
+		"SELECT COUNT(*), COALESCE(MAX(position), 0) + 1 FROM wishlist_items WHERE wishlist_id = $1", w.ID,
+	).Scan(&count, &next)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if count >= maxWishlistItems {
+		respondProblem(c, http.StatusConflict, codeConflict, fmt.Sprintf("a list can hold at most %d books", maxWishlistItems))
+		return
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO wishlist_items (wishlist_id, book_id, position, note, notify) VALUES ($1, $2, $3, $4, $5)",
+		w.ID, req.BookID, next, req.Note, req.Notify,
+	)
+	if isUniqueViolation(err) {
+		respondProblem(c, http.StatusConflict, codeConflict, "book is already in this list")
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := touchWishlist(tx, w.ID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	w.ItemCount++
+	respondWishlist(c, w, http.StatusCreated)
+}
+
+// @Summary Update an item's note or notify flag
+// @Tags Wishlists
+// @Accept  json
+// @Produce  json
+// @Param   id       path  int                        true  "Wishlist ID"
+// @Param   book_id  path  int                        true  "Book ID"
+// @Param   body     body  UpdateWishlistItemRequest  true  "Fields to change"
+// @Success 200  {object}  WishlistDetail
+// @Router  /wishlists/{id}/items/{book_id} [put]
+func updateWishlistItem(c *gin.Context) {
+	w, ok := loadOwnedWishlist(c)
+	if !ok {
+		return
+	}
+	bookID, err := strconv.Atoi(c.Param("book_id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+	var req UpdateWishlistItemRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	// เปิด notify ใหม่ = เริ่ม baseline ใหม่ ไม่แจ้งเตือนจากการเปลี่ยนแปลงระหว่างที่ปิดอยู่
+	result, err := db.Exec(
+		`UPDATE wishlist_items SET
+			note = COALESCE($3, note),
+			notify = COALESCE($4, notify),
+			seen_price_minor = CASE WHEN $4 AND NOT notify THEN NULL ELSE seen_price_minor END,
+			seen_in_stock = CASE WHEN $4 AND NOT notify THEN NULL ELSE seen_in_stock END
+		 WHERE wishlist_id = $1 AND book_id = $2`,
+		w.ID, bookID, req.Note, req.Notify,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book is not in this list")
+		return
+	}
+	touchWishlist(db, w.ID)
+
+	respondWishlist(c, w, http.StatusOK)
+}
+
+// @Summary Remove a book from a wishlist
+// @Tags Wishlists
+// @Produce  json
+// @Param   id       path  int  true  "Wishlist ID"
+// @Param   book_id  path  int  true  "Book ID"
+// @Success 200  {object}  WishlistDetail
+// @Router  /wishlists/{id}/items/{book_id} [delete]
+func removeWishlistItem(c *gin.Context) {
+	w, ok := loadOwnedWishlist(c)
+	if !ok {
+		return
+	}
+	bookID, err := strconv.Atoi(c.Param("book_id"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid book id")
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM wishlist_items WHERE wishlist_id = $1 AND book_id = $2", w.ID, bookID)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "book is not in this list")
+		return
+	}
+	touchWishlist(db, w.ID)
+
+	w.ItemCount--
+	respondWishlist(c, w, http.StatusOK)
+}
+
+// @Summary Reorder a wishlist
+// @Description book_ids must list every book in the list exactly once, in the new order
+// @Tags Wishlists
+// @Accept  json
+// @Produce  json
+// @Param   id    path  int                     true  "Wishlist ID"
+// @Param   body  body  ReorderWishlistRequest  true  "New order"
+// @Success 200  {object}  WishlistDetail
+// @Failure 422  {object}  Problem
+// @Router  /wishlists/{id}/order [put]
+func reorderWishlist(c *gin.Context) {
+	w, ok := loadOwnedWishlist(c)
+	if !ok {
+		return
+	}
+	var req ReorderWishlistRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT 1 FROM wishlists WHERE id = $1 FOR UPDATE", w.ID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	// ต้องเป็น permutation ของหนังสือใน list พอดี (ไม่ขาด ไม่เกิน)
+	var matched int
+	err = tx.QueryRow(
+		`SELECT COUNT(*) FILTER (WHERE book_id = ANY($2)), COUNT(*) FROM wishlist_items WHERE wishlist_id = $1`,
+		w.ID, pq.Int64Array(req.BookIDs),
+	).Scan(&matched, &w.ItemCount)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if matched != len(req.BookIDs) || matched != w.ItemCount {
+		respondValidation(c, []FieldError{{
+			Field:   "book_ids",
+			Code:    "permutation",
+			Message: "must list every book in the list exactly once",
+		}})
+		return
+	}
+
+	_, err = tx.Exec(
+		`UPDATE wishlist_items wi SET position = o.ord
+		 FROM unnest($2::BIGINT[]) WITH ORDINALITY AS o(book_id, ord)
+		 WHERE wi.wishlist_id = $1 AND wi.book_id = o.book_id`,
+		w.ID, pq.Int64Array(req.BookIDs),
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := touchWishlist(tx, w.ID); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	respondWishlist(c, w, http.StatusOK)
+}
+
+// ===================== Wishlist Alerts =====================
+
+// @Summary List my wishlist alerts
+// @Tags Wishlists
+// @Produce  json
+// @Param   unread  query  bool  false  "Only unread alerts"
+// @Param   limit   query  int   false  "Page size (default 50, max 200)"
+// @Param   offset  query  int   false  "Offset"
+// @Success 200  {array}  WishlistAlert
+// @Router  /wishlists/alerts [get]
+func getWishlistAlerts(c *gin.Context) {
+	limit, offset, err := parsePage(c, 50, 200)
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	rows, err := db.Query(
+		`SELECT a.id, a.wishlist_id, a.book_id, b.title, a.kind, a.previous_price_minor, a.price_minor, a.created_at, a.read_at
+		 FROM wishlist_alerts a
+		 JOIN books b ON b.id = a.book_id
+		 WHERE a.user_id = $1 AND ($2 = false OR a.read_at IS NULL)
+		 ORDER BY a.created_at DESC, a.id DESC
+		 LIMIT $3 OFFSET $4`,
+		c.GetInt("user_id"), c.Query("unread") == "true", limit, offset,
+	)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	alerts := []WishlistAlert{}
+	for rows.Next() {
+		var a WishlistAlert
+		var previous sql.NullInt64
+		var price int64
+		err := rows.Scan(&a.ID, &a.WishlistID, &a.BookID, &a.Title, &a.Kind, &previous, &price, &a.CreatedAt, &a.ReadAt)
+		if err != nil {
+			respondInternalError(c, err)
+			return
+		}
+		a.Price = money.New(price, baseCurrency)
+		if previous.Valid {
+			m := money.New(previous.Int64, baseCurrency)
+			a.PreviousPrice = &m
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, alerts)
+}
+
+// markWishlistAlertsRead marks one alert (:alert_id) or, without it, all of
+// the caller's alerts as read.
+func markWishlistAlertsRead(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	query := "UPDATE wishlist_alerts SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL"
+	args := []interface{}{userID}
+
+	if v := c.Param("alert_id"); v != "" {
+		alertID, err := strconv.Atoi(v)
+		if err != nil {
+			respondProblem(c, http.StatusBadRequest, codeBadRequest, "invalid alert id")
+			return
+		}
+		query = "UPDATE wishlist_alerts SET read_at = COALESCE(read_at, NOW()) WHERE user_id = $1 AND id = $2"
+		args = append(args, alertID)
+	}
+
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+	n, _ := result.RowsAffected()
+	if c.Param("alert_id") != "" && n == 0 {
+		respondProblem(c, http.StatusNotFound, codeNotFound, "alert not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"marked": n})
+}
+
+// runWishlistWatcher compares watched books against the price and stock
+// last seen every WISHLIST_WATCH_INTERVAL (default 15m) and records alerts.
+// It runs until ctx is cancelled at shutdown.
+func runWishlistWatcher(ctx context.Context) {
+	runEvery(ctx, cfg.Jobs.WishlistWatchInterval, checkWishlistAlerts)
+}
+
+type watchedItem struct {
+	wishlistID, bookID, userID int
+	seenPrice                  sql.NullInt64
+	seenInStock                sql.NullBool
+	price                      int64
+	inStock                    bool
+}
+
+func checkWishlistAlerts() {
+	rows, err := db.Query(
+		`SELECT wi.wishlist_id, wi.book_id, w.user_id, wi.seen_price_minor, wi.seen_in_stock,
+		        `+bookPriceColumns("$2")+`,
+		        COALESCE(s.on_hand > s.reserved, false)
+		 FROM wishlist_items wi
+		 JOIN wishlists w ON w.id = wi.wishlist_id
+		 JOIN books b ON b.id = wi.book_id
+		 LEFT JOIN stock s ON s.book_id = b.id
+		 WHERE wi.notify AND b.deleted_at IS NULL AND b.status = $1`,
+		statusPublished, baseCurrency,
+	)
+	if err != nil {
+		slog.Error("error checking wishlist alerts", "error", err)
+		return
+	}
+
+	var changed []watchedItem
+	for rows.Next() {
+		var it watchedItem
+		var price int64
+		var originalPrice, listed *int64
+		var discount int
+		err := rows.Scan(&it.wishlistID, &it.bookID, &it.userID, &it.seenPrice, &it.seenInStock,
+			&price, &originalPrice, &discount, &listed, &it.inStock)
+		if err != nil {
+			slog.Error("error scanning watched wishlist item", "error", err)
+			continue
+		}
+		_, unit := basePriceContext.bookPrices(price, originalPrice, discount, listed)
+		it.price = unit.Amount
+		if !it.seenPrice.Valid || !it.seenInStock.Valid ||
+			it.seenPrice.Int64 != it.price || it.seenInStock.Bool != it.inStock {
+			changed = append(changed, it)
+		}
+	}
+	rows.Close()
+
+	alerts := 0
+	for _, it := range changed {
+		n, err := recordWishlistChange(it)
+		if err != nil {
+			slog.Error("error recording wishlist alert", "book_id", it.bookID, "error", err)
+			continue
+		}
+		alerts += n
+	}
+	if alerts > 0 {
+		slog.Info("raised wishlist alerts", "alerts", alerts)
+	}
+}
+
+// recordWishlistChange raises alerts for it and moves its baseline to the
+// current price and stock. No alert is raised when there was no baseline.
+func recordWishlistChange(it watchedItem) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	alerts := 0
+	insert := func(kind string) error {
+		alerts++
+		_, err := tx.Exec(
+			`INSERT INTO wishlist_alerts (user_id, wishlist_id, book_id, kind, previous_price_minor, price_minor)
+			 VALUES ($1, $2, $3, $4, $5, $6)`,
+			it.userID, it.wishlistID, it.bookID, kind, it.seenPrice, it.price,
+		)
+		return err
+	}
+	if it.seenPrice.Valid && it.price < it.seenPrice.Int64 {
+		if err := insert(alertDiscounted); err != nil {
+			return 0, err
+		}
+	}
+	if it.seenInStock.Valid && !it.seenInStock.Bool && it.inStock {
+		if err := insert(alertBackInStock); err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(
+		"UPDATE wishlist_items SET seen_price_minor = $3, seen_in_stock = $4 WHERE wishlist_id = $1 AND book_id = $2",
+		it.wishlistID, it.bookID, it.price, it.inStock,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return alerts, tx.Commit()
+}